@@ -0,0 +1,217 @@
+package analysis
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	a "some/ast"
+	ID "some/domain"
+	s "some/syntax"
+	u "some/util"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/utf8string"
+)
+
+// NOTE: sources in testdata are annotated with comments, annotation applies
+// to the line of the comment, or to the next line with code if the comment
+// is on its own line:
+// - `// @type name: (FN int int)` identifier name on the line has the type
+// - `// @error Sema-0002` error with the code is reported on the line,
+//   `// @error Sema-0002 name` also pins it to the token name on the line
+// every error and warning reported must be annotated, pipeline stops
+// on the first stage with errors, so types are checked only if it typechecks
+
+type typeAnnotation struct {
+	line     int
+	name     string
+	expected string
+}
+
+type errorAnnotation struct {
+	line   int
+	code   string
+	lexeme string
+}
+
+type annotations struct {
+	types  []typeAnnotation
+	errors []errorAnnotation
+}
+
+// annotatedLine returns the line of code the comment is about
+func annotatedLine(src *s.Source, c s.Comment) int {
+	line := -1
+	for i := 0; i < src.TokenCount(); i++ {
+		t := src.Token(ID.Token(i))
+		if t.Tag == ID.TokenTerminator || t.Tag == ID.TokenEOF {
+			continue
+		}
+		if t.Start < c.Start && t.Line == c.Line {
+			return c.Line
+		}
+		if t.Start > c.End {
+			line = t.Line
+			break
+		}
+	}
+	return line
+}
+
+func parseAnnotations(src *s.Source) (annotations, error) {
+	result := annotations{}
+	for _, c := range src.Comments() {
+		text := src.CommentText(c)
+		text = strings.TrimPrefix(text, "//")
+		text = strings.TrimPrefix(strings.TrimSuffix(text, "*/"), "/*")
+		text = strings.TrimSpace(text)
+		line := annotatedLine(src, c)
+
+		switch {
+		case strings.HasPrefix(text, "@type "):
+			name, expected, ok := strings.Cut(strings.TrimPrefix(text, "@type "), ":")
+			if !ok {
+				return result, fmt.Errorf("%d: expected @type name: type, got %s", c.Line, text)
+			}
+			result.types = append(result.types, typeAnnotation{line, strings.TrimSpace(name), normalizeType(expected)})
+		case strings.HasPrefix(text, "@error "):
+			fields := strings.Fields(strings.TrimPrefix(text, "@error "))
+			if len(fields) == 0 || len(fields) > 2 {
+				return result, fmt.Errorf("%d: expected @error code [token], got %s", c.Line, text)
+			}
+			e := errorAnnotation{line: line, code: fields[0]}
+			if len(fields) == 2 {
+				e.lexeme = fields[1]
+			}
+			result.errors = append(result.errors, e)
+		case strings.HasPrefix(text, "@"):
+			return result, fmt.Errorf("%d: unknown annotation %s", c.Line, text)
+		}
+	}
+	return result, nil
+}
+
+// normalizeType makes printed types comparable with written ones, printer puts
+// space after every subtype
+func normalizeType(t string) string {
+	return strings.ReplaceAll(strings.Join(strings.Fields(t), " "), " )", ")")
+}
+
+// runAnnotated returns all mismatches of the source and its annotations
+func runAnnotated(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := compiler{
+		src:     s.NewSource(filepath.Base(path), *utf8string.NewString(string(content))),
+		handler: u.NewHandler(),
+	}
+	typed := c.tokenize() == nil && c.parse() == nil && c.scopecheck() == nil && c.typecheck() == nil
+	if typed {
+		ErrorCheckPass(c.scopecheckResult, &c.src, c.tAst, &c.handler)
+		if c.handler.IsEmpty() {
+			MonomorphizationPass(c.scopecheckResult, &c.src, c.tAst, &c.handler)
+		}
+	}
+
+	expected, err := parseAnnotations(&c.src)
+	if err != nil {
+		return nil, err
+	}
+	mismatches := []string{}
+
+	reported := append(append([]u.Error{}, c.handler.Errors()...), c.handler.Warnings()...)
+	matched := make([]bool, len(reported))
+	for _, e := range expected.errors {
+		found := false
+		for i, r := range reported {
+			line, col, _ := r.Position()
+			if matched[i] || r.Name() != e.code || line != e.line {
+				continue
+			}
+			if e.lexeme != "" {
+				token, ok := c.src.TokenAt(line, col)
+				if !ok || c.src.Lexeme(token) != e.lexeme {
+					continue
+				}
+			}
+			matched[i], found = true, true
+			break
+		}
+		if !found {
+			at := ""
+			if e.lexeme != "" {
+				at = " at " + e.lexeme
+			}
+			mismatches = append(mismatches, fmt.Sprintf("%d: expected %s%s", e.line, e.code, at))
+		}
+	}
+	for i, r := range reported {
+		if !matched[i] {
+			line, col, _ := r.Position()
+			mismatches = append(mismatches, fmt.Sprintf("%d:%d: unexpected %s %s", line, col, r.Name(), strings.TrimSpace(r.Message())))
+		}
+	}
+
+	if len(expected.types) > 0 && !typed {
+		mismatches = append(mismatches, " types are annotated, but the source doesn't typecheck")
+		return mismatches, nil
+	}
+	for _, e := range expected.types {
+		node := identifierAt(c.tAst, &c.src, e.line, e.name)
+		if node == ID.NodeInvalid {
+			mismatches = append(mismatches, fmt.Sprintf("%d: no identifier %s", e.line, e.name))
+			continue
+		}
+		actual := "<none>"
+		if t := c.tAst.GetNodeType(node); t != ID.TypeInvalid {
+			actual = normalizeType(c.tAst.GetTypeRepo().GetString(t))
+		}
+		if actual != e.expected {
+			mismatches = append(mismatches, fmt.Sprintf("%d: expected %s: %s, got %s", e.line, e.name, e.expected, actual))
+		}
+	}
+	return mismatches, nil
+}
+
+// identifierAt returns the first identifier with the name on the line
+func identifierAt(tAst a.TypedAST, src *s.Source, line int, name string) ID.Node {
+	found := ID.NodeInvalid
+	for i := 0; i < tAst.NodeCount(); i++ {
+		n := tAst.GetNode(ID.Node(i))
+		if n.Tag() != ID.NodeIdentifier || src.Token(n.Token()).Line != line {
+			continue
+		}
+		if a.Identifier_String(tAst.AST, ID.Node(i)) != name {
+			continue
+		}
+		if found == ID.NodeInvalid || n.Token() < tAst.GetNode(found).Token() {
+			found = ID.Node(i)
+		}
+	}
+	return found
+}
+
+func TestAnnotated(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.some"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("No sources in testdata")
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			mismatches, err := runAnnotated(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range mismatches {
+				t.Errorf("%s:%s", filepath.Base(path), m)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package analysis
+
+import (
+	a "some/ast"
+	ID "some/domain"
+	s "some/syntax"
+	T "some/typesystem"
+	u "some/util"
+)
+
+// containsError reports whether value of the type carries an error,
+// either by itself or as one of the results
+func containsError(repo T.TypeRepo, t ID.Type) bool {
+	if t == ID.TypeInvalid || repo.IsTypeVariable(t) {
+		return false
+	}
+	it := repo.Subtypes(t)
+	switch repo.GetType(t).Kind {
+	case ID.KindIdentity:
+		return it.Next() == ID.TypeError
+	case ID.KindTuple:
+		for !it.Done() {
+			if containsError(repo, it.Next()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ErrorCheckPass warns about errors that are never looked at: results of calls
+// used as statements and declared variables that are never used
+func ErrorCheckPass(scopeCheckResult ScopeCheckResult, src *s.Source, tAst a.TypedAST, handler *u.ErrorHandler) {
+	repo := tAst.GetTypeRepo()
+	names := scopeCheckResult.QualifiedNames
+
+	warn := func(node ID.Node, what string, t ID.Type) {
+		line, col := src.Location(tAst.GetNode(node).Token())
+		handler.Warn(u.NewError(
+			u.Warning,
+			u.EW_IgnoredError,
+			line,
+			col,
+			src.Filename(),
+			what,
+			repo.GetString(t)))
+	}
+
+	// blank identifier is the explicit way to discard the error
+	checkDeclared := func(list ID.Node) {
+		for _, id := range tAst.IdentifierList(tAst.GetNode(list)).Identifiers {
+			name := a.Identifier_String(tAst.AST, id)
+			t := tAst.GetNodeType(id)
+			if name != "_" && containsError(repo, t) && !names.IsUsed(id) {
+				warn(id, name, t)
+			}
+		}
+	}
+
+	for i := 0; i < tAst.NodeCount(); i++ {
+		id := ID.Node(i)
+		n := tAst.GetNode(id)
+		switch n.Tag() {
+		case ID.NodeBlock:
+			for _, stmt := range tAst.Block(n).Statements {
+				if tAst.GetNode(stmt).Tag() != ID.NodeExpression {
+					continue
+				}
+				if t := tAst.GetNodeType(stmt); containsError(repo, t) {
+					warn(stmt, "result", t)
+				}
+			}
+		case ID.NodeDeferStmt:
+			expr := tAst.DeferStmt(n).Expression
+			if t := tAst.GetNodeType(expr); containsError(repo, t) {
+				warn(expr, "deferred result", t)
+			}
+		case ID.NodeConstDecl:
+			checkDeclared(tAst.ConstDecl(n).IdentifierList)
+		case ID.NodeVarDecl:
+			checkDeclared(tAst.VarDecl(n).IdentifierList)
+		case ID.NodeShortVarDecl:
+			checkDeclared(tAst.ShortVarDecl(n).IdentifierList)
+		}
+	}
+}
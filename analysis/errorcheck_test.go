@@ -0,0 +1,60 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestErrorCheck(t *testing.T) {
+	code := `
+		fn check(s) {
+			if s == "" {
+				return error(s)
+			}
+			return none
+		}
+
+		fn parse(s) {
+			return 1, check(s)
+		}
+
+		fn main() {
+			check("a")
+			n, err := parse("1")
+			w, _ := parse("2")
+			const _ = check("c")
+			const handled = check("b")
+			if handled != none {
+				return 1
+			}
+			return n + w
+		}
+	`
+	c := newCompiler(code)
+	if err := c.tokenize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.scopecheck(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.typecheck(); err != nil {
+		t.Fatal(err)
+	}
+	ErrorCheckPass(c.scopecheckResult, &c.src, c.tAst, &c.handler)
+	warnings := c.handler.AllWarnings()
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %v", warnings)
+	}
+	all := strings.Join(warnings, "")
+	for _, expected := range []string{"result of type error", "err of type error"} {
+		if !strings.Contains(all, expected) {
+			t.Errorf("Expected warning about %s, got %s", expected, all)
+		}
+	}
+	if !c.handler.IsEmpty() {
+		t.Errorf("Warnings must not be errors, got %v", c.handler.AllErrors())
+	}
+}
@@ -0,0 +1,121 @@
+package analysis
+
+import (
+	"math"
+	a "some/ast"
+	ID "some/domain"
+	s "some/syntax"
+	u "some/util"
+)
+
+// integerSize returns number of bits of the integer type and its signedness,
+// false means that the type is not an integer
+func integerSize(basic ID.Type) (bits uint, signed bool, ok bool) {
+	switch basic {
+	case ID.TypeInt, ID.TypeInt64:
+		return 64, true, true
+	case ID.TypeInt8:
+		return 8, true, true
+	case ID.TypeInt16:
+		return 16, true, true
+	case ID.TypeInt32:
+		return 32, true, true
+	case ID.TypeUint8:
+		return 8, false, true
+	case ID.TypeUint16:
+		return 16, false, true
+	case ID.TypeUint32:
+		return 32, false, true
+	case ID.TypeUint64, ID.TypeUintptr:
+		return 64, false, true
+	}
+	return 0, false, false
+}
+
+// fitsInteger reports whether the value (negated or not) is in the range of the integer type
+func fitsInteger(value uint64, negated bool, bits uint, signed bool) bool {
+	if !signed {
+		return negated && value == 0 || !negated && (bits == 64 || value < 1<<bits)
+	}
+	limit := uint64(1) << (bits - 1)
+	if negated {
+		return value <= limit
+	}
+	return value < limit
+}
+
+// unparenthesized returns the expression without enclosing parentheses
+func unparenthesized(ast *a.AST, id ID.Node) ID.Node {
+	for ast.GetNode(id).Tag() == ID.NodeExpression {
+		id = ast.Expression(ast.GetNode(id)).Expression
+	}
+	return id
+}
+
+// checkLiterals reports numeric literals of the instance that don't fit the type
+// they are resolved to. Literal under unary minus is checked as negative number,
+// so the smallest value of the signed type could be written. Literal converted
+// to the other type is checked against the target, like a typed constant
+func checkLiterals(instance Instance, src *s.Source, handler *u.ErrorHandler, reported map[ID.Node]bool) {
+	tAst := instance.TypedAST
+	repo := tAst.GetTypeRepo()
+	negated := make(map[ID.Node]bool)
+	converted := make(map[ID.Node]ID.Node)
+
+	onEnter := func(ast *a.AST, id ID.Node) (shouldStop bool) {
+		n := ast.GetNode(id)
+		switch n.Tag() {
+		case ID.NodeUnaryMinus:
+			operand := unparenthesized(ast, ast.UnaryMinus(n).Unary)
+			negated[operand] = !negated[id]
+			if callee, has := converted[id]; has {
+				converted[operand] = callee
+			}
+		case ID.NodeCall:
+			call := ast.Call(n)
+			if _, isConversion := instance.Conversions[call.LhsExpr]; !isConversion || call.Arguments == ID.NodeUndefined {
+				return
+			}
+			args := ast.ExpressionList(ast.GetNode(call.Arguments)).Expressions
+			if len(args) == 1 {
+				converted[unparenthesized(ast, args[0])] = call.LhsExpr
+			}
+		case ID.NodeIntLiteral, ID.NodeFloatLiteral:
+			t := tAst.GetNodeType(id)
+			if t == ID.TypeInvalid || repo.IsTypeVariable(t) || repo.GetType(t).Kind != ID.KindIdentity {
+				return
+			}
+			it := repo.Subtypes(t)
+			basic := it.Next()
+			typeName := repo.GetString(t)
+			if callee, has := converted[id]; has {
+				basic = instance.Conversions[callee]
+				typeName = a.Identifier_String(*ast, callee)
+			}
+			fits := true
+			if n.Tag() == ID.NodeIntLiteral {
+				if bits, signed, isInteger := integerSize(basic); isInteger {
+					fits = fitsInteger(ast.IntLiteral(n).Value, negated[id], bits, signed)
+				}
+			} else if basic == ID.TypeFloat32 {
+				fits = math.Abs(ast.FloatLiteral(n).Value) <= math.MaxFloat32
+			}
+			if fits || reported[id] {
+				return
+			}
+			reported[id] = true
+			lexeme := src.Lexeme(n.Token())
+			if negated[id] {
+				lexeme = "-" + lexeme
+			}
+			line, col := src.Location(n.Token())
+			handler.Add(u.NewError(u.Semantic, u.ES_LiteralOverflow, line, col, src.Filename(),
+				lexeme, typeName))
+		}
+		return
+	}
+	onExit := func(ast *a.AST, id ID.Node) (shouldStop bool) {
+		return
+	}
+	tAst.TraverseSubtreePreorder(instance.Decl, onEnter, onExit)
+}
@@ -0,0 +1,55 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLiteralRanges(t *testing.T) {
+	code := `
+		fn scale(x) {
+			return x * 200
+		}
+
+		fn main() {
+			const small = int8(-128)
+			const large = uint64(18446744073709551615)
+			const wide = float32(3.4e38)
+			const scaled = scale(int16(2))
+			return 0
+		}
+	`
+	_, c, err := runMonomorphization(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.handler.IsEmpty() {
+		t.Fatal(strings.Join(c.handler.AllErrors(), ""))
+	}
+}
+
+func TestLiteralRangesFail(t *testing.T) {
+	failing := map[string]string{
+		"const x = int8(128)":                       "128 overflows int8",
+		"const x = int8(-129)":                      "-129 overflows int8",
+		"const x = uint8(-1)":                       "-1 overflows uint8",
+		"const x = int(9223372036854775808)":        "9223372036854775808 overflows int",
+		"const x = uint16(0x1_0000)":                "0x1_0000 overflows uint16",
+		"const x = float32(1e39)":                   "1e39 overflows float32",
+		"const x = scale(int8(2))":                  "200 overflows int8",
+		"const x = scale(int8(1)) + scale(int8(2))": "200 overflows int8",
+	}
+	for stmts, expected := range failing {
+		code := "\nfn scale(x) {\nreturn x * 200\n}\nfn main() {\n" + stmts + "\nreturn 0\n}\n"
+		_, c, err := runMonomorphization(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs := c.handler.AllErrors()
+		if len(errs) != 1 {
+			t.Errorf("Expected exactly one error for %s, got %v", stmts, errs)
+		} else if !strings.Contains(errs[0], expected) {
+			t.Errorf("Expected %s in %s", expected, errs[0])
+		}
+	}
+}
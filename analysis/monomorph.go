@@ -0,0 +1,254 @@
+package analysis
+
+import (
+	"fmt"
+	a "some/ast"
+	ID "some/domain"
+	s "some/syntax"
+	T "some/typesystem"
+	u "some/util"
+	"strings"
+)
+
+// Instance is a function declaration specialized for the concrete types
+// it is used with. Nodes of the body are shared with the original AST,
+// only types are different
+type Instance struct {
+	Decl     ID.Node
+	Name     string
+	TypedAST a.TypedAST
+	// usages of top level functions in the body mapped to names of their instances
+	Functions map[ID.Node]string
+	// usages of basic type names mapped to the types they are converting to
+	Conversions map[ID.Node]ID.Type
+}
+
+type MonomorphizationResult struct {
+	Instances      []Instance
+	QualifiedNames QualifiedNames
+	Captures       map[ID.Node][]ID.Node
+}
+
+type pendingInstance struct {
+	index int
+	repo  T.TypeRepo
+	subst map[ID.Type]ID.Type
+}
+
+type monomorphContext struct {
+	tAst      a.TypedAST
+	repo      T.TypeRepo
+	names     QualifiedNames
+	functions map[ID.Node]ID.Node
+	instances []Instance
+	seen      map[string]int
+	pending   []pendingInstance
+}
+
+func newMonomorphContext(names QualifiedNames, tAst a.TypedAST) monomorphContext {
+	c := monomorphContext{
+		tAst:      tAst,
+		repo:      tAst.GetTypeRepo(),
+		names:     names,
+		functions: make(map[ID.Node]ID.Node),
+		instances: make([]Instance, 0, 8),
+		seen:      make(map[string]int),
+		pending:   make([]pendingInstance, 0, 8),
+	}
+	root := tAst.SourceRoot(tAst.GetNode(0))
+	for _, decl := range root.Declarations {
+		if tAst.GetNode(decl).Tag() == ID.NodeFunctionDecl {
+			fn := tAst.FunctionDecl(tAst.GetNode(decl))
+			c.functions[fn.Name] = decl
+		}
+	}
+	return c
+}
+
+func (c monomorphContext) typeVariables(id ID.Type, vars []ID.Type) []ID.Type {
+	if c.repo.IsTypeVariable(id) {
+		v := c.repo.TypeVariable(id)
+		for _, seen := range vars {
+			if seen == v {
+				return vars
+			}
+		}
+		return append(vars, v)
+	}
+	it := c.repo.Subtypes(id)
+	if c.repo.GetType(id).Kind == ID.KindIdentity {
+		return vars
+	}
+	for !it.Done() {
+		vars = c.typeVariables(it.Next(), vars)
+	}
+	return vars
+}
+
+func (c monomorphContext) match(generic ID.Type, repo T.TypeRepo, concrete ID.Type, subst map[ID.Type]ID.Type) {
+	if c.repo.IsTypeVariable(generic) {
+		subst[c.repo.TypeVariable(generic)] = concrete
+		return
+	}
+	if c.repo.GetType(generic).Kind == ID.KindIdentity {
+		return
+	}
+	genericIt := c.repo.Subtypes(generic)
+	concreteIt := repo.Subtypes(concrete)
+	for !genericIt.Done() && !concreteIt.Done() {
+		c.match(genericIt.Next(), repo, concreteIt.Next(), subst)
+	}
+}
+
+// Mangle returns name of the type that is usable in identifiers
+func Mangle(repo T.TypeRepo, id ID.Type) string {
+	t := repo.GetType(id)
+	it := repo.Subtypes(id)
+	switch t.Kind {
+	case ID.KindIdentity:
+		return repo.GetString(id)
+	case ID.KindPtr:
+		return "ptr_" + Mangle(repo, it.Next())
+	case ID.KindOptional:
+		return "opt_" + Mangle(repo, it.Next())
+	case ID.KindFunction:
+		subtypes := make([]string, 0, 4)
+		for !it.Done() {
+			subtypes = append(subtypes, Mangle(repo, it.Next()))
+		}
+		return fmt.Sprintf("fn%d_%s", len(subtypes), strings.Join(subtypes, "_"))
+	case ID.KindTuple:
+		subtypes := make([]string, 0, 4)
+		for !it.Done() {
+			subtypes = append(subtypes, Mangle(repo, it.Next()))
+		}
+		return fmt.Sprintf("tup%d_%s", len(subtypes), strings.Join(subtypes, "_"))
+	default:
+		panic("this switch should be exaustive")
+	}
+}
+
+// instantiate returns name of the instance of decl for the concrete type,
+// instance is created if it haven't been seen yet
+func (c *monomorphContext) instantiate(decl ID.Node, repo T.TypeRepo, concrete ID.Type) string {
+	fn := c.tAst.FunctionDecl(c.tAst.GetNode(decl))
+	genericT := c.tAst.GetNodeType(fn.Name)
+
+	instanceRepo := T.NewTypeRepo()
+	concreteT, _ := instanceRepo.Substitute(ID.NodeInvalid, repo, concrete, nil)
+	subst := make(map[ID.Type]ID.Type)
+	c.match(genericT, instanceRepo, concreteT, subst)
+
+	name := a.Identifier_String(c.tAst.AST, fn.Name)
+	vars := c.typeVariables(genericT, nil)
+	if len(vars) > 0 {
+		mangled := make([]string, 0, len(vars))
+		for _, v := range vars {
+			mangled = append(mangled, Mangle(instanceRepo, subst[v]))
+		}
+		name += "__" + strings.Join(mangled, "_")
+	}
+
+	if _, seen := c.seen[name]; seen {
+		return name
+	}
+	c.instances = append(c.instances, Instance{
+		Decl:        decl,
+		Name:        name,
+		Functions:   make(map[ID.Node]string),
+		Conversions: make(map[ID.Node]ID.Type),
+	})
+	index := len(c.instances) - 1
+	c.seen[name] = index
+	c.pending = append(c.pending, pendingInstance{
+		index: index,
+		repo:  instanceRepo,
+		subst: subst,
+	})
+	return name
+}
+
+// NOTE: Specialization is done only for top level functions, since they are the only
+// ones that are generalized by the type checker
+func MonomorphizationPass(scopeCheckResult ScopeCheckResult, src *s.Source, tAst a.TypedAST, handler *u.ErrorHandler) MonomorphizationResult {
+	ctx := newMonomorphContext(scopeCheckResult.QualifiedNames, tAst)
+
+	hasMain := false
+	for nameNode, decl := range ctx.functions {
+		if a.Identifier_String(tAst.AST, nameNode) == "main" {
+			ctx.instantiate(decl, ctx.repo, tAst.GetNodeType(nameNode))
+			hasMain = true
+			break
+		}
+	}
+	if !hasMain {
+		// program without entry point would compile to nothing
+		line, col := src.Location(ID.Token(src.TokenCount() - 1))
+		handler.Add(u.NewError(u.Semantic, u.ES_MissingMain, line, col, src.Filename()))
+	}
+
+	for len(ctx.pending) > 0 {
+		p := ctx.pending[0]
+		ctx.pending = ctx.pending[1:]
+		instance := &ctx.instances[p.index]
+		reported := make(map[QualifiedName]bool)
+
+		onEnter := func(ast *a.AST, id ID.Node) (shouldStop bool) {
+			t := tAst.GetNodeType(id)
+			if t == ID.TypeInvalid {
+				return
+			}
+			concreteT, ok := p.repo.Substitute(id, ctx.repo, t, p.subst)
+			if ast.GetNode(id).Tag() != ID.NodeIdentifier {
+				return
+			}
+			name, has := ctx.names.GetNodeName(id)
+			if !has {
+				instance.Conversions[id], _ = T.BasicType(a.Identifier_String(*ast, id))
+				return
+			}
+			if !ok {
+				if !reported[name] {
+					reported[name] = true
+					line, col := src.Location(ast.GetNode(id).Token())
+					handler.Add(u.NewError(
+						u.Semantic,
+						u.ES_UnresolvedType,
+						line,
+						col,
+						src.Filename(),
+						a.Identifier_String(*ast, id),
+						instance.Name,
+						ctx.repo.GetString(t)))
+				}
+				return
+			}
+			declNode := ctx.names.GetDeclarationNode(name)
+			if fnDecl, isFunction := ctx.functions[declNode]; isFunction && declNode != id {
+				instance.Functions[id] = ctx.instantiate(fnDecl, p.repo, concreteT)
+				// instantiate could grow the slice
+				instance = &ctx.instances[p.index]
+			}
+			return
+		}
+		onExit := func(ast *a.AST, id ID.Node) (shouldStop bool) {
+			return
+		}
+		tAst.TraverseSubtreePreorder(instance.Decl, onEnter, onExit)
+
+		instance.TypedAST = a.NewTypedAST(&tAst.AST, p.repo)
+	}
+
+	// literals are checked against concrete types, the same literal
+	// could overflow in more than one instance
+	overflowed := make(map[ID.Node]bool)
+	for _, instance := range ctx.instances {
+		checkLiterals(instance, src, handler, overflowed)
+	}
+
+	return MonomorphizationResult{
+		Instances:      ctx.instances,
+		QualifiedNames: scopeCheckResult.QualifiedNames,
+		Captures:       scopeCheckResult.Captures,
+	}
+}
@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	u "some/util"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func runMonomorphization(code string) (MonomorphizationResult, compiler, error) {
+	c := newCompiler(code)
+	if err := c.tokenize(); err != nil {
+		return MonomorphizationResult{}, c, err
+	}
+	if err := c.parse(); err != nil {
+		return MonomorphizationResult{}, c, err
+	}
+	if err := c.scopecheck(); err != nil {
+		return MonomorphizationResult{}, c, err
+	}
+	if err := c.typecheck(); err != nil {
+		return MonomorphizationResult{}, c, err
+	}
+	result := MonomorphizationPass(c.scopecheckResult, &c.src, c.tAst, &c.handler)
+	return result, c, nil
+}
+
+func TestMonomorphizationInstances(t *testing.T) {
+	code := `
+		fn apply(f, x) {
+			return f(x)
+		}
+
+		fn inc(x) {
+			return x + 1
+		}
+
+		fn not(b) {
+			return !b
+		}
+
+		fn main() {
+			const a = apply(inc, 1)
+			const b = apply(not, true)
+			const c = apply(inc, a)
+			return a
+		}
+	`
+	result, c, err := runMonomorphization(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.handler.IsEmpty() {
+		t.Fatal(strings.Join(c.handler.AllErrors(), ""))
+	}
+
+	names := make([]string, 0, len(result.Instances))
+	for _, instance := range result.Instances {
+		names = append(names, instance.Name)
+	}
+	sort.Strings(names)
+	expected := []string{"apply__bool_bool", "apply__int_int", "inc__int", "main", "not"}
+	if strings.Join(names, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected instances %v, got %v", expected, names)
+	}
+
+	for _, instance := range result.Instances {
+		if instance.Name != "apply__int_int" {
+			continue
+		}
+		dump := instance.TypedAST.Dump()
+		if !strings.Contains(dump, "`(FN (FN int int ) int int )`") {
+			t.Errorf("Instance is not retyped\n%s", u.FormatSExpr(dump))
+		}
+	}
+}
+
+func TestMonomorphizationUnresolved(t *testing.T) {
+	code := `
+		fn id(x) {
+			return x
+		}
+
+		fn main() {
+			const f = id
+			return 0
+		}
+	`
+	_, c, err := runMonomorphization(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.handler.IsEmpty() {
+		t.Fatal("Expected unresolved type error")
+	}
+	messages := strings.Join(c.handler.AllErrors(), "")
+	if !strings.Contains(messages, "concrete type of f in main") {
+		t.Errorf("Unresolved type error message malformed: %s", messages)
+	}
+}
+
+func TestMonomorphizationConstrained(t *testing.T) {
+	code := `
+		fn add(a, b) {
+			return a + b
+		}
+
+		fn main() {
+			const s = "a"
+			const a = add(1.5, 2.5)
+			const b = add(s, s)
+			const f = add
+			return add(1, 2)
+		}
+	`
+	result, c, err := runMonomorphization(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.handler.IsEmpty() {
+		t.Fatal(strings.Join(c.handler.AllErrors(), ""))
+	}
+
+	names := make([]string, 0, len(result.Instances))
+	for _, instance := range result.Instances {
+		names = append(names, instance.Name)
+	}
+	sort.Strings(names)
+	expected := []string{"add__float", "add__int", "add__string", "main"}
+	if strings.Join(names, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected instances %v, got %v", expected, names)
+	}
+}
+
+func TestMonomorphizationMissingMain(t *testing.T) {
+	code := `
+		fn id(x) {
+			return x
+		}
+	`
+	result, c, err := runMonomorphization(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Instances) != 0 {
+		t.Errorf("Expected no instances, got %d", len(result.Instances))
+	}
+	errs := c.handler.Errors()
+	if len(errs) != 1 || errs[0].Code() != u.ES_MissingMain {
+		t.Fatalf("Expected missing main error, got %s", strings.Join(c.handler.AllErrors(), ""))
+	}
+}
@@ -6,10 +6,15 @@ import (
 	a "some/ast"
 	ID "some/domain"
 	s "some/syntax"
+	T "some/typesystem"
 	u "some/util"
+	"sort"
 	"strings"
 )
 
+// None is the predeclared value of optional types and errors
+const None = "none"
+
 type declID int
 
 const declTop declID = -1
@@ -28,7 +33,7 @@ func (d decl) String(src *s.Source, ast *a.AST) string {
 	if n.Tag() == ID.NodeSource {
 		return "SRC"
 	}
-	if n.Tag() == ID.NodeFunctionDecl {
+	if n.Tag() == ID.NodeFunctionDecl || n.Tag() == ID.NodeFunctionLit {
 		return "FN"
 	}
 	if n.Tag() == ID.NodeBlock {
@@ -42,19 +47,22 @@ func (d decl) String(src *s.Source, ast *a.AST) string {
 type usage struct {
 	user ID.Node
 	decl declID
+	// scope the usage is in
+	scope declID
 }
 
 type usages []usage
 
-func (u *usages) Add(user ID.Node, decl declID) {
-	*u = append(*u, usage{user: user, decl: decl})
+func (u *usages) Add(user ID.Node, decl declID, scope declID) {
+	*u = append(*u, usage{user: user, decl: decl, scope: scope})
 }
 
 type scopeEnv struct {
 	ast          *a.AST
 	declarations []decl
-	declStack    []decl
+	declStack    []declID
 	declUsages   usages
+	scopeBases   u.Stack[int]
 	scopeBase    int
 	scopeTop     int
 	curLevel     int
@@ -64,8 +72,9 @@ func newScopeEnv(ast *a.AST) scopeEnv {
 	return scopeEnv{
 		ast:          ast,
 		declarations: make([]decl, 0, 4),
-		declStack:    make([]decl, 0, 4),
+		declStack:    make([]declID, 0, 4),
 		declUsages:   make([]usage, 0, 4),
+		scopeBases:   u.NewStack[int](),
 		scopeBase:    0,
 		scopeTop:     0,
 		curLevel:     -1,
@@ -73,21 +82,24 @@ func newScopeEnv(ast *a.AST) scopeEnv {
 }
 
 func (e *scopeEnv) enterScope() {
+	e.scopeBases.Push(e.scopeBase)
 	e.scopeBase = e.scopeTop
 	e.curLevel++
 }
 
 func (e *scopeEnv) exitScope() {
 	e.scopeTop = e.scopeBase
+	e.scopeBase, _ = e.scopeBases.Pop()
 	e.curLevel--
 }
 
 func (e *scopeEnv) add(d decl) {
 	e.declarations = append(e.declarations, d)
+	i := declID(len(e.declarations) - 1)
 	if e.scopeTop < len(e.declStack) {
-		e.declStack[e.scopeTop] = d
+		e.declStack[e.scopeTop] = i
 	} else {
-		e.declStack = append(e.declStack, d)
+		e.declStack = append(e.declStack, i)
 	}
 	e.scopeTop++
 }
@@ -98,11 +110,15 @@ func (e scopeEnv) get(i declID) decl {
 
 func (e scopeEnv) lookup(node ID.Node) declID {
 	for i := e.scopeTop - 1; i >= 0; i-- {
-		d := e.declStack[i]
+		id := e.declStack[i]
+		d := e.declarations[id]
+		if !d.isIdentifier {
+			continue
+		}
 		lhs := a.Identifier_String(*e.ast, node)
 		rhs := a.Identifier_String(*e.ast, d.node)
 		if lhs == rhs {
-			return declID(i)
+			return id
 		}
 	}
 	return declInvalid
@@ -124,18 +140,29 @@ func (e scopeEnv) qualifiedName(i declID) QualifiedName {
 	return QualifiedName(buffer.String())
 }
 
+// QualifiedName is the node of the declaration followed by the nodes
+// of the scopes it is declared in, from innermost to the source
 type QualifiedName string
+
+// Within reports whether the scope is the same or nested in the other one
+func (name QualifiedName) Within(scope QualifiedName) bool {
+	return name == scope || strings.HasSuffix(string(name), "'"+string(scope))
+}
+
 type QualifiedNames struct {
 	names     []QualifiedName
 	declNodes []ID.Node
 	nodeNames map[ID.Node]uint
+	// qualified names of the scopes of declarations and usages
+	nodeScopes map[ID.Node]QualifiedName
 }
 
 func NewQualifiedNames(ctx *scopecheckContext) QualifiedNames {
 	names := QualifiedNames{
-		names:     make([]QualifiedName, 0, 16),
-		declNodes: make([]ID.Node, 0, 16),
-		nodeNames: make(map[ID.Node]uint),
+		names:      make([]QualifiedName, 0, 16),
+		declNodes:  make([]ID.Node, 0, 16),
+		nodeNames:  make(map[ID.Node]uint),
+		nodeScopes: make(map[ID.Node]QualifiedName),
 	}
 	declToName := map[declID]uint{}
 	for i, d := range ctx.env.declarations {
@@ -145,18 +172,23 @@ func NewQualifiedNames(ctx *scopecheckContext) QualifiedNames {
 			last := uint(len(names.names) - 1)
 			names.declNodes = append(names.declNodes, d.node)
 			names.nodeNames[d.node] = last
+			names.nodeScopes[d.node] = ctx.env.qualifiedName(d.parent)
 			declToName[declID(i)] = last
 		}
 	}
 	for _, u := range ctx.env.declUsages {
 		names.nodeNames[u.user] = declToName[u.decl]
+		names.nodeScopes[u.user] = ctx.env.qualifiedName(u.scope)
 	}
 	return names
 }
 
 func (n QualifiedNames) GetNodeName(id ID.Node) (QualifiedName, bool) {
 	i, has := n.nodeNames[id]
-	return n.names[i], has
+	if !has {
+		return "", false
+	}
+	return n.names[i], true
 }
 
 func (n QualifiedNames) GetDeclarationNode(name QualifiedName) ID.Node {
@@ -173,22 +205,96 @@ func (n QualifiedNames) GetDeclarations() []ID.Node {
 	return n.declNodes
 }
 
+// GetNodeScope returns qualified name of the innermost scope of the declaration or usage
+func (n QualifiedNames) GetNodeScope(id ID.Node) (QualifiedName, bool) {
+	scope, has := n.nodeScopes[id]
+	return scope, has
+}
+
+// GetNodesByName returns the declaration and all usages of the name in the order of nodes
+func (n QualifiedNames) GetNodesByName(name QualifiedName) []ID.Node {
+	nodes := make([]ID.Node, 0, 4)
+	for node, i := range n.nodeNames {
+		if n.names[i] == name {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	return nodes
+}
+
+// IsUsed reports whether declared name is referred to anywhere
+func (n QualifiedNames) IsUsed(decl ID.Node) bool {
+	name, has := n.nodeNames[decl]
+	if !has {
+		return false
+	}
+	for node, other := range n.nodeNames {
+		if other == name && node != decl {
+			return true
+		}
+	}
+	return false
+}
+
+type functionLit struct {
+	node ID.Node
+	// declarations before this one are outside of the literal
+	firstDecl declID
+}
+
 type scopecheckContext struct {
 	env scopeEnv
 
-	curParent      declID
-	inUsageContext bool
+	curParent    declID
+	declaredName ID.Node
+	// payload of the variant refers to the type by name
+	typeName     ID.Node
+	usageDepth   int
+	usageDepths  u.Stack[int]
+	functionLits []functionLit
+	captures     map[ID.Node][]ID.Node
+}
+
+// capture adds local declaration to the free variables of every
+// function literal it is used in
+func (ctx *scopecheckContext) capture(i declID) {
+	d := ctx.env.get(i)
+	if d.level == 0 {
+		// top level declarations are never captured
+		return
+	}
+	for j := len(ctx.functionLits) - 1; j >= 0; j-- {
+		lit := ctx.functionLits[j]
+		if i >= lit.firstDecl {
+			break
+		}
+		captured := false
+		for _, node := range ctx.captures[lit.node] {
+			captured = captured || node == d.node
+		}
+		if !captured {
+			ctx.captures[lit.node] = append(ctx.captures[lit.node], d.node)
+		}
+	}
 }
 
 type ScopeCheckResult struct {
 	Ast            *a.AST
 	QualifiedNames QualifiedNames
+	// free variables of function literals, as nodes of their declarations
+	Captures map[ID.Node][]ID.Node
 }
 
 func ScopecheckPass(src *s.Source, ast *a.AST, handler *u.ErrorHandler) ScopeCheckResult {
 	ctx := scopecheckContext{
-		env:       newScopeEnv(ast),
-		curParent: declTop,
+		env:          newScopeEnv(ast),
+		curParent:    declTop,
+		declaredName: ID.NodeInvalid,
+		typeName:     ID.NodeInvalid,
+		usageDepths:  u.NewStack[int](),
+		functionLits: make([]functionLit, 0, 4),
+		captures:     make(map[ID.Node][]ID.Node),
 	}
 
 	addDecl := func(i ID.Node, isIdentifier bool) declID {
@@ -205,6 +311,7 @@ func ScopecheckPass(src *s.Source, ast *a.AST, handler *u.ErrorHandler) ScopeChe
 	}
 
 	dump := func(decls []decl, usages []usage, delimiter string) {
+		str := strings.Builder{}
 		for i := range decls {
 			d := decls[i]
 			p := d.parent
@@ -216,14 +323,14 @@ func ScopecheckPass(src *s.Source, ast *a.AST, handler *u.ErrorHandler) ScopeChe
 			}
 			name = "src" + name
 			isUsage := " used by"
-			for _, u := range usages {
-				if u.decl == declID(i) {
-					isUsage += fmt.Sprintf(" %d", u.user)
+			for _, usage := range usages {
+				if usage.decl == declID(i) {
+					isUsage += fmt.Sprintf(" %d", usage.user)
 				}
 			}
-			fmt.Printf("%d: %s%s -> %s%s", i, name, isUsage, ctx.env.qualifiedName(declID(i)), delimiter)
+			str.WriteString(fmt.Sprintf("%d: %s%s -> %s%s", i, name, isUsage, ctx.env.qualifiedName(declID(i)), delimiter))
 		}
-		fmt.Println("")
+		u.Log.Debug("scopes\n%s", str.String())
 	}
 	_ = dump
 
@@ -235,6 +342,22 @@ func ScopecheckPass(src *s.Source, ast *a.AST, handler *u.ErrorHandler) ScopeChe
 			ctx.curParent = addDecl(i, false)
 
 		case ID.NodeFunctionDecl:
+			// function name belongs to the enclosing scope, so it stays
+			// visible for the functions declared after this one
+			ctx.declaredName = ast.FunctionDecl(n).Name
+			addDecl(ctx.declaredName, true)
+			ctx.env.enterScope()
+			ctx.curParent = addDecl(i, false)
+
+		case ID.NodeFunctionLit:
+			// parameters and body of the literal are not usages,
+			// even though literal itself is an expression
+			ctx.usageDepths.Push(ctx.usageDepth)
+			ctx.usageDepth = 0
+			ctx.functionLits = append(ctx.functionLits, functionLit{
+				node:      i,
+				firstDecl: declID(len(ctx.env.declarations)),
+			})
 			ctx.env.enterScope()
 			ctx.curParent = addDecl(i, false)
 
@@ -242,13 +365,33 @@ func ScopecheckPass(src *s.Source, ast *a.AST, handler *u.ErrorHandler) ScopeChe
 			ctx.env.enterScope()
 			ctx.curParent = addDecl(i, false)
 
+		case ID.NodeVariant:
+			ctx.typeName = ast.Variant(n).Payload
+
+		case ID.NodeMatchArm:
+			// binding of the payload is visible only inside of the arm
+			ctx.env.enterScope()
+			ctx.curParent = addDecl(i, false)
+
+		case ID.NodeIfStmt:
+			// variables of the unwrap are visible only inside of the if
+			if ast.GetNode(ast.IfStmt(n).Expression).Tag() == ID.NodeShortVarDecl {
+				ctx.env.enterScope()
+				ctx.curParent = addDecl(i, false)
+			}
+
 		case ID.NodeExpression:
-			ctx.inUsageContext = true
+			ctx.usageDepth++
 
 		case ID.NodeIdentifier:
-			if ctx.inUsageContext {
+			if i == ctx.declaredName {
+				ctx.declaredName = ID.NodeInvalid
+			} else if ctx.usageDepth > 0 || i == ctx.typeName {
 				index := ctx.env.lookup(i)
-				if index == declInvalid {
+				lexeme := a.Identifier_String(*ast, i)
+				if _, isType := T.BasicType(lexeme); index == declInvalid && (isType || lexeme == None) {
+					// names of basic types and none are predeclared, they don't need qualified name
+				} else if index == declInvalid {
 					id := ast.Identifier(ast.GetNode(i)).Token
 					name := src.Lexeme(id)
 					line, col := src.Location(id)
@@ -260,7 +403,8 @@ func ScopecheckPass(src *s.Source, ast *a.AST, handler *u.ErrorHandler) ScopeChe
 						src.Filename(),
 						name))
 				} else {
-					ctx.env.declUsages.Add(i, index)
+					ctx.env.declUsages.Add(i, index, ctx.curParent)
+					ctx.capture(index)
 				}
 			} else {
 				addDecl(i, true)
@@ -279,12 +423,28 @@ func ScopecheckPass(src *s.Source, ast *a.AST, handler *u.ErrorHandler) ScopeChe
 			ctx.curParent = ctx.env.get(ctx.curParent).parent
 			ctx.env.exitScope()
 
+		case ID.NodeFunctionLit:
+			ctx.curParent = ctx.env.get(ctx.curParent).parent
+			ctx.env.exitScope()
+			ctx.functionLits = ctx.functionLits[:len(ctx.functionLits)-1]
+			ctx.usageDepth, _ = ctx.usageDepths.Pop()
+
 		case ID.NodeBlock:
 			ctx.curParent = ctx.env.get(ctx.curParent).parent
 			ctx.env.exitScope()
 
+		case ID.NodeMatchArm:
+			ctx.curParent = ctx.env.get(ctx.curParent).parent
+			ctx.env.exitScope()
+
+		case ID.NodeIfStmt:
+			if ast.GetNode(ast.IfStmt(n).Expression).Tag() == ID.NodeShortVarDecl {
+				ctx.curParent = ctx.env.get(ctx.curParent).parent
+				ctx.env.exitScope()
+			}
+
 		case ID.NodeExpression:
-			ctx.inUsageContext = false
+			ctx.usageDepth--
 		}
 		return
 	}
@@ -295,5 +455,6 @@ func ScopecheckPass(src *s.Source, ast *a.AST, handler *u.ErrorHandler) ScopeChe
 	return ScopeCheckResult{
 		Ast:            ast,
 		QualifiedNames: NewQualifiedNames(&ctx),
+		Captures:       ctx.captures,
 	}
 }
@@ -3,11 +3,13 @@ package analysis
 import (
 	"errors"
 	a "some/ast"
+	"some/corpus"
 	ID "some/domain"
 	s "some/syntax"
 	u "some/util"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"golang.org/x/exp/utf8string"
 )
@@ -129,3 +131,92 @@ func TestScopecheckLookupFail(t *testing.T) {
 		}
 	}
 }
+
+func TestScopecheckCaptures(t *testing.T) {
+	code := `
+		fn some(a) { }
+		fn outer(a, b) {
+			const c = 1
+			const f = fn(x) {
+				const d = x + a
+				return fn(y) {
+					some(c)
+					return y + d + a
+				}
+			}
+		}
+	`
+	text := utf8string.NewString(code)
+	src := s.NewSource("lookup_test", *text)
+
+	handler := u.NewHandler()
+	tokenizer := s.NewTokenizer(&handler)
+	tokenizer.Tokenize(&src)
+	parser := a.NewParser(&handler)
+	ast := parser.Parse(&src)
+	result := ScopecheckPass(&src, &ast, &handler)
+	if !handler.IsEmpty() {
+		t.Fatal(strings.Join(handler.AllErrors(), ""))
+	}
+
+	captures := map[string]string{}
+	for lit, decls := range result.Captures {
+		names := make([]string, 0, len(decls))
+		for _, decl := range decls {
+			names = append(names, a.Identifier_String(ast, decl))
+		}
+		params := ast.Signature(ast.GetNode(ast.FunctionLit(ast.GetNode(lit)).Signature)).Parameters
+		param := ast.IdentifierList(ast.GetNode(params)).Identifiers[0]
+		captures[a.Identifier_String(ast, param)] = strings.Join(names, " ")
+	}
+	// top level function some is never captured, a is captured by the both literals
+	// since inner one can't reach it otherwise
+	expected := map[string]string{
+		"x": "a c",
+		"y": "c d a",
+	}
+	for param, names := range expected {
+		if captures[param] != names {
+			t.Errorf("Expected captures %s of literal with parameter %s, got %s", names, param, captures[param])
+		}
+	}
+}
+
+func TestNodeNameMissing(t *testing.T) {
+	c := newCompiler("")
+	if err := c.tokenize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.scopecheck(); err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := c.scopecheckResult.QualifiedNames.GetNodeName(0); ok || name != "" {
+		t.Errorf("Expected no name of the source node, got %s", name)
+	}
+}
+
+// NOTE: passes either succeed or report errors, they never panic
+func FuzzScopecheck(f *testing.F) {
+	corpus.Seed(f)
+	f.Fuzz(func(t *testing.T, code string) {
+		if !utf8.ValidString(code) {
+			t.Skip()
+		}
+		c := newCompiler(code)
+		if c.tokenize() != nil || c.parse() != nil {
+			return
+		}
+		c.scopecheckResult = ScopecheckPass(&c.src, &c.ast, &c.handler)
+		names := c.scopecheckResult.QualifiedNames
+		for i := 0; i < c.ast.NodeCount(); i++ {
+			if name, ok := names.GetNodeName(ID.Node(i)); ok {
+				names.GetNodesByName(name)
+				names.GetDeclarationNode(name)
+			}
+			names.GetNodeScope(ID.Node(i))
+		}
+	})
+}
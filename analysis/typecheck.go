@@ -6,28 +6,56 @@ import (
 	s "some/syntax"
 	T "some/typesystem"
 	u "some/util"
+	"strings"
 )
 
 // NOTE: This code is an example of bad non-exaustive switches
 // they are exaustive, but only at runtime - this is just garbage
 
-// TODO: add stack for returns, since it is control structure
 type typeCheckContext struct {
-	repo                T.TypeRepo
-	evaluationStack     u.Stack[ID.Type]
-	returnStack         u.Stack[ID.Type]
+	repo            T.TypeRepo
+	evaluationStack u.Stack[ID.Type]
+	// types of return statements grouped by the function they belong to
+	returnTypes  map[ID.Node][]ID.Type
+	returnOwners map[ID.Node]ID.Node
+	// number of values returned by the function, known from its first return
+	// statement of known arity
+	returnArities       map[ID.Node]int
 	seenIdentifierTypes map[string]ID.Type
+	generalizedTypes    map[string]ID.Type
 	unificationSet      u.DisjointSet
 	inUsageContext      bool
+
+	// declared types that are enumerations
+	enums map[ID.Type]bool
+
+	// set by unify when it refuses to bind variable to the type containing it
+	recursiveVar, recursiveT ID.Type
+	// set by unify when the type doesn't belong to the class of the variable
+	violatedClass T.TypeClass
+	violatingT    ID.Type
+	// set by unify to the innermost pair of types that don't unify
+	mismatchT1, mismatchT2 ID.Type
 }
 
 func newTypeCheckContext() typeCheckContext {
 	return typeCheckContext{
 		repo:                T.NewTypeRepo(),
 		evaluationStack:     u.NewStack[ID.Type](),
+		returnTypes:         make(map[ID.Node][]ID.Type),
+		returnOwners:        make(map[ID.Node]ID.Node),
+		returnArities:       make(map[ID.Node]int),
 		seenIdentifierTypes: make(map[string]ID.Type),
+		generalizedTypes:    make(map[string]ID.Type),
+		enums:               make(map[ID.Type]bool),
 		unificationSet:      u.NewDisjointSet(),
 		inUsageContext:      false,
+		recursiveVar:        ID.TypeInvalid,
+		recursiveT:          ID.TypeInvalid,
+		violatedClass:       T.ClassAny,
+		violatingT:          ID.TypeInvalid,
+		mismatchT1:          ID.TypeInvalid,
+		mismatchT2:          ID.TypeInvalid,
 	}
 }
 
@@ -38,7 +66,56 @@ func (c *typeCheckContext) makeSet(id ID.Type) {
 	c.unificationSet.MakeSet(uint(id))
 }
 
-func (c typeCheckContext) result(ast *a.AST) a.TypedAST {
+func (c *typeCheckContext) result(ast *a.AST) a.TypedAST {
+	c.defaultConstrained()
+	return a.NewTypedAST(ast, c.resolvedRepo())
+}
+
+// generalizedVariables collects representatives of type variables in type id
+func (c typeCheckContext) generalizedVariables(id ID.Type, vars map[ID.Type]bool) {
+	actualID := ID.Type(c.unificationSet.Find(uint(id)))
+	if c.repo.IsTypeVariable(actualID) {
+		vars[actualID] = true
+		return
+	}
+	if c.repo.GetType(actualID).Kind == ID.KindIdentity {
+		return
+	}
+	it := c.repo.Subtypes(actualID)
+	for !it.Done() {
+		c.generalizedVariables(it.Next(), vars)
+	}
+}
+
+// defaultConstrained resolves constrained type variables to the default type of
+// their class (int for the most of them), unless they
+// belong to generalized function, where they are resolved by monomorphization
+func (c *typeCheckContext) defaultConstrained() {
+	generalized := make(map[ID.Type]bool)
+	for _, fnT := range c.generalizedTypes {
+		c.generalizedVariables(fnT, generalized)
+	}
+	defaults := make(map[ID.Type]ID.Type)
+	for id := 0; id < c.repo.Count(); id++ {
+		actualID := ID.Type(c.unificationSet.Find(uint(id)))
+		class := c.repo.Constraint(actualID)
+		if !c.repo.IsTypeVariable(actualID) || class == T.ClassAny || generalized[actualID] {
+			continue
+		}
+		basic := class.Default()
+		t, ok := defaults[basic]
+		if !ok {
+			t = c.repo.AddType(ID.NodeInvalid, ID.KindIdentity, basic)
+			c.makeSet(t)
+			defaults[basic] = t
+		}
+		c.unificationSet.Attach(uint(actualID), uint(t))
+	}
+}
+
+// resolvedRepo returns repo with the same type ids, where every type is
+// replaced by the representative of its unification set
+func (c typeCheckContext) resolvedRepo() T.TypeRepo {
 	repo := T.NewTypeRepo()
 	for id := 0; id < c.repo.Count(); id++ {
 		originalT := c.repo.GetType(ID.Type(id))
@@ -47,6 +124,13 @@ func (c typeCheckContext) result(ast *a.AST) a.TypedAST {
 		// }
 		actualID := ID.Type(c.unificationSet.Find(uint(id)))
 		actualT := c.repo.GetType(actualID)
+		if c.repo.IsTypeVariable(actualID) {
+			// type variable is identified by its representative, that way
+			// all types unified with it are referring to the same variable
+			v := repo.AddType(originalT.Node, ID.KindIdentity, actualID)
+			repo.Constrain(v, c.repo.Constraint(actualID))
+			continue
+		}
 		subtypes := make([]ID.Type, 0, 2)
 		it := c.repo.Subtypes(actualID)
 
@@ -55,8 +139,83 @@ func (c typeCheckContext) result(ast *a.AST) a.TypedAST {
 		}
 		repo.AddType(originalT.Node, actualT.Kind, subtypes...)
 	}
+	for t, name := range c.repo.DeclaredTypes() {
+		repo.DeclareType(t, name)
+	}
+
+	return repo
+}
+
+// NOTE: Only top level functions are generalized (and only after their body is checked),
+// that way every usage of the function gets its own copy of type variables
+func (c *typeCheckContext) instantiate(id ID.Type, fresh map[ID.Type]ID.Type) ID.Type {
+	actualID := ID.Type(c.unificationSet.Find(uint(id)))
+	if c.repo.IsTypeVariable(actualID) {
+		v, ok := fresh[actualID]
+		if !ok {
+			v = c.repo.AddType(ID.NodeInvalid, ID.KindIdentity, ID.TypeVar)
+			c.repo.Constrain(v, c.repo.Constraint(actualID))
+			c.makeSet(v)
+			fresh[actualID] = v
+		}
+		return v
+	}
+	actualT := c.repo.GetType(actualID)
+	if actualT.Kind == ID.KindIdentity {
+		return actualID
+	}
+	subtypes := make([]ID.Type, 0, 4)
+	it := c.repo.Subtypes(actualID)
+	for !it.Done() {
+		subtypes = append(subtypes, it.Next())
+	}
+	for i := range subtypes {
+		subtypes[i] = c.instantiate(subtypes[i], fresh)
+	}
+	t := c.repo.AddType(ID.NodeInvalid, actualT.Kind, subtypes...)
+	c.makeSet(t)
+	return t
+}
 
-	return a.NewTypedAST(ast, repo)
+// occurs checks whether type variable v is a part of type id
+func (c typeCheckContext) occurs(v, id ID.Type) bool {
+	actualID := ID.Type(c.unificationSet.Find(uint(id)))
+	if actualID == v {
+		return true
+	}
+	if c.repo.IsTypeVariable(actualID) || c.repo.GetType(actualID).Kind == ID.KindIdentity {
+		return false
+	}
+	it := c.repo.Subtypes(actualID)
+	for !it.Done() {
+		if c.occurs(v, it.Next()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *typeCheckContext) bind(v, id ID.Type) bool {
+	if class := c.repo.Constraint(v); class != T.ClassAny {
+		it := c.repo.Subtypes(id)
+		kind := c.repo.GetType(id).Kind
+		basic := it.Next()
+		allowed := kind == ID.KindIdentity && class.Allows(basic) ||
+			kind == ID.KindIdentity && c.enums[basic] && class.AllowsEnum() ||
+			kind == ID.KindOptional && class.AllowsOptional()
+		if !allowed {
+			c.violatedClass = class
+			c.violatingT = id
+			return false
+		}
+	}
+	if c.occurs(v, id) {
+		c.recursiveVar = v
+		c.recursiveT = id
+		return false
+	}
+	c.unificationSet.Attach(uint(v), uint(id))
+	return true
 }
 
 func (c *typeCheckContext) unify(id1, id2 ID.Type) bool {
@@ -66,18 +225,23 @@ func (c *typeCheckContext) unify(id1, id2 ID.Type) bool {
 		isTypeVar1 := c.repo.IsTypeVariable(i1)
 		isTypeVar2 := c.repo.IsTypeVariable(i2)
 		if isTypeVar1 && isTypeVar2 {
+			class, ok := c.repo.Constraint(i1).Intersect(c.repo.Constraint(i2))
+			if !ok {
+				c.violatedClass = c.repo.Constraint(i1)
+				c.violatingT = i2
+				return false
+			}
 			c.unificationSet.Union(uint(i1), uint(i2))
+			c.repo.Constrain(ID.Type(c.unificationSet.Find(uint(i1))), class)
 		} else if isTypeVar1 && !isTypeVar2 {
-			c.unificationSet.Union(uint(i1), uint(i2))
+			return c.bind(i1, i2)
 		} else if !isTypeVar1 && isTypeVar2 {
-			c.unificationSet.Union(uint(i2), uint(i1))
+			return c.bind(i2, i1)
 		} else if c.repo.SameKind(i1, i2) {
 			c.unificationSet.Union(uint(i1), uint(i2))
 			types1 := c.repo.Subtypes(i1)
 			types2 := c.repo.Subtypes(i2)
 			for {
-				sub1 := types1.Next()
-				sub2 := types2.Next()
 				if (types1.Done() && !types2.Done()) ||
 					(!types1.Done() && types2.Done()) {
 					return false
@@ -85,11 +249,12 @@ func (c *typeCheckContext) unify(id1, id2 ID.Type) bool {
 				if types1.Done() && types2.Done() {
 					break
 				}
-				if !c.unify(sub1, sub2) {
+				if !c.unify(types1.Next(), types2.Next()) {
 					return false
 				}
 			}
 		} else /* Type inference failed */ {
+			c.mismatchT1, c.mismatchT2 = i1, i2
 			return false
 		}
 	}
@@ -114,14 +279,55 @@ func TypeCheckPass(scopeCheckResult ScopeCheckResult, src *s.Source, ast *a.AST,
 	}
 	_ = addFunctionType
 
+	addConstrainedType := func(node ID.Node, class T.TypeClass) ID.Type {
+		t := addSimpleType(node, ID.TypeVar)
+		ctx.repo.Constrain(t, class)
+		return t
+	}
+
 	tryUnify := func(node ID.Node, t1, t2 ID.Type) bool {
 		result := ctx.unify(t1, t2)
-		if !result {
-			assumedT1 := ID.Type(ctx.unificationSet.Find(uint(t1)))
-			assumedT2 := ID.Type(ctx.unificationSet.Find(uint(t2)))
+		if !result && ctx.recursiveVar != ID.TypeInvalid {
+			repo := ctx.resolvedRepo()
+			line, col := src.Location(ast.GetNode(node).Token())
+			handler.Add(
+				u.NewError(u.Semantic,
+					u.ES_InfiniteType,
+					line,
+					col,
+					src.Filename(),
+					repo.GetString(ctx.recursiveVar),
+					repo.GetString(ctx.recursiveT),
+					node))
+			ctx.recursiveVar = ID.TypeInvalid
+			ctx.recursiveT = ID.TypeInvalid
+		} else if !result && ctx.violatingT != ID.TypeInvalid {
+			repo := ctx.resolvedRepo()
 			line, col := src.Location(ast.GetNode(node).Token())
-			s1 := ctx.repo.GetString(assumedT1)
-			s2 := ctx.repo.GetString(assumedT2)
+			handler.Add(
+				u.NewError(u.Semantic,
+					u.ES_ConstraintFailed,
+					line,
+					col,
+					src.Filename(),
+					repo.GetString(ctx.violatingT),
+					ctx.violatedClass.String(),
+					node))
+			ctx.violatedClass = T.ClassAny
+			ctx.violatingT = ID.TypeInvalid
+		} else if !result {
+			// outer types are already unified, the innermost mismatch tells
+			// what is wrong
+			assumedT1, assumedT2 := t1, t2
+			if ctx.mismatchT1 != ID.TypeInvalid {
+				assumedT1, assumedT2 = ctx.mismatchT1, ctx.mismatchT2
+			}
+			line, col := src.Location(ast.GetNode(node).Token())
+			repo := ctx.resolvedRepo()
+			s1 := repo.GetString(assumedT1)
+			s2 := repo.GetString(assumedT2)
+			ctx.mismatchT1 = ID.TypeInvalid
+			ctx.mismatchT2 = ID.TypeInvalid
 			handler.Add(
 				u.NewError(u.Semantic,
 					u.ES_TypeinferenceFailed,
@@ -135,63 +341,420 @@ func TypeCheckPass(scopeCheckResult ScopeCheckResult, src *s.Source, ast *a.AST,
 		return result
 	}
 
+	popN := func(n int) []ID.Type {
+		types := make([]ID.Type, n)
+		for i := n - 1; i >= 0; i-- {
+			types[i], _ = ctx.evaluationStack.Pop()
+		}
+		return types
+	}
+
+	listLength := func(list ID.Node) int {
+		if list == ID.NodeUndefined {
+			return 0
+		}
+		n := ast.GetNode(list)
+		if n.Tag() == ID.NodeIdentifierList {
+			return len(ast.IdentifierList(n).Identifiers)
+		}
+		return len(ast.ExpressionList(n).Expressions)
+	}
+
+	// arity returns the number of values of the type, or 0 while it is not known,
+	// constrained variables are never bound to tuples
+	arity := func(t ID.Type) int {
+		t = ID.Type(ctx.unificationSet.Find(uint(t)))
+		if ctx.repo.IsTypeVariable(t) {
+			if ctx.repo.Constraint(t) == T.ClassAny {
+				return 0
+			}
+			return 1
+		}
+		if ctx.repo.GetType(t).Kind == ID.KindTuple {
+			return ctx.repo.Subtypes(t).Count()
+		}
+		return 1
+	}
+
+	// NOTE: Single value on the right hand side of several ones on the left
+	// is destructured, so it must be a tuple
+	unifyLists := func(node ID.Node, lhsList, rhsList ID.Node) {
+		rhsTs := popN(listLength(rhsList))
+		lhsTs := popN(listLength(lhsList))
+		if len(rhsTs) == 1 && len(lhsTs) > 1 {
+			t := ctx.repo.AddType(ID.NodeInvalid, ID.KindTuple, lhsTs...)
+			ctx.makeSet(t)
+			tryUnify(node, rhsTs[0], t)
+			return
+		}
+		if len(lhsTs) != len(rhsTs) {
+			line, col := src.Location(ast.GetNode(node).Token())
+			handler.Add(
+				u.NewError(u.Semantic,
+					u.ES_AssignmentMismatch,
+					line,
+					col,
+					src.Filename(),
+					len(lhsTs),
+					len(rhsTs)))
+		}
+		for i := 0; i < u.Min(len(lhsTs), len(rhsTs)); i++ {
+			tryUnify(node, rhsTs[i], lhsTs[i])
+		}
+	}
+
+	// NOTE: Declaration in the condition of if is the unwrap of the optional,
+	// first variable gets the value and the second one tells if there is one
+	unwraps := make(map[ID.Node]bool)
+	for i := 0; i < ast.NodeCount(); i++ {
+		n := ast.GetNode(ID.Node(i))
+		if n.Tag() == ID.NodeIfStmt && ast.GetNode(ast.IfStmt(n).Expression).Tag() == ID.NodeShortVarDecl {
+			unwraps[ast.IfStmt(n).Expression] = true
+		}
+	}
+
+	unwrap := func(node ID.Node, lhsList, rhsList ID.Node) {
+		rhsTs := popN(listLength(rhsList))
+		lhsTs := popN(listLength(lhsList))
+		if len(rhsTs) != 1 || len(lhsTs) > 2 {
+			line, col := src.Location(ast.GetNode(node).Token())
+			handler.Add(
+				u.NewError(u.Semantic,
+					u.ES_InvalidUnwrap,
+					line,
+					col,
+					src.Filename(),
+					len(lhsTs),
+					len(rhsTs)))
+			return
+		}
+		optT := ctx.repo.AddType(ID.NodeInvalid, ID.KindOptional, lhsTs[0])
+		ctx.makeSet(optT)
+		tryUnify(node, rhsTs[0], optT)
+		if len(lhsTs) == 2 {
+			tryUnify(node, lhsTs[1], addSimpleType(ID.NodeInvalid, ID.TypeBool))
+		}
+	}
+
+	// calls of basic type names (not shadowed by the user) are conversions
+	conversions := make(map[ID.Node]bool)
+	for i := 0; i < ast.NodeCount(); i++ {
+		n := ast.GetNode(ID.Node(i))
+		if n.Tag() != ID.NodeCall {
+			continue
+		}
+		callee := ast.Call(n).LhsExpr
+		if ast.GetNode(callee).Tag() != ID.NodeIdentifier {
+			continue
+		}
+		_, has := qualifiedNames.GetNodeName(callee)
+		if _, isType := T.BasicType(a.Identifier_String(*ast, callee)); isType && !has {
+			conversions[callee] = true
+		}
+	}
+
+	checkConversion := func(node ID.Node, calleeT ID.Type, argTs []ID.Type, v ID.Type) {
+		target, _ := T.BasicType(a.Identifier_String(*ast, ast.Call(ast.GetNode(node)).LhsExpr))
+		targetT := addSimpleType(ID.NodeInvalid, target)
+		tryUnify(node, v, targetT)
+		if len(argTs) != 1 {
+			line, col := src.Location(ast.GetNode(node).Token())
+			handler.Add(
+				u.NewError(u.Semantic,
+					u.ES_ConversionArity,
+					line,
+					col,
+					src.Filename(),
+					ctx.repo.GetString(targetT),
+					len(argTs)))
+			return
+		}
+		class, ok := T.ConversionClass(target)
+		sourceT := addConstrainedType(ID.NodeInvalid, class)
+		if !ok || !ctx.unify(argTs[0], sourceT) {
+			ctx.violatedClass = T.ClassAny
+			ctx.violatingT = ID.TypeInvalid
+			ctx.recursiveVar = ID.TypeInvalid
+			ctx.recursiveT = ID.TypeInvalid
+			ctx.mismatchT1 = ID.TypeInvalid
+			ctx.mismatchT2 = ID.TypeInvalid
+			// constrained variable comes from the literal, it is named by the
+			// type it defaults to, like untyped int
+			argT := ID.Type(ctx.unificationSet.Find(uint(argTs[0])))
+			untyped := ID.TypeInvalid
+			if ctx.repo.IsTypeVariable(argT) && ctx.repo.Constraint(argT) != T.ClassAny {
+				untyped = addSimpleType(ID.NodeInvalid, ctx.repo.Constraint(argT).Default())
+			}
+			repo := ctx.resolvedRepo()
+			argS := repo.GetString(argTs[0])
+			if untyped != ID.TypeInvalid {
+				argS = "untyped " + repo.GetString(untyped)
+			}
+			line, col := src.Location(ast.GetNode(node).Token())
+			handler.Add(
+				u.NewError(u.Semantic,
+					u.ES_InvalidConversion,
+					line,
+					col,
+					src.Filename(),
+					argS,
+					repo.GetString(targetT),
+					node))
+		}
+		tryUnify(node, calleeT, addFunctionType(ID.NodeInvalid, argTs[0], v))
+	}
+
+	// NOTE: Types are declared before anything else, so variants could refer
+	// to the types declared after them. Every variant is a constructor:
+	// function from the payload to the union, or the union value itself
+	typeDecls := make(map[QualifiedName]ID.Type)
+	// names in type declarations are not values, they have no type by themselves
+	declarationOnly := make(map[ID.Node]bool)
+	unions := make([]ID.Node, 0, 4)
+	for _, decl := range ast.SourceRoot(ast.GetNode(0)).Declarations {
+		n := ast.GetNode(decl)
+		if n.Tag() != ID.NodeTypeDecl {
+			continue
+		}
+		typeDecl := ast.TypeDecl(n)
+		t := T.DeclaredType(decl)
+		ctx.repo.DeclareType(t, a.Identifier_String(*ast, typeDecl.Name))
+		name, _ := qualifiedNames.GetNodeName(typeDecl.Name)
+		typeDecls[name] = t
+		declarationOnly[typeDecl.Name] = true
+		unions = append(unions, decl)
+	}
+
+	payloadType := func(payload ID.Node) ID.Type {
+		name, has := qualifiedNames.GetNodeName(payload)
+		if t, declared := typeDecls[name]; has && declared {
+			return addSimpleType(ID.NodeInvalid, t)
+		}
+		lexeme := a.Identifier_String(*ast, payload)
+		if t, isBasic := T.BasicType(lexeme); !has && isBasic {
+			return addSimpleType(ID.NodeInvalid, t)
+		}
+		line, col := src.Location(ast.GetNode(payload).Token())
+		handler.Add(u.NewError(u.Semantic, u.ES_NotAType, line, col, src.Filename(), lexeme))
+		return addSimpleType(ID.NodeInvalid, ID.TypeVar)
+	}
+
+	for _, decl := range unions {
+		unionT := T.DeclaredType(decl)
+		typeNode := ast.GetNode(ast.TypeDecl(ast.GetNode(decl)).Type)
+		if typeNode.Tag() == ID.NodeEnumType {
+			// members are values of the enumeration
+			ctx.enums[unionT] = true
+			for _, member := range ast.EnumType(typeNode).Members {
+				declarationOnly[member] = true
+				name, _ := qualifiedNames.GetNodeName(member)
+				ctx.generalizedTypes[string(name)] = addSimpleType(member, unionT)
+			}
+			continue
+		}
+		union := ast.UnionType(typeNode)
+		for _, variant := range union.Variants {
+			v := ast.Variant(ast.GetNode(variant))
+			declarationOnly[v.Name] = true
+			var ctorT ID.Type
+			if v.Payload == ID.NodeUndefined {
+				ctorT = addSimpleType(v.Name, unionT)
+			} else {
+				declarationOnly[v.Payload] = true
+				ctorT = addFunctionType(v.Name, payloadType(v.Payload), addSimpleType(ID.NodeInvalid, unionT))
+			}
+			name, _ := qualifiedNames.GetNodeName(v.Name)
+			ctx.generalizedTypes[string(name)] = ctorT
+		}
+	}
+
+	// every arm of the match unifies its pattern with the type of the match
+	matchTypes := make(map[ID.Node]ID.Type)
+	armMatches := make(map[ID.Node]ID.Node)
+	for i := 0; i < ast.NodeCount(); i++ {
+		n := ast.GetNode(ID.Node(i))
+		if n.Tag() != ID.NodeMatch {
+			continue
+		}
+		matchTypes[ID.Node(i)] = addSimpleType(ID.NodeInvalid, ID.TypeVar)
+		for _, arm := range ast.Match(n).Arms {
+			armMatches[arm] = ID.Node(i)
+		}
+	}
+
+	// variantNames returns names of the variants or members of the declared type
+	variantNames := func(decl ID.Node) []string {
+		names := make([]string, 0, 4)
+		typeNode := ast.GetNode(ast.TypeDecl(ast.GetNode(decl)).Type)
+		if typeNode.Tag() == ID.NodeEnumType {
+			for _, member := range ast.EnumType(typeNode).Members {
+				names = append(names, a.Identifier_String(*ast, member))
+			}
+			return names
+		}
+		for _, variant := range ast.UnionType(typeNode).Variants {
+			names = append(names, a.Identifier_String(*ast, ast.Variant(ast.GetNode(variant)).Name))
+		}
+		return names
+	}
+
+	// checkMatch reports variants of the union that are matched
+	// more than once or are not matched at all
+	checkMatch := func(node ID.Node, match a.Match, matchT ID.Type) {
+		line, col := src.Location(ast.GetNode(node).Token())
+		actualT := ID.Type(ctx.unificationSet.Find(uint(matchT)))
+		decl, isUnion := ID.NodeInvalid, false
+		if !ctx.repo.IsTypeVariable(actualT) && ctx.repo.GetType(actualT).Kind == ID.KindIdentity {
+			it := ctx.repo.Subtypes(actualT)
+			decl, isUnion = T.TypeDeclaration(it.Next())
+		}
+		if !isUnion {
+			handler.Add(u.NewError(u.Semantic, u.ES_MatchNotUnion, line, col, src.Filename(),
+				ctx.repo.GetString(actualT)))
+			return
+		}
+		matched := make(map[string]bool)
+		for _, arm := range match.Arms {
+			pattern := ast.Expression(ast.GetNode(ast.MatchArm(ast.GetNode(arm)).Pattern)).Expression
+			name := a.Identifier_String(*ast, pattern)
+			if matched[name] {
+				armLine, armCol := src.Location(ast.GetNode(arm).Token())
+				handler.Add(u.NewError(u.Semantic, u.ES_DuplicateVariant, armLine, armCol, src.Filename(), name))
+			}
+			matched[name] = true
+		}
+		missing := make([]string, 0, 4)
+		typeDecl := ast.TypeDecl(ast.GetNode(decl))
+		for _, name := range variantNames(decl) {
+			if !matched[name] {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			handler.Add(u.NewError(u.Semantic, u.ES_NonExhaustiveMatch, line, col, src.Filename(),
+				a.Identifier_String(*ast, typeDecl.Name), strings.Join(missing, ", ")))
+		}
+	}
+
+	// functionType joins parameters with the types of return statements of the function
+	functionType := func(id ID.Node, typeNode ID.Node, paramTs []ID.Type) ID.Type {
+		returnT := addSimpleType(ID.NodeInvalid, ID.TypeVar)
+		if len(ctx.returnTypes[id]) == 0 {
+			voidT := addSimpleType(ID.NodeInvalid, ID.TypeVoid)
+			tryUnify(id, returnT, voidT)
+		}
+		for _, retT := range ctx.returnTypes[id] {
+			tryUnify(id, retT, returnT)
+		}
+		return addFunctionType(typeNode, append(paramTs, returnT)...)
+	}
+
 	onEnter := func(ast *a.AST, id ID.Node) (shouldStop bool) {
 		n := ast.GetNode(id)
 
 		switch n.Tag() {
 		case ID.NodeFunctionDecl:
-			// TODO: we should handle returns, parameters and name here
-			identifierTs := make([]ID.Type, 0, 16)
-			for {
-				identifierT, ok := ctx.evaluationStack.Pop()
-				if !ok {
-					break
-				}
-				node := ctx.repo.GetType(identifierT).Node
-				if ast.GetNode(node).Tag() != ID.NodeIdentifier {
-					ctx.evaluationStack.Push(identifierT)
-					break
+			fn := ast.FunctionDecl(n)
+			signature := ast.Signature(ast.GetNode(fn.Signature))
+			identifierTs := popN(listLength(signature.Parameters) + 1)
+
+			fnT := identifierTs[0]
+			t := functionType(id, ctx.repo.GetType(fnT).Node, identifierTs[1:])
+			tryUnify(id, fnT, t)
+
+			name, _ := qualifiedNames.GetNodeName(fn.Name)
+			ctx.generalizedTypes[string(name)] = fnT
+		case ID.NodeBlock:
+			// expression statements leave their types on the stack
+			for _, stmt := range ast.Block(n).Statements {
+				if ast.GetNode(stmt).Tag() == ID.NodeExpression {
+					ctx.evaluationStack.Pop()
 				}
-				identifierTs = append(identifierTs, identifierT)
 			}
-			if len(identifierTs) == 0 {
-				panic("Excepted at least function type here")
-			}
-			paramTs := identifierTs[1:]
-			returnT := addSimpleType(ID.NodeInvalid, ID.TypeVar)
-			for !ctx.returnStack.IsEmpty() {
-				retT, _ := ctx.returnStack.Pop()
-				if !tryUnify(id, retT, returnT) {
-					return
-				}
+		case ID.NodeIfStmt:
+			if unwraps[ast.IfStmt(n).Expression] {
+				break
 			}
-			signatureT := append(paramTs, returnT)
-			fnT := identifierTs[0]
-			t := addFunctionType(ctx.repo.GetType(fnT).Node, signatureT...)
-			ctx.unify(fnT, t)
-			//TODO: remove
-			// t := addSimpleType(ID.NodeInvalid, ID.TypeInt)
-			// ctx.unify(firstReturnT, t)
+			condT, _ := ctx.evaluationStack.Pop()
+			t := addSimpleType(ID.NodeInvalid, ID.TypeBool)
+			tryUnify(id, condT, t)
+		case ID.NodeDeferStmt:
+			// result of the deferred call is discarded
+			ctx.evaluationStack.Pop()
 		case ID.NodeVarDecl:
-			fallthrough
+			decl := ast.VarDecl(n)
+			unifyLists(id, decl.IdentifierList, decl.ExpressionList)
+		case ID.NodeShortVarDecl:
+			decl := ast.ShortVarDecl(n)
+			if unwraps[id] {
+				unwrap(id, decl.IdentifierList, decl.ExpressionList)
+				break
+			}
+			unifyLists(id, decl.IdentifierList, decl.ExpressionList)
 		case ID.NodeConstDecl:
-			fallthrough
+			decl := ast.ConstDecl(n)
+			unifyLists(id, decl.IdentifierList, decl.ExpressionList)
 		case ID.NodeAssignment:
-			lhsT, _ := ctx.evaluationStack.Pop()
-			rhsT, _ := ctx.evaluationStack.Pop()
-			if !tryUnify(id, rhsT, lhsT) {
-				return
-			}
+			assignment := ast.Assignment(n)
+			unifyLists(id, assignment.LhsList, assignment.RhsList)
 		case ID.NodeReturnStmt:
-			exprT, _ := ctx.evaluationStack.Pop()
+			exprTs := popN(listLength(ast.ReturnStmt(n).ExpressionList))
+			exprT := exprTs[0]
+			if len(exprTs) > 1 {
+				exprT = ctx.repo.AddType(ID.NodeInvalid, ID.KindTuple, exprTs...)
+				ctx.makeSet(exprT)
+			}
+			owner := ctx.returnOwners[id]
+			if count := arity(exprT); count > 0 {
+				expected, known := ctx.returnArities[owner]
+				if known && count != expected {
+					line, col := src.Location(n.Token())
+					handler.Add(
+						u.NewError(u.Semantic,
+							u.ES_ReturnMismatch,
+							line,
+							col,
+							src.Filename(),
+							count,
+							expected))
+					break
+				}
+				ctx.returnArities[owner] = count
+			}
 			returnT := addSimpleType(id, ID.TypeVar)
 			ctx.unify(returnT, exprT)
-			ctx.returnStack.Push(returnT)
+			ctx.returnTypes[owner] = append(ctx.returnTypes[owner], returnT)
+		case ID.NodeFunctionLit:
+			// NOTE: Literals are not generalized, their type is the same for every usage
+			signature := ast.Signature(ast.GetNode(ast.FunctionLit(n).Signature))
+			paramTs := popN(listLength(signature.Parameters))
+			v := addSimpleType(id, ID.TypeVar)
+			tryUnify(id, v, functionType(id, ID.NodeInvalid, paramTs))
+			ctx.evaluationStack.Push(v)
+		case ID.NodeCall:
+			argTs := popN(listLength(ast.Call(n).Arguments))
+			calleeT, _ := ctx.evaluationStack.Pop()
+			v := addSimpleType(id, ID.TypeVar)
+			if conversions[ast.Call(n).LhsExpr] {
+				checkConversion(id, calleeT, argTs, v)
+				ctx.evaluationStack.Push(v)
+				break
+			}
+			t := addFunctionType(ID.NodeInvalid, append(argTs, v)...)
+			tryUnify(id, calleeT, t)
+			ctx.evaluationStack.Push(v)
 
 		case ID.NodeOr:
 			fallthrough
 		case ID.NodeAnd:
-			fallthrough
+			rhsT, _ := ctx.evaluationStack.Pop()
+			lhsT, _ := ctx.evaluationStack.Pop()
+			v := addSimpleType(id, ID.TypeVar)
+			t := addSimpleType(ID.NodeInvalid, ID.TypeBool)
+			if tryUnify(id, lhsT, t) && tryUnify(id, rhsT, t) {
+				tryUnify(id, v, t)
+			}
+			ctx.evaluationStack.Push(v)
 		case ID.NodeEquals:
 			fallthrough
 		case ID.NodeNotEquals:
@@ -203,18 +766,18 @@ func TypeCheckPass(scopeCheckResult ScopeCheckResult, src *s.Source, ast *a.AST,
 		case ID.NodeGreaterThanEquals:
 			fallthrough
 		case ID.NodeLessThanEquals:
-			lhsT, _ := ctx.evaluationStack.Pop()
 			rhsT, _ := ctx.evaluationStack.Pop()
+			lhsT, _ := ctx.evaluationStack.Pop()
 			v := addSimpleType(id, ID.TypeVar)
 			t := addSimpleType(ID.NodeInvalid, ID.TypeBool)
-			if !tryUnify(id, lhsT, rhsT) {
-				return
-			}
-			if !tryUnify(id, lhsT, v) {
-				return
+			class := T.ClassOrd
+			if n.Tag() == ID.NodeEquals || n.Tag() == ID.NodeNotEquals {
+				class = T.ClassEq
 			}
-			if !tryUnify(id, lhsT, t) {
-				return
+			operandT := addConstrainedType(ID.NodeInvalid, class)
+			tryUnify(id, v, t)
+			if tryUnify(id, lhsT, rhsT) {
+				tryUnify(id, lhsT, operandT)
 			}
 			ctx.evaluationStack.Push(v)
 		case ID.NodeBinaryMinus:
@@ -223,73 +786,117 @@ func TypeCheckPass(scopeCheckResult ScopeCheckResult, src *s.Source, ast *a.AST,
 			fallthrough
 		case ID.NodeDivide:
 			fallthrough
-		// TODO: In this case binary plus `adds` all types together, however, I need only
-		// int, float, string
 		case ID.NodeBinaryPlus:
-			lhsT, _ := ctx.evaluationStack.Pop()
 			rhsT, _ := ctx.evaluationStack.Pop()
-			v := addSimpleType(id, ID.TypeVar)
-			if !tryUnify(id, lhsT, rhsT) {
-				return
+			lhsT, _ := ctx.evaluationStack.Pop()
+			class := T.ClassNum
+			if n.Tag() == ID.NodeBinaryPlus {
+				class = T.ClassConcat
 			}
-			if !tryUnify(id, lhsT, v) {
-				return
+			v := addConstrainedType(id, class)
+			if tryUnify(id, lhsT, rhsT) {
+				tryUnify(id, lhsT, v)
 			}
 			ctx.evaluationStack.Push(v)
 		case ID.NodeUnaryPlus:
 			fallthrough
 		case ID.NodeUnaryMinus:
-			v, _ := ctx.evaluationStack.Pop()
-			t := addSimpleType(ID.NodeInvalid, ID.TypeInt)
-			if !tryUnify(id, t, v) {
-				return
+			unaryT, _ := ctx.evaluationStack.Pop()
+			v := addConstrainedType(id, T.ClassNum)
+			tryUnify(id, v, unaryT)
+			ctx.evaluationStack.Push(v)
+		case ID.NodeMatchArm:
+			arm := ast.MatchArm(n)
+			matchT := matchTypes[armMatches[id]]
+			if arm.Binding == ID.NodeUndefined {
+				patternT, _ := ctx.evaluationStack.Pop()
+				tryUnify(id, patternT, matchT)
+				break
 			}
+			bindingT, _ := ctx.evaluationStack.Pop()
+			patternT, _ := ctx.evaluationStack.Pop()
+			tryUnify(id, patternT, addFunctionType(ID.NodeInvalid, bindingT, matchT))
+		case ID.NodeMatch:
+			exprT, _ := ctx.evaluationStack.Pop()
+			if tryUnify(id, exprT, matchTypes[id]) {
+				checkMatch(id, ast.Match(n), matchTypes[id])
+			}
+		case ID.NodeOptional:
+			unaryT, _ := ctx.evaluationStack.Pop()
+			v := addSimpleType(id, ID.TypeVar)
+			t := ctx.repo.AddType(ID.NodeInvalid, ID.KindOptional, unaryT)
+			ctx.makeSet(t)
+			tryUnify(id, v, t)
 			ctx.evaluationStack.Push(v)
 		case ID.NodeNot:
-			v, _ := ctx.evaluationStack.Pop()
+			unaryT, _ := ctx.evaluationStack.Pop()
+			v := addSimpleType(id, ID.TypeVar)
 			t := addSimpleType(ID.NodeInvalid, ID.TypeBool)
-			if !tryUnify(id, t, v) {
-				return
+			if tryUnify(id, t, unaryT) {
+				tryUnify(id, v, unaryT)
 			}
 			ctx.evaluationStack.Push(v)
 		case ID.NodeIdentifier:
+			if declarationOnly[id] {
+				break
+			}
 			name, has := qualifiedNames.GetNodeName(id)
 			if !has {
-				panic("Something went horribly wrong")
+				// NOTE: Scopecheck leaves only names of basic types and none unresolved,
+				// their type is set by the conversion they are used in
+				lexeme := a.Identifier_String(*ast, id)
+				if lexeme == None {
+					ctx.evaluationStack.Push(addConstrainedType(id, T.ClassNullable))
+					break
+				}
+				if !conversions[id] {
+					line, col := src.Location(n.Token())
+					handler.Add(u.NewError(
+						u.Semantic,
+						u.ES_TypeAsValue,
+						line,
+						col,
+						src.Filename(),
+						lexeme))
+				}
+				ctx.evaluationStack.Push(addSimpleType(id, ID.TypeVar))
+				break
 			}
-			seenT, seen := ctx.seenIdentifierTypes[string(name)]
-			var v ID.Type
-			if !seen {
-				v = addSimpleType(id, ID.TypeVar)
-				ctx.seenIdentifierTypes[string(name)] = v
+			v := addSimpleType(id, ID.TypeVar)
+			if generalT, generalized := ctx.generalizedTypes[string(name)]; generalized {
+				t := ctx.instantiate(generalT, make(map[ID.Type]ID.Type))
+				tryUnify(id, t, v)
+			} else if seenT, seen := ctx.seenIdentifierTypes[string(name)]; seen {
+				tryUnify(id, seenT, v)
 			} else {
-				v = seenT
-				// v = addSimpleType(id, ID.TypeVar)
-				// if !tryUnify(id, seenT, v) {
-				// 	return
-				// }
+				ctx.seenIdentifierTypes[string(name)] = v
 			}
 			ctx.evaluationStack.Push(v)
+		// literals are untyped constants, their type is inferred from the context
 		case ID.NodeIntLiteral:
-			v := addSimpleType(id, ID.TypeVar)
-			t := addSimpleType(ID.NodeInvalid, ID.TypeInt)
-			if !tryUnify(id, t, v) {
-				return
-			}
+			v := addConstrainedType(id, T.ClassUntypedInt)
 			ctx.evaluationStack.Push(v)
 		case ID.NodeFloatLiteral:
+			v := addConstrainedType(id, T.ClassUntypedFloat)
+			ctx.evaluationStack.Push(v)
+		case ID.NodeImaginaryLiteral:
+			v := addConstrainedType(id, T.ClassUntypedImaginary)
+			ctx.evaluationStack.Push(v)
+		case ID.NodeRuneLiteral:
+			// NOTE: unlike other constants rune is typed, it is a code point
 			v := addSimpleType(id, ID.TypeVar)
-			t := addSimpleType(ID.NodeInvalid, ID.TypeFloat)
-			if !tryUnify(id, t, v) {
-				return
-			}
+			t := addSimpleType(ID.NodeInvalid, ID.TypeInt32)
+			tryUnify(id, t, v)
+			ctx.evaluationStack.Push(v)
+		case ID.NodeStringLiteral:
+			v := addSimpleType(id, ID.TypeVar)
+			t := addSimpleType(ID.NodeInvalid, ID.TypeString)
+			tryUnify(id, t, v)
 			ctx.evaluationStack.Push(v)
 		case ID.NodeBoolLiteral:
 			v := addSimpleType(id, ID.TypeVar)
 			t := addSimpleType(ID.NodeInvalid, ID.TypeBool)
-			if !tryUnify(id, t, v) {
-				return
-			}
+			tryUnify(id, t, v)
 			ctx.evaluationStack.Push(v)
 		case ID.NodeExpression:
 			exprT := addSimpleType(id, ID.TypeVar)
@@ -330,6 +937,25 @@ func TypeCheckPass(scopeCheckResult ScopeCheckResult, src *s.Source, ast *a.AST,
 		}
 	}
 
+	functions := u.NewStack[ID.Node]()
+	ast.TraversePreorder(
+		func(ast *a.AST, id ID.Node) (shouldStop bool) {
+			switch ast.GetNode(id).Tag() {
+			case ID.NodeFunctionDecl, ID.NodeFunctionLit:
+				functions.Push(id)
+			case ID.NodeReturnStmt:
+				ctx.returnOwners[id], _ = functions.Top()
+			}
+			return
+		},
+		func(ast *a.AST, id ID.Node) (shouldStop bool) {
+			switch ast.GetNode(id).Tag() {
+			case ID.NodeFunctionDecl, ID.NodeFunctionLit:
+				functions.Pop()
+			}
+			return
+		})
+
 	ast.TraversePostorder(onEnter, onExit)
 	return ctx.result(ast)
 }
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"regexp"
 	a "some/ast"
+	"some/corpus"
+	ID "some/domain"
 	s "some/syntax"
 	u "some/util"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"golang.org/x/exp/utf8string"
 )
@@ -214,7 +217,7 @@ func TestFunctionTypecheck(t *testing.T) {
 	`
 	patterns := []string{
 		"unary.*`\\(FN int int \\)`",
-		"some.*`\\(FN \\(FN int int \\) bool bool \\)`",
+		"some.*`\\(FN \\(FN int int \\) bool bool int \\)`",
 		"main.*`\\(FN int \\)`",
 	}
 	for _, p := range patterns {
@@ -224,3 +227,663 @@ func TestFunctionTypecheck(t *testing.T) {
 		}
 	}
 }
+
+func TestTypecheckInfiniteType(t *testing.T) {
+	codes := []string{`
+		fn f(x) {
+			return x(x)
+		}
+
+		fn main() {
+			return 0
+		}
+	`, `
+		fn g(x) {
+			var y = x
+			y = x(y)
+			return y
+		}
+
+		fn main() {
+			return 0
+		}
+	`}
+	for _, code := range codes {
+		c := newCompiler(code)
+		if err := c.tokenize(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.parse(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.scopecheck(); err != nil {
+			t.Fatal(err)
+		}
+		err := c.typecheck()
+		if err == nil {
+			fmt.Println(u.FormatSExpr(c.tAst.Dump()))
+			t.Fatalf("Expected fail on the occurs check")
+		}
+		if !strings.Contains(err.Error(), "Infinite type") {
+			t.Errorf("Expected infinite type error, got %s", err)
+		}
+		// types must stay acyclic, so dump terminates
+		_ = c.tAst.Dump()
+	}
+}
+
+func TestOperatorConstraints(t *testing.T) {
+	failing := []string{
+		`const a = true + true`,
+		`const a = "a" * "b"`,
+		`const a = "a" - "b"`,
+		`const a = true < false`,
+		`const a = -"a"`,
+	}
+	for _, stmt := range failing {
+		c := newCompiler("\nfn main() {\n" + stmt + "\nreturn 0\n}\n")
+		if err := c.tokenize(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.parse(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.scopecheck(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.typecheck(); err == nil {
+			fmt.Println(u.FormatSExpr(c.tAst.Dump()))
+			t.Errorf("Expected fail on the typecheck of %s", stmt)
+		}
+	}
+
+	code := `
+		fn main() {
+			const s = "a"
+			const a = s + s
+			const b = 1.5 * 2.0
+			const c = s < s
+			const d = -1.5
+			const e = true == false
+			return 0
+		}
+	`
+	patterns := []string{"a.*`string`", "b.*`float`", "c.*`bool`", "d.*`float`", "e.*`bool`"}
+	for _, p := range patterns {
+		if e := runTypecheck(code, p); e != nil {
+			t.Error(e)
+			break
+		}
+	}
+}
+
+func TestConstrainedDefaulting(t *testing.T) {
+	code := `
+		fn add(a, b) {
+			return a + b
+		}
+
+		fn main() {
+			const f = add
+			return 0
+		}
+	`
+	pattern := "f.*`\\(FN int int int \\)`"
+	if e := runTypecheck(code, pattern); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestSizedTypes(t *testing.T) {
+	code := `
+		fn main() {
+			const a = int32(5)
+			const b = a + 1
+			const c = uint8(b) * 2
+			const d = float32(c) + 0.5
+			const e = 2 * 0.5
+			return 0
+		}
+	`
+	patterns := []string{"b.*`int32`", "c.*`uint8`", "d.*`float32`", "e.*`float`"}
+	for _, p := range patterns {
+		if e := runTypecheck(code, p); e != nil {
+			t.Error(e)
+			break
+		}
+	}
+
+	failing := []string{
+		"const a = int32(1)\nconst b = int64(2)\nconst c = a + b",
+		"const a = int8(1)\nconst b = a + 1.5",
+		"const a = int32(true)",
+	}
+	for _, stmts := range failing {
+		c := newCompiler("\nfn main() {\n" + stmts + "\nreturn 0\n}\n")
+		if err := c.tokenize(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.parse(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.scopecheck(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.typecheck(); err == nil {
+			fmt.Println(u.FormatSExpr(c.tAst.Dump()))
+			t.Errorf("Expected fail on the typecheck of %s", stmts)
+		}
+	}
+}
+
+func TestConversions(t *testing.T) {
+	code := `
+		fn main() {
+			const i = 3
+			const f = float(i)
+			const n = int(2.5)
+			const s = string(65)
+			const b = bool(true)
+			return 0
+		}
+	`
+	patterns := []string{"f.*`float`", "n.*`int`", "s.*`string`", "b.*`bool`"}
+	for _, p := range patterns {
+		if e := runTypecheck(code, p); e != nil {
+			t.Error(e)
+			break
+		}
+	}
+
+	failing := map[string]string{
+		`const a = int("a")`:    "Can't convert string to int",
+		`const a = bool(1)`:     "Can't convert untyped int to bool",
+		`const a = float(true)`: "Can't convert bool to float",
+		`const a = string(1.5)`: "Can't convert untyped float to string",
+		`const a = int(1, 2)`:   "Conversion to int takes exactly one argument, got 2",
+		`const a = int32`:       "Type int32 can only be called for conversion",
+	}
+	for stmt, message := range failing {
+		c := newCompiler("\nfn main() {\n" + stmt + "\nreturn 0\n}\n")
+		if err := c.tokenize(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.parse(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.scopecheck(); err != nil {
+			t.Fatal(err)
+		}
+		err := c.typecheck()
+		if err == nil {
+			fmt.Println(u.FormatSExpr(c.tAst.Dump()))
+			t.Errorf("Expected fail on the typecheck of %s", stmt)
+			continue
+		}
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q for %s, got %s", message, stmt, err)
+		}
+	}
+}
+
+func TestMultipleReturnTypecheck(t *testing.T) {
+	code := `
+		fn divmod(a, b) {
+			return a / b, a - a / b * b
+		}
+
+		fn main() {
+			q, r := divmod(17, 5)
+			var x, y = 1.5, 2.5
+			x, y = divmod(x, x)
+			return q
+		}
+	`
+	patterns := []string{
+		"divmod.*`\\(FN int int \\(TUPLE int int \\) \\)`",
+		"divmod.*`\\(FN float float \\(TUPLE float float \\) \\)`",
+		"r.*`int`",
+	}
+	for _, p := range patterns {
+		if e := runTypecheck(code, p); e != nil {
+			t.Error(e)
+			break
+		}
+	}
+}
+
+func TestMultipleReturnArity(t *testing.T) {
+	failing := []string{
+		"var a, b = 1, 2, 3",
+		"const a, b = 1",
+		"const a, b, c = pair()",
+		"a, b := 1",
+	}
+	for _, stmts := range failing {
+		c := newCompiler("\nfn pair() {\nreturn 1, 2\n}\nfn main() {\n" + stmts + "\nreturn 0\n}\n")
+		if err := c.tokenize(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.parse(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.scopecheck(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.typecheck(); err == nil {
+			fmt.Println(u.FormatSExpr(c.tAst.Dump()))
+			t.Errorf("Expected fail on the typecheck of %s", stmts)
+		}
+	}
+}
+
+func TestReturnArity(t *testing.T) {
+	code := "fn pair(a) {\n\tif a {\n\t\treturn 1, 2\n\t}\n\treturn 3\n}\nfn main() {\n\treturn 0\n}\n"
+	c := newCompiler(code)
+	if err := c.tokenize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.scopecheck(); err != nil {
+		t.Fatal(err)
+	}
+	c.typecheck()
+	errs := c.handler.Errors()
+	if len(errs) != 1 || errs[0].Code() != u.ES_ReturnMismatch {
+		t.Fatalf("Expected return mismatch only, got %s", strings.Join(c.handler.AllErrors(), ""))
+	}
+	if line, col, _ := errs[0].Position(); line != 5 || col != 1 {
+		t.Errorf("Expected return mismatch at 5:1, got %d:%d", line, col)
+	}
+	if message := errs[0].Message(); !strings.Contains(message, "1 values but function returns 2") {
+		t.Errorf("Return mismatch message malformed: %s", message)
+	}
+
+	// single call returns every value of the tuple
+	code = `
+		fn pair() {
+			return 1, 2
+		}
+
+		fn same(a) {
+			if a {
+				return pair()
+			}
+			return 3, 4
+		}
+
+		fn main() {
+			x, y := same(true)
+			return x + y
+		}
+	`
+	if e := runTypecheck(code, "same.*`\\(FN bool \\(TUPLE int int \\) \\)`"); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestFunctionLitTypecheck(t *testing.T) {
+	code := `
+		fn main() {
+			const k = 2.5
+			const scale = fn(x) {
+				if x < 0.0 {
+					return 0.0
+				}
+				return x * k
+			}
+			const is = fn(s) { return s == "yes" }
+			return 0
+		}
+	`
+	patterns := []string{
+		"scale.*`\\(FN float float \\)`",
+		"is.*`\\(FN string bool \\)`",
+	}
+	for _, p := range patterns {
+		if e := runTypecheck(code, p); e != nil {
+			t.Error(e)
+			break
+		}
+	}
+}
+
+func TestOptionalTypecheck(t *testing.T) {
+	code := `
+		fn find(ok) {
+			if ok {
+				return ?42
+			}
+			return none
+		}
+
+		fn parse(s) {
+			if s == "" {
+				return 0, error(s)
+			}
+			return 1, none
+		}
+
+		fn main() {
+			const found = find(true)
+			if v, ok := found {
+				const copy = v
+			}
+			n, err := parse("1")
+			if err != none {
+				return 0
+			}
+			const message = string(err)
+			return n
+		}
+	`
+	patterns := []string{
+		"find.*`\\(FN bool \\(\\? int\\) \\)`",
+		"parse.*`\\(FN string \\(TUPLE int error \\) \\)`",
+		"copy.*`int`",
+		"ok.*`bool`",
+		"message.*`string`",
+	}
+	for _, p := range patterns {
+		if e := runTypecheck(code, p); e != nil {
+			t.Error(e)
+			break
+		}
+	}
+}
+
+func TestOptionalTypecheckFail(t *testing.T) {
+	failing := []string{
+		"const a = none + 1",
+		"const a = ?1 == ?1",
+		"const a = 1\nif v, ok := a {\n}",
+		"if v, ok, x := ?1 {\n}",
+		"const e = error(1)",
+		"const a = ?1\nconst b = a + 1",
+	}
+	for _, stmts := range failing {
+		c := newCompiler("\nfn main() {\n" + stmts + "\nreturn 0\n}\n")
+		if err := c.tokenize(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.parse(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.scopecheck(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.typecheck(); err == nil {
+			fmt.Println(u.FormatSExpr(c.tAst.Dump()))
+			t.Errorf("Expected fail on the typecheck of %s", stmts)
+		}
+	}
+}
+
+func TestUnionTypecheck(t *testing.T) {
+	code := `
+		type Shape union {
+			Circle float
+			Square int
+			Empty
+		}
+
+		fn area(s) {
+			match s {
+				Circle(r) => return r * r
+				Square(a) => return float(a * a)
+				Empty => return 0.0
+			}
+			return 0.0
+		}
+
+		fn main() {
+			const total = area(Circle(1.5)) + area(Empty)
+			return 0
+		}
+	`
+	patterns := []string{
+		"area.*`\\(FN Shape float \\)`",
+		"\\(r:.*`float`",
+		"\\(a:.*`int`",
+		"total.*`float`",
+	}
+	for _, p := range patterns {
+		if e := runTypecheck(code, p); e != nil {
+			t.Error(e)
+			break
+		}
+	}
+}
+
+func TestUnionTypecheckFail(t *testing.T) {
+	failing := map[string]string{
+		"match s {\nCircle(r) => return 0\n}": "missing variants: Square, Empty",
+		"match s {\nCircle(r) => return 0\nCircle(x) => return 1\nSquare(a) => return 2\nEmpty => return 3\n}": "Circle is matched more than once",
+		"match 1 {\nEmpty => return 0\n}":                                            "Shape",
+		"const c = Circle(1)\nconst x = c + 1":                                       "",
+		"match s {\nCircle => return 0\nSquare(a) => return 1\nEmpty => return 2\n}": "",
+	}
+	for stmts, expected := range failing {
+		c := newCompiler("\ntype Shape union {\nCircle float\nSquare int\nEmpty\n}\nfn main() {\nconst s = Empty\n" + stmts + "\nreturn 0\n}\n")
+		if err := c.tokenize(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.parse(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.scopecheck(); err != nil {
+			t.Fatal(err)
+		}
+		err := c.typecheck()
+		if err == nil {
+			fmt.Println(u.FormatSExpr(c.tAst.Dump()))
+			t.Errorf("Expected fail on the typecheck of %s", stmts)
+		} else if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %s in %s", expected, err)
+		}
+	}
+}
+
+func TestEnumTypecheck(t *testing.T) {
+	code := `
+		type Color enum { Red, Green, Blue }
+
+		fn next(c) {
+			match c {
+				Red => return Green
+				Green => return Blue
+				Blue => return Red
+			}
+			return c
+		}
+
+		fn main() {
+			const c = next(Red)
+			const same = c == Blue
+			const index = int(c)
+			const name = string(c)
+			return 0
+		}
+	`
+	patterns := []string{
+		"next.*`\\(FN Color Color \\)`",
+		"same.*`bool`",
+		"index.*`int`",
+		"name.*`string`",
+	}
+	for _, p := range patterns {
+		if e := runTypecheck(code, p); e != nil {
+			t.Error(e)
+			break
+		}
+	}
+}
+
+func TestEnumTypecheckFail(t *testing.T) {
+	failing := map[string]string{
+		"match c {\nRed => return 0\n}":                       "missing variants: Green, Blue",
+		"match c {\nRed(x) => return 0\nGreen => return 1\n}": "",
+		"const x = c + 1":                                     "",
+		"const x = c == 1":                                    "",
+		"const x = c < Red":                                   "",
+		"match c {\nRed => return 0\nGreen => return 1\nBlue => return 2\nRed => return 3\n}": "Red is matched more than once",
+	}
+	for stmts, expected := range failing {
+		c := newCompiler("\ntype Color enum { Red, Green, Blue }\nfn main() {\nconst c = Green\n" + stmts + "\nreturn 0\n}\n")
+		if err := c.tokenize(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.parse(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.scopecheck(); err != nil {
+			t.Fatal(err)
+		}
+		err := c.typecheck()
+		if err == nil {
+			fmt.Println(u.FormatSExpr(c.tAst.Dump()))
+			t.Errorf("Expected fail on the typecheck of %s", stmts)
+		} else if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %s in %s", expected, err)
+		}
+	}
+}
+
+func TestRuneAndComplexTypecheck(t *testing.T) {
+	code := `
+		fn main() {
+			const r = 'a'
+			const next = r + 1
+			const code = rune(233) + 'é'
+			const z = 1.5 + 2i
+			const squared = z * z
+			const same = squared == -4
+			const widened = complex(3)
+			return 0
+		}
+	`
+	patterns := []string{
+		"\\(r:.*`int32`",
+		"next.*`int32`",
+		"code.*`int32`",
+		"z.*`complex`",
+		"squared.*`complex`",
+		"same.*`bool`",
+		"widened.*`complex`",
+	}
+	for _, p := range patterns {
+		if e := runTypecheck(code, p); e != nil {
+			t.Error(e)
+			break
+		}
+	}
+}
+
+func TestRuneAndComplexTypecheckFail(t *testing.T) {
+	failing := []string{
+		"const x = 2i < 3i",
+		"const x = int(2i)",
+		"const x = 'a' + 1.5",
+		"const f = float64(1.5)\nconst y = f + 2i",
+	}
+	for _, stmts := range failing {
+		c := newCompiler("\nfn main() {\n" + stmts + "\nreturn 0\n}\n")
+		if err := c.tokenize(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.parse(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.scopecheck(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.typecheck(); err == nil {
+			fmt.Println(u.FormatSExpr(c.tAst.Dump()))
+			t.Errorf("Expected fail on the typecheck of %s", stmts)
+		}
+	}
+}
+
+func TestTypeVariableNaming(t *testing.T) {
+	code := `
+		fn id(x) {
+			return x
+		}
+
+		fn pair(x, y) {
+			return y
+		}
+
+		fn main() {
+			return id(1)
+		}
+	`
+	// names are shared by the whole dump, so later variables get later letters
+	patterns := []string{
+		"id.*`\\(FN a a \\)`",
+		"pair.*`\\(FN b c c \\)`",
+	}
+	for _, p := range patterns {
+		if e := runTypecheck(code, p); e != nil {
+			t.Error(e)
+		}
+	}
+
+	c := newCompiler(code)
+	if err := c.tokenize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.scopecheck(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.typecheck(); err != nil {
+		t.Fatal(err)
+	}
+	// but every type printed alone is named from the start
+	repo := c.tAst.GetTypeRepo()
+	for i := 0; i < c.ast.NodeCount(); i++ {
+		n := c.ast.GetNode(ID.Node(i))
+		if n.Tag() == ID.NodeIdentifier && a.Identifier_String(c.ast, ID.Node(i)) == "pair" {
+			if s := repo.GetString(c.tAst.GetNodeType(ID.Node(i))); s != "(FN a b b )" {
+				t.Errorf("Expected (FN a b b ) for pair, got %s", s)
+			}
+			break
+		}
+	}
+
+	expected := c.tAst.Dump()
+	if dump := c.tAst.Dump(); dump != expected {
+		t.Fatalf("Expected the same dump on repeated call, got\n%s\nand\n%s", expected, dump)
+	}
+	dumps := make(chan string)
+	for i := 0; i < 8; i++ {
+		go func() { dumps <- c.tAst.Dump() }()
+	}
+	for i := 0; i < 8; i++ {
+		if dump := <-dumps; dump != expected {
+			t.Errorf("Expected the same dump in goroutines, got\n%s\nand\n%s", expected, dump)
+		}
+	}
+}
+
+func FuzzTypecheck(f *testing.F) {
+	corpus.Seed(f)
+	f.Fuzz(func(t *testing.T, code string) {
+		if !utf8.ValidString(code) {
+			t.Skip()
+		}
+		c := newCompiler(code)
+		if c.tokenize() != nil || c.parse() != nil || c.scopecheck() != nil {
+			return
+		}
+		if c.typecheck() != nil {
+			return
+		}
+		c.tAst.Dump()
+	})
+}
@@ -1,6 +1,9 @@
 lexer grammar Some
 	;
 
+// comments are trivia, they are kept aside from the tokens
+channels { COMMENTS }
+
 /// *** LEXER ***
 
 /// KEYWORDS
@@ -12,6 +15,11 @@ KEYWORD
 	| 'if'
 	| 'break'
 	| 'return'
+	| 'defer'
+	| 'type'
+	| 'union'
+	| 'enum'
+	| 'match'
 	;
 
 /// OPERATORS
@@ -31,6 +39,7 @@ OTHER_OP
 	| '--'
 	| ':='
 	| '...'
+	| '=>'
 	;
 
 UNARY_OP
@@ -39,6 +48,7 @@ UNARY_OP
 	| '*'
 	| '&'
 	| '<-'
+	| '?'
 	;
 
 BINARY_OP
@@ -79,20 +89,26 @@ fragment MUL_OP
 
 INT_LIT
 	: DECIMAL_LIT
+	| BINARY_LIT
 	| OCTAL_LIT
 	| HEX_LIT
 	;
 
 fragment DECIMAL_LIT
-	: [1-9] DECIMAL_DIGIT*
+	: [1-9] ('_'? DECIMAL_DIGIT)*
+	;
+
+fragment BINARY_LIT
+	: '0' ('b' | 'B') '_'? BINARY_DIGIT ('_'? BINARY_DIGIT)*
 	;
 
 fragment OCTAL_LIT
-	: '0' OCTAL_DIGIT*
+	: '0' ('_'? OCTAL_DIGIT)*
+	| '0' ('o' | 'O') '_'? OCTAL_DIGIT ('_'? OCTAL_DIGIT)*
 	;
 
 fragment HEX_LIT
-	: '0' ('x' | 'X') HEX_DIGIT+
+	: '0' ('x' | 'X') '_'? HEX_DIGIT ('_'? HEX_DIGIT)*
 	;
 
 FLOAT_LIT
@@ -102,7 +118,7 @@ FLOAT_LIT
 	;
 
 fragment DECIMALS
-	: DECIMAL_DIGIT+
+	: DECIMAL_DIGIT ('_'? DECIMAL_DIGIT)*
 	;
 
 fragment EXPONENT
@@ -170,12 +186,13 @@ STRING_LIT
 	| INTERPRETED_STRING_LIT
 	;
 
+// quote ends the literal, so the literals on the same line are not merged
 fragment RAW_STRING_LIT
-	: '`' (UNICODE_CHAR | NEWLINE)* '`'
+	: '`' ~'`'* '`'
 	;
 
 fragment INTERPRETED_STRING_LIT
-	: '"' (UNICODE_VALUE | BYTE_VALUE)* '"'
+	: '"' (~["\\\u000A] | LITTLE_U_VALUE | BIG_U_VALUE | ESCAPED_CHAR | BYTE_VALUE)* '"'
 	;
 
 /// IDENTIFIERS
@@ -195,6 +212,10 @@ fragment DECIMAL_DIGIT
 	: [0-9]
 	;
 
+fragment BINARY_DIGIT
+	: [0-1]
+	;
+
 fragment OCTAL_DIGIT
 	: [0-7]
 	;
@@ -513,3 +534,7 @@ LINE_COMMENT
 	: '//' ~[\r\n]* [\r\n]
 	;
 
+BLOCK_COMMENT
+	: '/*' .*? '*/' -> channel(COMMENTS)
+	;
+
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"math"
 	ID "some/domain"
 	s "some/syntax"
 	T "some/typesystem"
@@ -21,16 +22,25 @@ var NodeConstructor = [...]func(ID.Token, ID.Node, ID.Node) Node{
 	ID.NodeBlock:  NewBlock,
 
 	ID.NodeFunctionDecl: NewFunctionDecl,
+	ID.NodeTypeDecl:     NewTypeDecl,
+	ID.NodeUnionType:    NewUnionType,
+	ID.NodeVariant:      NewVariant,
+	ID.NodeEnumType:     NewEnumType,
 	ID.NodeSignature:    NewSignature,
 	ID.NodeConstDecl:    NewConstDecl,
 	ID.NodeVarDecl:      NewVarDecl,
+	ID.NodeShortVarDecl: NewShortVarDecl,
 	ID.NodeAssignment:   NewAssignment,
 	ID.NodeReturnStmt:   NewReturnStmt,
 	ID.NodeIfStmt:       NewIfStmt,
+	ID.NodeDeferStmt:    NewDeferStmt,
+	ID.NodeMatch:        NewMatch,
+	ID.NodeMatchArm:     NewMatchArm,
 
-	ID.NodeExpression: NewExpression,
-	ID.NodeSelector:   NewSelector,
-	ID.NodeCall:       NewCall,
+	ID.NodeExpression:  NewExpression,
+	ID.NodeSelector:    NewSelector,
+	ID.NodeCall:        NewCall,
+	ID.NodeFunctionLit: NewFunctionLit,
 
 	ID.NodeOr:                NewOr,
 	ID.NodeAnd:               NewAnd,
@@ -48,12 +58,15 @@ var NodeConstructor = [...]func(ID.Token, ID.Node, ID.Node) Node{
 	ID.NodeUnaryPlus:  NewUnaryPlus,
 	ID.NodeUnaryMinus: NewUnaryMinus,
 	ID.NodeNot:        NewNot,
+	ID.NodeOptional:   NewOptional,
 
-	ID.NodeIntLiteral:    NewIntLiteral,
-	ID.NodeFloatLiteral:  NewFloatLiteral,
-	ID.NodeStringLiteral: NewStringLiteral,
-	ID.NodeBoolLiteral:   NewBoolLiteral,
-	ID.NodeIdentifier:    NewIdentifier,
+	ID.NodeIntLiteral:       NewIntLiteral,
+	ID.NodeFloatLiteral:     NewFloatLiteral,
+	ID.NodeImaginaryLiteral: NewImaginaryLiteral,
+	ID.NodeRuneLiteral:      NewRuneLiteral,
+	ID.NodeStringLiteral:    NewStringLiteral,
+	ID.NodeBoolLiteral:      NewBoolLiteral,
+	ID.NodeIdentifier:       NewIdentifier,
 
 	ID.NodeIdentifierList: NewIdentifierList,
 	ID.NodeExpressionList: NewExpressionList,
@@ -64,16 +77,25 @@ var NodeString = [...]func(AST, ID.Node) string{
 	ID.NodeBlock:  Block_String,
 
 	ID.NodeFunctionDecl: FunctionDecl_String,
+	ID.NodeTypeDecl:     TypeDecl_String,
+	ID.NodeUnionType:    UnionType_String,
+	ID.NodeVariant:      Variant_String,
+	ID.NodeEnumType:     EnumType_String,
 	ID.NodeSignature:    Signature_String,
 	ID.NodeConstDecl:    ConstDecl_String,
 	ID.NodeVarDecl:      VarDecl_String,
+	ID.NodeShortVarDecl: ShortVarDecl_String,
 	ID.NodeAssignment:   Assignment_String,
 	ID.NodeReturnStmt:   ReturnStmt_String,
 	ID.NodeIfStmt:       IfStmt_String,
+	ID.NodeDeferStmt:    DeferStmt_String,
+	ID.NodeMatch:        Match_String,
+	ID.NodeMatchArm:     MatchArm_String,
 
-	ID.NodeExpression: Expression_String,
-	ID.NodeSelector:   Selector_String,
-	ID.NodeCall:       Call_String,
+	ID.NodeExpression:  Expression_String,
+	ID.NodeSelector:    Selector_String,
+	ID.NodeCall:        Call_String,
+	ID.NodeFunctionLit: FunctionLit_String,
 
 	ID.NodeOr:                Or_String,
 	ID.NodeAnd:               And_String,
@@ -91,12 +113,15 @@ var NodeString = [...]func(AST, ID.Node) string{
 	ID.NodeUnaryPlus:  UnaryPlus_String,
 	ID.NodeUnaryMinus: UnaryMinus_String,
 	ID.NodeNot:        Not_String,
+	ID.NodeOptional:   Optional_String,
 
-	ID.NodeIntLiteral:    IntLiteral_String,
-	ID.NodeFloatLiteral:  FloatLiteral_String,
-	ID.NodeStringLiteral: StringLiteral_String,
-	ID.NodeBoolLiteral:   BoolLiteral_String,
-	ID.NodeIdentifier:    Identifier_String,
+	ID.NodeIntLiteral:       IntLiteral_String,
+	ID.NodeFloatLiteral:     FloatLiteral_String,
+	ID.NodeImaginaryLiteral: ImaginaryLiteral_String,
+	ID.NodeRuneLiteral:      RuneLiteral_String,
+	ID.NodeStringLiteral:    StringLiteral_String,
+	ID.NodeBoolLiteral:      BoolLiteral_String,
+	ID.NodeIdentifier:       Identifier_String,
 
 	ID.NodeIdentifierList: IdentifierList_String,
 	ID.NodeExpressionList: ExpressionList_String,
@@ -107,16 +132,25 @@ var NodeChildren = [...]func(AST, ID.Node) []ID.Node{
 	ID.NodeBlock:  Block_Children,
 
 	ID.NodeFunctionDecl: FunctionDecl_Children,
+	ID.NodeTypeDecl:     TypeDecl_Children,
+	ID.NodeUnionType:    UnionType_Children,
+	ID.NodeVariant:      Variant_Children,
+	ID.NodeEnumType:     EnumType_Children,
 	ID.NodeSignature:    Signature_Children,
 	ID.NodeConstDecl:    ConstDecl_Children,
 	ID.NodeVarDecl:      VarDecl_Children,
+	ID.NodeShortVarDecl: ShortVarDecl_Children,
 	ID.NodeAssignment:   Assignment_Children,
 	ID.NodeReturnStmt:   ReturnStmt_Children,
 	ID.NodeIfStmt:       IfStmt_Children,
+	ID.NodeDeferStmt:    DeferStmt_Children,
+	ID.NodeMatch:        Match_Children,
+	ID.NodeMatchArm:     MatchArm_Children,
 
-	ID.NodeExpression: Expression_Children,
-	ID.NodeSelector:   Selector_Children,
-	ID.NodeCall:       Call_Children,
+	ID.NodeExpression:  Expression_Children,
+	ID.NodeSelector:    Selector_Children,
+	ID.NodeCall:        Call_Children,
+	ID.NodeFunctionLit: FunctionLit_Children,
 
 	ID.NodeOr:                Or_Children,
 	ID.NodeAnd:               And_Children,
@@ -134,12 +168,15 @@ var NodeChildren = [...]func(AST, ID.Node) []ID.Node{
 	ID.NodeUnaryPlus:  UnaryPlus_Children,
 	ID.NodeUnaryMinus: UnaryMinus_Children,
 	ID.NodeNot:        Not_Children,
+	ID.NodeOptional:   Optional_Children,
 
-	ID.NodeIntLiteral:    IntLiteral_Children,
-	ID.NodeFloatLiteral:  FloatLiteral_Children,
-	ID.NodeStringLiteral: StringLiteral_Children,
-	ID.NodeBoolLiteral:   BoolLiteral_Children,
-	ID.NodeIdentifier:    Identifier_Children,
+	ID.NodeIntLiteral:       IntLiteral_Children,
+	ID.NodeFloatLiteral:     FloatLiteral_Children,
+	ID.NodeImaginaryLiteral: ImaginaryLiteral_Children,
+	ID.NodeRuneLiteral:      RuneLiteral_Children,
+	ID.NodeStringLiteral:    StringLiteral_Children,
+	ID.NodeBoolLiteral:      BoolLiteral_Children,
+	ID.NodeIdentifier:       Identifier_Children,
 
 	ID.NodeIdentifierList: IdentifierList_Children,
 	ID.NodeExpressionList: ExpressionList_Children,
@@ -252,6 +289,158 @@ func FunctionDecl_String(ast AST, i ID.Node) string {
 	return "FunctionDecl"
 }
 
+// Doc returns group of comments right before the function declaration
+func (ast AST) Doc(decl ID.Node) []s.Comment {
+	n := ast.nodes[decl]
+	if n.tag != ID.NodeFunctionDecl {
+		return nil
+	}
+	return ast.src.LeadComments(n.tokenIdx)
+}
+
+// DocText returns lines of the doc comment without comment markers
+func (ast AST) DocText(decl ID.Node) string {
+	lines := make([]string, 0, 4)
+	for _, c := range ast.Doc(decl) {
+		text := ast.src.CommentText(c)
+		if strings.HasPrefix(text, "//") {
+			lines = append(lines, strings.TrimPrefix(strings.TrimPrefix(text, "//"), " "))
+			continue
+		}
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+type TypeDecl struct {
+	Name ID.Node
+	Type ID.Node
+}
+
+func (ast AST) TypeDecl(n Node) TypeDecl {
+	return TypeDecl{
+		Name: n.lhs,
+		Type: n.rhs,
+	}
+}
+
+func NewTypeDecl(tokenIdx ID.Token, name ID.Node, typeNode ID.Node) Node {
+	return Node{
+		tag:      ID.NodeTypeDecl,
+		tokenIdx: tokenIdx,
+		lhs:      name,
+		rhs:      typeNode,
+	}
+}
+
+func TypeDecl_Children(ast AST, i ID.Node) []ID.Node {
+	n := ast.TypeDecl(ast.nodes[i])
+	return []ID.Node{n.Name, n.Type}
+}
+
+func TypeDecl_String(ast AST, i ID.Node) string {
+	return "TypeDecl"
+}
+
+type UnionType struct {
+	Variants []ID.Node
+}
+
+func (ast AST) UnionType(n Node) UnionType {
+	variants := make([]ID.Node, 0, 4)
+	for i := n.lhs; i < n.rhs; i++ {
+		variants = append(variants, ID.Node(ast.extra[i]))
+	}
+	return UnionType{
+		Variants: variants,
+	}
+}
+
+func NewUnionType(tokenIdx ID.Token, start ID.Node, end ID.Node) Node {
+	return Node{
+		tag:      ID.NodeUnionType,
+		tokenIdx: tokenIdx,
+		lhs:      start,
+		rhs:      end,
+	}
+}
+
+func UnionType_Children(ast AST, i ID.Node) []ID.Node {
+	n := ast.UnionType(ast.nodes[i])
+	return n.Variants
+}
+
+func UnionType_String(ast AST, i ID.Node) string {
+	return "Union"
+}
+
+// Variant of the union, payload is the name of the type or undefined
+type Variant struct {
+	Name    ID.Node
+	Payload ID.Node
+}
+
+func (ast AST) Variant(n Node) Variant {
+	return Variant{
+		Name:    n.lhs,
+		Payload: n.rhs,
+	}
+}
+
+func NewVariant(tokenIdx ID.Token, name ID.Node, payload ID.Node) Node {
+	return Node{
+		tag:      ID.NodeVariant,
+		tokenIdx: tokenIdx,
+		lhs:      name,
+		rhs:      payload,
+	}
+}
+
+func Variant_Children(ast AST, i ID.Node) []ID.Node {
+	n := ast.Variant(ast.nodes[i])
+	return []ID.Node{n.Name, n.Payload}
+}
+
+func Variant_String(ast AST, i ID.Node) string {
+	return "Variant"
+}
+
+// EnumType lists names of the members in the order of their values
+type EnumType struct {
+	Members []ID.Node
+}
+
+func (ast AST) EnumType(n Node) EnumType {
+	members := make([]ID.Node, 0, 4)
+	for i := n.lhs; i < n.rhs; i++ {
+		members = append(members, ID.Node(ast.extra[i]))
+	}
+	return EnumType{
+		Members: members,
+	}
+}
+
+func NewEnumType(tokenIdx ID.Token, start ID.Node, end ID.Node) Node {
+	return Node{
+		tag:      ID.NodeEnumType,
+		tokenIdx: tokenIdx,
+		lhs:      start,
+		rhs:      end,
+	}
+}
+
+func EnumType_Children(ast AST, i ID.Node) []ID.Node {
+	n := ast.EnumType(ast.nodes[i])
+	return n.Members
+}
+
+func EnumType_String(ast AST, i ID.Node) string {
+	return "Enum"
+}
+
 type Signature struct {
 	Parameters ID.Node
 }
@@ -373,6 +562,36 @@ func VarDecl_String(ast AST, i ID.Node) string {
 	return "VarDecl"
 }
 
+type ShortVarDecl struct {
+	IdentifierList ID.Node
+	ExpressionList ID.Node
+}
+
+func (ast AST) ShortVarDecl(n Node) ShortVarDecl {
+	return ShortVarDecl{
+		IdentifierList: n.lhs,
+		ExpressionList: n.rhs,
+	}
+}
+
+func NewShortVarDecl(tokenIdx ID.Token, identifierList ID.Node, expressionList ID.Node) Node {
+	return Node{
+		tag:      ID.NodeShortVarDecl,
+		tokenIdx: tokenIdx,
+		lhs:      identifierList,
+		rhs:      expressionList,
+	}
+}
+
+func ShortVarDecl_Children(ast AST, i ID.Node) []ID.Node {
+	n := ast.ShortVarDecl(ast.nodes[i])
+	return []ID.Node{n.IdentifierList, n.ExpressionList}
+}
+
+func ShortVarDecl_String(ast AST, i ID.Node) string {
+	return "ShortVarDecl"
+}
+
 type Assignment struct {
 	LhsList ID.Node
 	RhsList ID.Node
@@ -461,6 +680,101 @@ func IfStmt_String(ast AST, i ID.Node) string {
 	return "If"
 }
 
+type DeferStmt struct {
+	Expression ID.Node
+}
+
+func (ast AST) DeferStmt(n Node) DeferStmt {
+	return DeferStmt{
+		Expression: n.lhs,
+	}
+}
+
+func NewDeferStmt(tokenIdx ID.Token, expression ID.Node, rhs ID.Node) Node {
+	return Node{
+		tag:      ID.NodeDeferStmt,
+		tokenIdx: tokenIdx,
+		lhs:      expression,
+		rhs:      rhs,
+	}
+}
+
+func DeferStmt_Children(ast AST, i ID.Node) []ID.Node {
+	n := ast.DeferStmt(ast.nodes[i])
+	return []ID.Node{n.Expression}
+}
+
+func DeferStmt_String(ast AST, i ID.Node) string {
+	return "Defer"
+}
+
+type Match struct {
+	Expression ID.Node
+	Arms       []ID.Node
+}
+
+func (ast AST) Match(n Node) Match {
+	arms := make([]ID.Node, 0, 4)
+	for i := ast.extra[n.rhs]; i < ast.extra[n.rhs+1]; i++ {
+		arms = append(arms, ID.Node(ast.extra[i]))
+	}
+	return Match{
+		Expression: n.lhs,
+		Arms:       arms,
+	}
+}
+
+func NewMatch(tokenIdx ID.Token, expression ID.Node, arms ID.Node) Node {
+	return Node{
+		tag:      ID.NodeMatch,
+		tokenIdx: tokenIdx,
+		lhs:      expression,
+		rhs:      arms,
+	}
+}
+
+func Match_Children(ast AST, i ID.Node) []ID.Node {
+	n := ast.Match(ast.nodes[i])
+	return append([]ID.Node{n.Expression}, n.Arms...)
+}
+
+func Match_String(ast AST, i ID.Node) string {
+	return "Match"
+}
+
+// MatchArm binds payload of the variant, binding is undefined for variants without one
+type MatchArm struct {
+	Pattern ID.Node
+	Binding ID.Node
+	Body    ID.Node
+}
+
+func (ast AST) MatchArm(n Node) MatchArm {
+	return MatchArm{
+		Pattern: n.lhs,
+		Binding: ID.Node(ast.extra[n.rhs]),
+		Body:    ID.Node(ast.extra[n.rhs+1]),
+	}
+}
+
+func NewMatchArm(tokenIdx ID.Token, pattern ID.Node, extra ID.Node) Node {
+	return Node{
+		tag:      ID.NodeMatchArm,
+		tokenIdx: tokenIdx,
+		lhs:      pattern,
+		rhs:      extra,
+	}
+}
+
+func MatchArm_Children(ast AST, i ID.Node) []ID.Node {
+	n := ast.MatchArm(ast.nodes[i])
+	return []ID.Node{n.Pattern, n.Binding, n.Body}
+}
+
+func MatchArm_String(ast AST, i ID.Node) string {
+	return "Arm"
+}
+
 type Expression struct {
 	Expression ID.Node
 }
@@ -550,6 +864,36 @@ func Call_String(ast AST, i ID.Node) string {
 	return "Call"
 }
 
+type FunctionLit struct {
+	Signature ID.Node
+	Body      ID.Node
+}
+
+func (ast AST) FunctionLit(n Node) FunctionLit {
+	return FunctionLit{
+		Signature: n.lhs,
+		Body:      n.rhs,
+	}
+}
+
+func NewFunctionLit(tokenIdx ID.Token, signature ID.Node, body ID.Node) Node {
+	return Node{
+		tag:      ID.NodeFunctionLit,
+		tokenIdx: tokenIdx,
+		lhs:      signature,
+		rhs:      body,
+	}
+}
+
+func FunctionLit_Children(ast AST, i ID.Node) []ID.Node {
+	n := ast.FunctionLit(ast.nodes[i])
+	return []ID.Node{n.Signature, n.Body}
+}
+
+func FunctionLit_String(ast AST, i ID.Node) string {
+	return "FunctionLit"
+}
+
 type Or struct {
 	Lhs ID.Node
 	Rhs ID.Node
@@ -1008,6 +1352,34 @@ func Not_String(ast AST, i ID.Node) string {
 	return "!"
 }
 
+type Optional struct {
+	Unary ID.Node
+}
+
+func (ast AST) Optional(n Node) Optional {
+	return Optional{
+		Unary: n.lhs,
+	}
+}
+func NewOptional(tokenIdx ID.Token, lhs ID.Node, rhs ID.Node) Node {
+	return Node{
+		tag:      ID.NodeOptional,
+		tokenIdx: tokenIdx,
+		lhs:      lhs,
+		rhs:      rhs,
+	}
+
+}
+
+func Optional_Children(ast AST, i ID.Node) []ID.Node {
+	n := ast.Optional(ast.nodes[i])
+	return []ID.Node{n.Unary}
+}
+
+func Optional_String(ast AST, i ID.Node) string {
+	return "?"
+}
+
 type IdentifierList struct {
 	Identifiers []ID.Node
 }
@@ -1075,13 +1447,18 @@ func ExpressionList_String(ast AST, i ID.Node) string {
 	return "Expr[]"
 }
 
+// NOTE: Decoded values of literals are stored in extra (bits of the value)
+// or in the string table, literal node refers to them by lhs
+
 type IntLiteral struct {
 	Token ID.Token
+	Value uint64
 }
 
 func (ast AST) IntLiteral(n Node) IntLiteral {
 	return IntLiteral{
 		Token: n.tokenIdx,
+		Value: uint64(ast.extra[n.lhs]),
 	}
 }
 func NewIntLiteral(tokenIdx ID.Token, lhs ID.Node, rhs ID.Node) Node {
@@ -1105,11 +1482,13 @@ func IntLiteral_String(ast AST, i ID.Node) string {
 
 type FloatLiteral struct {
 	Token ID.Token
+	Value float64
 }
 
 func (ast AST) FloatLiteral(n Node) FloatLiteral {
 	return FloatLiteral{
 		Token: n.tokenIdx,
+		Value: math.Float64frombits(uint64(ast.extra[n.lhs])),
 	}
 }
 func NewFloatLiteral(tokenIdx ID.Token, lhs ID.Node, rhs ID.Node) Node {
@@ -1131,13 +1510,78 @@ func FloatLiteral_String(ast AST, i ID.Node) string {
 	return ast.src.Lexeme(n.Token)
 }
 
+// ImaginaryLiteral stores value of the imaginary part
+type ImaginaryLiteral struct {
+	Token ID.Token
+	Value float64
+}
+
+func (ast AST) ImaginaryLiteral(n Node) ImaginaryLiteral {
+	return ImaginaryLiteral{
+		Token: n.tokenIdx,
+		Value: math.Float64frombits(uint64(ast.extra[n.lhs])),
+	}
+}
+
+func NewImaginaryLiteral(tokenIdx ID.Token, lhs ID.Node, rhs ID.Node) Node {
+	return Node{
+		tag:      ID.NodeImaginaryLiteral,
+		tokenIdx: tokenIdx,
+		lhs:      lhs,
+		rhs:      rhs,
+	}
+
+}
+
+func ImaginaryLiteral_Children(ast AST, i ID.Node) []ID.Node {
+	return []ID.Node{}
+}
+
+func ImaginaryLiteral_String(ast AST, i ID.Node) string {
+	n := ast.ImaginaryLiteral(ast.nodes[i])
+	return ast.src.Lexeme(n.Token)
+}
+
+type RuneLiteral struct {
+	Token ID.Token
+	Value rune
+}
+
+func (ast AST) RuneLiteral(n Node) RuneLiteral {
+	return RuneLiteral{
+		Token: n.tokenIdx,
+		Value: rune(ast.extra[n.lhs]),
+	}
+}
+
+func NewRuneLiteral(tokenIdx ID.Token, lhs ID.Node, rhs ID.Node) Node {
+	return Node{
+		tag:      ID.NodeRuneLiteral,
+		tokenIdx: tokenIdx,
+		lhs:      lhs,
+		rhs:      rhs,
+	}
+
+}
+
+func RuneLiteral_Children(ast AST, i ID.Node) []ID.Node {
+	return []ID.Node{}
+}
+
+func RuneLiteral_String(ast AST, i ID.Node) string {
+	n := ast.RuneLiteral(ast.nodes[i])
+	return ast.src.Lexeme(n.Token)
+}
+
 type StringLiteral struct {
 	Token ID.Token
+	Value string
 }
 
 func (ast AST) StringLiteral(n Node) StringLiteral {
 	return StringLiteral{
 		Token: n.tokenIdx,
+		Value: ast.stringLits[n.lhs],
 	}
 }
 
@@ -1228,6 +1672,8 @@ type AST struct {
 	// latter is more plausable, bc it's more versatile and basically superset
 	// of my implementation. Well, will stick to current implemenation...
 	extra []int
+	// decoded string literals
+	stringLits []string
 }
 
 func NewAST(src *s.Source) AST {
@@ -1250,6 +1696,11 @@ func (ast AST) SetNode(i ID.Node, n Node) {
 	ast.nodes[i] = n
 }
 
+func (ast *AST) AddString(s string) ID.Node {
+	ast.stringLits = append(ast.stringLits, s)
+	return ID.Node(len(ast.stringLits) - 1)
+}
+
 func (ast AST) GetNode(i ID.Node) Node {
 	return ast.nodes[i]
 }
@@ -1286,6 +1737,11 @@ func (ast *AST) traverseNodePreorder(onEnter NodeAction, onExit NodeAction, i ID
 	}
 }
 
+// TraverseSubtreePreorder is the same as TraversePreorder, but starts from node i
+func (ast *AST) TraverseSubtreePreorder(i ID.Node, onEnter NodeAction, onExit NodeAction) {
+	ast.traverseNodePreorder(onEnter, onExit, i)
+}
+
 func (ast *AST) TraversePostorder(onEnter NodeAction, onExit NodeAction) {
 	ast.traverseNodePostorder(onEnter, onExit, 0)
 }
@@ -1356,6 +1812,16 @@ func (ast TypedAST) GetNodeType(i ID.Node) ID.Type {
 	return ast.repo.NodeType(i)
 }
 
+func (ast TypedAST) GetTypeRepo() T.TypeRepo {
+	return ast.repo
+}
+
+// TypePrinter returns new printing context of the types of the AST,
+// type variables printed with it have the same names across the nodes
+func (ast TypedAST) TypePrinter() *T.TypePrinter {
+	return T.NewTypePrinter(ast.repo)
+}
+
 // NOTE: This operation is overloaded in a sense that it adds no additional behaviour, just
 // more information. Therefore, it is reasonable to make this not plain procedure,
 // but extention point (handler) for original plain AST
@@ -1363,6 +1829,7 @@ func (ast TypedAST) GetNodeType(i ID.Node) ID.Type {
 // how to do this succinctly is another story
 func (ast *TypedAST) Dump() string {
 	str := strings.Builder{}
+	printer := ast.TypePrinter()
 	onEnter := func(_ *AST, id ID.Node) (stopTraversal bool) {
 		str.WriteByte('(')
 
@@ -1371,7 +1838,7 @@ func (ast *TypedAST) Dump() string {
 		if found := ast.repo.NodeType(id); found != ID.TypeInvalid {
 			str.WriteByte(' ')
 			str.WriteByte('`')
-			str.WriteString(ast.repo.GetString(found))
+			str.WriteString(printer.String(found))
 			str.WriteByte('`')
 		}
 
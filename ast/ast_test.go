@@ -3,12 +3,14 @@ package ast
 import (
 	"errors"
 	"fmt"
+	"some/corpus"
 	ID "some/domain"
 	s "some/syntax"
 	u "some/util"
 	"strings"
 	"testing"
 	"text/tabwriter"
+	"unicode/utf8"
 
 	"golang.org/x/exp/utf8string"
 )
@@ -83,6 +85,53 @@ func runTest(lhs string, rhs string) error {
 	return nil
 }
 
+// NOTE: dumps of the parsed sources are golden files of testdata in the root,
+// here the nodes of the sources are only checked to be valid
+func TestTestdataNodesValid(t *testing.T) {
+	for _, source := range corpus.Sources(t) {
+		src := s.NewSource(source.Name, *utf8string.NewString(source.Code))
+		handler := u.NewHandler()
+		tokenizer := s.NewTokenizer(&handler)
+		tokenizer.Tokenize(&src)
+		if !handler.IsEmpty() {
+			continue
+		}
+		parser := NewParser(&handler)
+		ast := parser.Parse(&src)
+		if !handler.IsEmpty() {
+			continue
+		}
+		if node, index, ok := isASTValid(ast.nodes); !ok {
+			t.Errorf("%s: AST nodes failed on validity test at %d => %v", source.Name, index, node)
+		}
+	}
+}
+
+// NOTE: parser either builds valid AST or reports errors, it never panics
+func FuzzParse(f *testing.F) {
+	corpus.Seed(f)
+	f.Fuzz(func(t *testing.T, code string) {
+		if !utf8.ValidString(code) {
+			t.Skip()
+		}
+		src := s.NewSource("fuzz", *utf8string.NewString(code))
+		handler := u.NewHandler()
+		tokenizer := s.NewTokenizer(&handler)
+		tokenizer.Tokenize(&src)
+		if !handler.IsEmpty() {
+			return
+		}
+		parser := NewParser(&handler)
+		ast := parser.Parse(&src)
+		if !handler.IsEmpty() {
+			return
+		}
+		if node, index, ok := isASTValid(ast.nodes); !ok {
+			t.Errorf("AST nodes failed on validity test at %d => %v", index, node)
+		}
+	})
+}
+
 func TestErrorHandling(t *testing.T) {
 	lhs := `
 		fn main()
@@ -95,103 +144,180 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
-func TestParseFunctionDecl(t *testing.T) {
+func TestUnexpectedEOF(t *testing.T) {
+	sources := []string{"fn A(){", "fn A(){fn(){", "fn A(){defer", "fn main() {\n\tx := "}
+	for _, code := range sources {
+		if e := runTest(code, ``); e == nil {
+			t.Errorf("%q: Expected error", code)
+		}
+	}
+}
+
+func TestDeferStmt(t *testing.T) {
 	lhs := `
-		fn main()
-		fn some(a, b) // some function
-	`
-	rhs := `
-		(Source
-			(FunctionDecl (main)
-				(Signature (ID[])))
-			(FunctionDecl (some)
-				(Signature (ID[] (a) (b))
-				)))
+		fn main() {
+			defer x + 1
+		}
 	`
-	if e := runTest(lhs, rhs); e != nil {
-		t.Error(e)
+	e := runTest(lhs, "")
+	if e == nil || !strings.Contains(e.Error(), "must be function call") {
+		t.Errorf("Expected error for defer of non call, got %v", e)
 	}
 }
 
-func TestParseConstDecl(t *testing.T) {
+func TestMatchArmsOnOneLine(t *testing.T) {
 	lhs := `
-		fn main() {
-			const _ = null
-			const a, b = 8, 2
-			const c, d, e = 8 * 3, -16, "E"
+		fn area(s) {
+			match s { Circle(r) => return r, Empty => return 0 }
 		}
 	`
 	rhs := `
 	(Source
-		(FunctionDecl (main) 
-			(Signature (ID[]))
-			(Block 
-				(ConstDecl 
-					(ID[] (_)) 
-					(Expr[] (Expr (null)
-				)))
-				(ConstDecl 
-					(ID[] (a) (b)) 
-					(Expr[] (Expr (8)) (Expr (2))
-				))
-				(ConstDecl 
-					(ID[] (c) (d) (e))
-					(Expr[] 
-						(Expr (* (8) (3)))
-						(Expr (- (16)))
-						(Expr ("E"))
-				))
-	)))`
+		(FunctionDecl
+			(area)
+			(Signature
+				(ID[]
+					(s)))
+			(Block
+				(Match
+					(Expr
+						(s))
+					(Arm
+						(Expr
+							(Circle))
+						(r)
+						(Block
+							(Return
+								(Expr[]
+									(Expr
+										(r))))))
+					(Arm
+						(Expr
+							(Empty))
+						(Block
+							(Return
+								(Expr[]
+									(Expr
+										(0))))))))))
+	`
 	if e := runTest(lhs, rhs); e != nil {
 		t.Error(e)
 	}
 }
 
-func TestParseSomeExpressions(t *testing.T) {
+func TestLiteralDecoding(t *testing.T) {
+	ints := map[string]uint64{
+		"42":                   42,
+		"0":                    0,
+		"017":                  15,
+		"0o17":                 15,
+		"0x_FF":                255,
+		"0b1010":               10,
+		"1_000_000":            1000000,
+		"18446744073709551615": 18446744073709551615,
+	}
+	for lexeme, expected := range ints {
+		if value, err := DecodeInt(lexeme); err != nil || value != expected {
+			t.Errorf("Expected %s to be %d, got %d (%v)", lexeme, expected, value, err)
+		}
+	}
+	floats := map[string]float64{
+		"1.5":     1.5,
+		".25":     0.25,
+		"1e3":     1000,
+		"1_0.5e1": 105,
+	}
+	for lexeme, expected := range floats {
+		if value, err := DecodeFloat(lexeme); err != nil || value != expected {
+			t.Errorf("Expected %s to be %g, got %g (%v)", lexeme, expected, value, err)
+		}
+	}
+	runes := map[string]rune{
+		`'a'`:          'a',
+		`'\n'`:         '\n',
+		`'\''`:         '\'',
+		`'\x41'`:       'A',
+		`'\101'`:       'A',
+		`'\u00e9'`:     'é',
+		`'\U0001F600'`: 0x1F600,
+	}
+	for lexeme, expected := range runes {
+		if value, err := DecodeRune(lexeme); err != nil || value != expected {
+			t.Errorf("Expected %s to be %d, got %d (%v)", lexeme, expected, value, err)
+		}
+	}
+	strs := map[string]string{
+		`"a\tb"`:       "a\tb",
+		`"\u00e9\x41"`: "éA",
+		"`raw\\n`":     "raw\\n",
+	}
+	for lexeme, expected := range strs {
+		if value, err := DecodeString(lexeme); err != nil || value != expected {
+			t.Errorf("Expected %s to be %q, got %q (%v)", lexeme, expected, value, err)
+		}
+	}
+	if value, err := DecodeImaginary("0123i"); err != nil || value != 123 {
+		t.Errorf("Expected decimal imaginary part 123, got %g (%v)", value, err)
+	}
+}
+
+func TestLiteralOverflow(t *testing.T) {
 	lhs := `
 		fn main() {
-			const x = 8
-			x * 8 + 3
-			x + 3 / 4
-			f(x, x.y)
-			x, x.y = x.y, x
+			const x = 129389512754912957199521
 		}
 	`
-	rhs := `
-	(Source
-		(FunctionDecl (main)
-			(Signature (ID[]))
-			(Block 
-				(ConstDecl (ID[] (x)) (Expr[] (Expr (8))))
-				(Expr (+ (* (x) (8)) (3)))
-				(Expr (+ (x) (/ (3) (4))))
-				(Expr (Call (f) 
-					(Expr[] (Expr (x)) (Expr (Get (x) (y))))))
-				(Assign
-					(Expr[] (Expr (x)) (Expr (Get (x) (y))))
-					(Expr[] (Expr (Get (x) (y))) (Expr (x))))
-				
-	)))`
-	if e := runTest(lhs, rhs); e != nil {
-		t.Error(e)
+	e := runTest(lhs, "")
+	if e == nil || !strings.Contains(e.Error(), "Invalid literal 129389512754912957199521: value out of range") {
+		t.Errorf("Expected literal overflow, got %v", e)
 	}
 }
 
-func TestReturnStmt(t *testing.T) {
-	lhs := `
+func TestDocComments(t *testing.T) {
+	code := `
+		// Add returns sum
+		// of both arguments
+		fn add(a, b) {
+			return a + b // not a doc
+		}
+		fn sub(a, b) {
+			return a - b
+		}
+
+		/*
+			Main is documented
+			with block comment
+		*/
 		fn main() {
-			return 0
+		}
+
+		// detached comment
+
+		fn none() {
 		}
 	`
-	rhs := `
-	(Source
-		(FunctionDecl (main)
-			(Signature (ID[]))
-			(Block 
-				(Return (Expr[] (Expr (0)
-	))))))`
-	if e := runTest(lhs, rhs); e != nil {
-		t.Error(e)
+	text := utf8string.NewString(code)
+	src := s.NewSource("ast_test", *text)
+	handler := u.NewHandler()
+	tokenizer := s.NewTokenizer(&handler)
+	tokenizer.Tokenize(&src)
+	parser := NewParser(&handler)
+	ast := parser.Parse(&src)
+	if !handler.IsEmpty() {
+		t.Fatal(strings.Join(handler.AllErrors(), ""))
+	}
+
+	expected := map[string]string{
+		"add":  "Add returns sum\nof both arguments",
+		"sub":  "",
+		"main": "Main is documented\nwith block comment",
+		"none": "",
+	}
+	for _, decl := range ast.SourceRoot(ast.GetNode(0)).Declarations {
+		name := Identifier_String(ast, ast.FunctionDecl(ast.GetNode(decl)).Name)
+		if doc := ast.DocText(decl); doc != expected[name] {
+			t.Errorf("Expected doc of %s to be %q, got %q", name, expected[name], doc)
+		}
 	}
 }
 
@@ -0,0 +1,59 @@
+package ast
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// NOTE: Literals are decoded the way Go decodes them, so strconv does
+// the heavy lifting: prefixes (0b, 0o, 0x and legacy octal), separators
+// and escape sequences. Whether the value fits its type is decided
+// after the type inference
+
+// DecodeInt returns value of the integer literal, it fails if the value
+// doesn't fit into 64 bits
+func DecodeInt(lexeme string) (uint64, error) {
+	value, err := strconv.ParseUint(lexeme, 0, 64)
+	return value, literalError(err)
+}
+
+// DecodeFloat returns value of the decimal or hexadecimal float literal
+func DecodeFloat(lexeme string) (float64, error) {
+	value, err := strconv.ParseFloat(lexeme, 64)
+	return value, literalError(err)
+}
+
+// DecodeImaginary returns value of the imaginary part, decimal integer
+// before the suffix is never octal
+func DecodeImaginary(lexeme string) (float64, error) {
+	return DecodeFloat(strings.TrimSuffix(lexeme, "i"))
+}
+
+// DecodeRune returns code point of the rune literal
+func DecodeRune(lexeme string) (rune, error) {
+	if len(lexeme) < 3 {
+		return 0, errors.New("invalid syntax")
+	}
+	value, _, tail, err := strconv.UnquoteChar(lexeme[1:len(lexeme)-1], '\'')
+	if err == nil && tail != "" {
+		return 0, errors.New("more than one character")
+	}
+	return value, literalError(err)
+}
+
+// DecodeString returns contents of the interpreted or raw string literal
+func DecodeString(lexeme string) (string, error) {
+	value, err := strconv.Unquote(lexeme)
+	return value, literalError(err)
+}
+
+// literalError drops the function name and the input from the strconv error,
+// lexeme is already reported by the caller
+func literalError(err error) error {
+	var numError *strconv.NumError
+	if errors.As(err, &numError) {
+		return numError.Err
+	}
+	return err
+}
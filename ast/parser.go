@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"math"
 	ID "some/domain"
 	s "some/syntax"
 	u "some/util"
@@ -11,50 +12,72 @@ const (
 	precHighest = 7
 )
 
+type binaryOperator struct {
+	lexeme     string
+	precedence int
+	tag        NodeTag
+}
+
+var binaryOperators = [...]binaryOperator{
+	{"||", 1, ID.NodeOr},
+	{"&&", 2, ID.NodeAnd},
+	{"==", 3, ID.NodeEquals},
+	{"!=", 3, ID.NodeNotEquals},
+	{">", 3, ID.NodeGreaterThan},
+	{"<", 3, ID.NodeLessThan},
+	{">=", 3, ID.NodeGreaterThanEquals},
+	{"<=", 3, ID.NodeLessThanEquals},
+	{"+", 4, ID.NodeBinaryPlus},
+	{"-", 4, ID.NodeBinaryMinus},
+	{"*", 5, ID.NodeMultiply},
+	{"/", 5, ID.NodeDivide},
+}
+
 func binaryPrecedenceAndTag(src *s.Source, i ID.Token) (int, NodeTag) {
 	lexeme := src.Lexeme(i)
-	switch lexeme {
-	case "||":
-		return 1, ID.NodeOr
-	case "&&":
-		return 2, ID.NodeAnd
-	case "==":
-		return 3, ID.NodeEquals
-	case "!=":
-		return 3, ID.NodeNotEquals
-	case ">":
-		return 3, ID.NodeGreaterThan
-	case "<":
-		return 3, ID.NodeLessThan
-	case ">=":
-		return 3, ID.NodeGreaterThanEquals
-	case "<=":
-		return 3, ID.NodeLessThanEquals
-	case "+":
-		return 4, ID.NodeBinaryPlus
-	case "-":
-		return 4, ID.NodeBinaryMinus
-	case "*":
-		return 5, ID.NodeMultiply
-	case "/":
-		return 5, ID.NodeDivide
+	for _, op := range binaryOperators {
+		if op.lexeme == lexeme {
+			return op.precedence, op.tag
+		}
 	}
 	return precLowest, ID.NodeUndefined
 }
 
+// BinaryOperator returns lexeme and precedence of the binary operator node,
+// all binary operators are left associative
+func BinaryOperator(tag NodeTag) (lexeme string, precedence int, ok bool) {
+	for _, op := range binaryOperators {
+		if op.tag == tag {
+			return op.lexeme, op.precedence, true
+		}
+	}
+	return "", precLowest, false
+}
+
+var unaryOperators = map[string]NodeTag{
+	"+": ID.NodeUnaryPlus,
+	"-": ID.NodeUnaryMinus,
+	"!": ID.NodeNot,
+	"?": ID.NodeOptional,
+}
+
 func unaryTag(src *s.Source, i ID.Token) NodeTag {
-	lexeme := src.Lexeme(i)
-	switch lexeme {
-	case "+":
-		return ID.NodeUnaryPlus
-	case "-":
-		return ID.NodeUnaryMinus
-	case "!":
-		return ID.NodeNot
+	if tag, ok := unaryOperators[src.Lexeme(i)]; ok {
+		return tag
 	}
 	return ID.NodeUndefined
 }
 
+// UnaryOperator returns lexeme of the unary operator node
+func UnaryOperator(tag NodeTag) (lexeme string, ok bool) {
+	for lexeme, t := range unaryOperators {
+		if t == tag {
+			return lexeme, true
+		}
+	}
+	return "", false
+}
+
 type parser struct {
 	ast     *AST
 	src     *s.Source
@@ -64,8 +87,9 @@ type parser struct {
 	line, col int
 	scratch   []int
 
-	saved ID.Token
 	atEOF bool
+	// parsing stops on the first error as if it is the end of the source
+	failed bool
 }
 
 func NewParser(handler *u.ErrorHandler) parser {
@@ -75,7 +99,6 @@ func NewParser(handler *u.ErrorHandler) parser {
 		line:    0,
 		col:     0,
 		scratch: make([]int, 0, 64),
-		saved:   ID.TokenInvalid,
 		atEOF:   false,
 	}
 
@@ -91,6 +114,11 @@ func (p *parser) Parse(src *s.Source) AST {
 
 func (p *parser) next() {
 	for {
+		if int(p.current)+1 >= p.src.TokenCount() {
+			// EOF is the last token, parser stays at it
+			p.atEOF = true
+			return
+		}
 		p.current++
 		c := p.src.Token(p.current)
 		p.line = c.Line
@@ -104,16 +132,17 @@ func (p *parser) next() {
 	}
 }
 
-func (p *parser) save() {
-	p.saved = p.current
+// save returns the position to roll back to, speculative parses may be nested
+func (p *parser) save() ID.Token {
+	return p.current
 }
 
-func (p *parser) rollback() {
-	p.current = p.saved
-	p.saved = -1
+func (p *parser) rollback(saved ID.Token) {
+	p.current = saved
 	c := p.src.Token(p.current)
 	p.line = c.Line
 	p.col = c.Col
+	p.atEOF = p.failed || c.Tag == ID.TokenEOF
 }
 
 func (p *parser) matchTag(tag ID.Token) bool {
@@ -140,6 +169,9 @@ func (p *parser) matchToken(tag ID.Token, lexeme string) bool {
 // NOTE: this should be much more complicated with respect to error reporting
 func (p *parser) expect(tag ID.Token, lexeme string) (ok bool) {
 	if p.atEOF {
+		if !p.failed {
+			p.unexpectedEOF(tag, lexeme)
+		}
 		return
 	}
 
@@ -156,7 +188,7 @@ func (p *parser) expect(tag ID.Token, lexeme string) (ok bool) {
 		p.handler.Add(u.NewError(
 			u.Parser, u.EP_ExpectedToken, c.Line, c.Col, p.src.Filename(), expected, got,
 		))
-		p.atEOF = true
+		p.atEOF, p.failed = true, true
 		return
 	}
 
@@ -164,6 +196,20 @@ func (p *parser) expect(tag ID.Token, lexeme string) (ok bool) {
 	return
 }
 
+// unexpectedEOF reports the token expected at the end of the source,
+// EOF has no position, so the error is at the last token
+func (p *parser) unexpectedEOF(tag ID.Token, lexeme string) {
+	line, col := -1, -1
+	if p.current > 0 {
+		line, col = p.src.Location(p.current - 1)
+	}
+	expected := p.src.TraceToken(tag, lexeme, int(ID.TokenEOF), int(ID.TokenEOF))
+	p.handler.Add(u.NewError(
+		u.Parser, u.EP_ExpectedToken, line, col, p.src.Filename(), expected, "\tend of source\n",
+	))
+	p.failed = true
+}
+
 func (p *parser) restoreScratch(old_size int) {
 	p.scratch = p.scratch[:old_size]
 }
@@ -176,6 +222,8 @@ func (p *parser) addScratchToExtra(scratch_top int) (ID.Node, ID.Node) {
 func (p *parser) isLiteral() bool {
 	return p.matchTag(ID.TokenIntLit) ||
 		p.matchTag(ID.TokenFloatLit) ||
+		p.matchTag(ID.TokenImaginaryLit) ||
+		p.matchTag(ID.TokenRuneLit) ||
 		p.matchTag(ID.TokenStringLit) ||
 		p.matchTag(ID.TokenBoolLit)
 }
@@ -198,7 +246,12 @@ func (p *parser) parseSource() {
 			break
 		}
 
-		index := p.parseFunctionDecl()
+		var index ID.Node
+		if p.matchToken(ID.TokenKeyword, "type") {
+			index = p.parseTypeDecl()
+		} else {
+			index = p.parseFunctionDecl()
+		}
 		p.scratch = append(p.scratch, int(index))
 	}
 	lhs, rhs = p.addScratchToExtra(scratch_top)
@@ -235,6 +288,96 @@ func (p *parser) parseFunctionDecl() ID.Node {
 	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, name, extra))
 }
 
+func (p *parser) parseTypeDecl() ID.Node {
+	tag, tokenIdx, lhs, rhs := ID.NodeTypeDecl, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
+	tokenIdx = p.current
+
+	ok := p.expect(ID.TokenKeyword, "type")
+	if !ok {
+		return ID.NodeInvalid
+	}
+	lhs = p.parseIdentifier()
+	if p.matchToken(ID.TokenKeyword, "enum") {
+		rhs = p.parseEnumType()
+	} else {
+		rhs = p.parseUnionType()
+	}
+	ok = p.expect(ID.TokenTerminator, "")
+	if !ok {
+		return ID.NodeInvalid
+	}
+
+	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
+}
+
+func (p *parser) parseUnionType() ID.Node {
+	tag, tokenIdx, lhs, rhs := ID.NodeUnionType, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
+	tokenIdx = p.current
+
+	scratch_top := len(p.scratch)
+	defer p.restoreScratch(scratch_top)
+
+	ok := p.expect(ID.TokenKeyword, "union") && p.expect(ID.TokenPunctuation, "{")
+	if !ok {
+		return ID.NodeInvalid
+	}
+	for !p.matchToken(ID.TokenPunctuation, "}") {
+		if p.matchTag(ID.TokenTerminator) {
+			p.next()
+			continue
+		}
+		if p.atEOF {
+			return ID.NodeInvalid
+		}
+		p.scratch = append(p.scratch, int(p.parseVariant()))
+	}
+	p.next()
+
+	lhs, rhs = p.addScratchToExtra(scratch_top)
+	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
+}
+
+func (p *parser) parseEnumType() ID.Node {
+	tag, tokenIdx, lhs, rhs := ID.NodeEnumType, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
+	tokenIdx = p.current
+
+	scratch_top := len(p.scratch)
+	defer p.restoreScratch(scratch_top)
+
+	ok := p.expect(ID.TokenKeyword, "enum") && p.expect(ID.TokenPunctuation, "{")
+	if !ok {
+		return ID.NodeInvalid
+	}
+	// members are separated by commas or terminators
+	for !p.matchToken(ID.TokenPunctuation, "}") {
+		if p.matchTag(ID.TokenTerminator) || p.matchToken(ID.TokenPunctuation, ",") {
+			p.next()
+			continue
+		}
+		if p.atEOF {
+			return ID.NodeInvalid
+		}
+		p.scratch = append(p.scratch, int(p.parseIdentifier()))
+	}
+	p.next()
+
+	lhs, rhs = p.addScratchToExtra(scratch_top)
+	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
+}
+
+func (p *parser) parseVariant() ID.Node {
+	tag, tokenIdx, lhs, rhs := ID.NodeVariant, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
+	tokenIdx = p.current
+
+	lhs = p.parseIdentifier()
+	rhs = ID.NodeUndefined
+	if p.matchTag(ID.TokenIdentifier) {
+		rhs = p.parseIdentifier()
+	}
+
+	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
+}
+
 func (p *parser) parseSignature() ID.Node {
 	tag, tokenIdx, lhs, rhs := ID.NodeSignature, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
 	tokenIdx = p.current
@@ -282,6 +425,10 @@ func (p *parser) parseBlock() ID.Node {
 		if i != ID.NodeInvalid {
 			p.scratch = append(p.scratch, int(i))
 		}
+		if p.matchToken(ID.TokenPunctuation, "}") {
+			// terminator may be omitted before closing brace, like in `fn(x) { return x }`
+			break
+		}
 		ok = p.expect(ID.TokenTerminator, "")
 		if !ok {
 			return ID.NodeInvalid
@@ -308,14 +455,20 @@ func (p *parser) parseStatement() ID.Node {
 		return p.parseReturnStmt()
 	} else if p.matchToken(ID.TokenKeyword, "if") {
 		return p.parseIfStmt()
+	} else if p.matchToken(ID.TokenKeyword, "defer") {
+		return p.parseDeferStmt()
+	} else if p.matchToken(ID.TokenKeyword, "match") {
+		return p.parseMatch()
 	} else if p.matchToken(ID.TokenPunctuation, "{") {
 		return p.parseBlock()
+	} else if p.isShortVarDecl() {
+		return p.parseShortVarDecl()
 	} else {
 		// NOTE: need to rollback here, because I don't bother
 		// to find all terminals that start an expression
 		// if grammar lets you do that this is very convenient and the right thing(TM)
 
-		p.save()
+		saved := p.save()
 		i := p.parseExpression()
 		if p.matchTag(ID.TokenTerminator) {
 			// expression statement
@@ -323,7 +476,7 @@ func (p *parser) parseStatement() ID.Node {
 		}
 		s := p.src.Lexeme(p.current)
 		_ = s
-		p.rollback()
+		p.rollback(saved)
 		return p.parseAssignment()
 	}
 }
@@ -336,12 +489,121 @@ func (p *parser) parseIfStmt() ID.Node {
 	if !ok {
 		return ID.NodeInvalid
 	}
-	lhs = p.parseExpression()
+	if p.isShortVarDecl() {
+		// unwrap of the optional `if v, ok := opt {}`
+		lhs = p.parseShortVarDecl()
+	} else {
+		lhs = p.parseExpression()
+	}
 	rhs = p.parseBlock()
 
 	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
 }
 
+func (p *parser) parseDeferStmt() ID.Node {
+	tag, tokenIdx, lhs, rhs := ID.NodeDeferStmt, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
+	tokenIdx = p.current
+
+	ok := p.expect(ID.TokenKeyword, "defer")
+	if !ok {
+		return ID.NodeInvalid
+	}
+	exprToken := p.current
+	lhs = p.parseExpression()
+	rhs = ID.NodeUndefined
+	if lhs == ID.NodeInvalid {
+		return ID.NodeInvalid
+	}
+	expr := p.ast.Expression(p.ast.GetNode(lhs)).Expression
+	if expr == ID.NodeInvalid {
+		return ID.NodeInvalid
+	}
+	if p.ast.GetNode(expr).Tag() != ID.NodeCall {
+		c := p.src.Token(exprToken)
+		p.handler.Add(u.NewError(
+			u.Parser, u.EP_ExpectedCall, c.Line, c.Col, p.src.Filename(), p.src.Lexeme(exprToken),
+		))
+		return ID.NodeInvalid
+	}
+
+	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
+}
+
+func (p *parser) parseMatch() ID.Node {
+	tag, tokenIdx, lhs, rhs := ID.NodeMatch, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
+	tokenIdx = p.current
+
+	scratch_top := len(p.scratch)
+	defer p.restoreScratch(scratch_top)
+
+	ok := p.expect(ID.TokenKeyword, "match")
+	if !ok {
+		return ID.NodeInvalid
+	}
+	lhs = p.parseExpression()
+	ok = p.expect(ID.TokenPunctuation, "{")
+	if !ok {
+		return ID.NodeInvalid
+	}
+	// arms are separated by commas or terminators
+	for !p.matchToken(ID.TokenPunctuation, "}") {
+		if p.matchTag(ID.TokenTerminator) || p.matchToken(ID.TokenPunctuation, ",") {
+			p.next()
+			continue
+		}
+		if p.atEOF {
+			return ID.NodeInvalid
+		}
+		p.scratch = append(p.scratch, int(p.parseMatchArm()))
+	}
+	p.next()
+
+	start, end := p.addScratchToExtra(scratch_top)
+	rhs, _ = p.ast.AddExtra([]int{int(start), int(end)})
+	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
+}
+
+func (p *parser) parseMatchArm() ID.Node {
+	tag, tokenIdx, lhs, rhs := ID.NodeMatchArm, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
+	tokenIdx = p.current
+
+	// variant is referred to as an expression, so it is resolved like any other name
+	variant := p.parseIdentifier()
+	lhs = p.ast.AddNode(NodeConstructor[ID.NodeExpression](tokenIdx, variant, ID.NodeUndefined))
+	var binding ID.Node = ID.NodeUndefined
+	if p.matchToken(ID.TokenPunctuation, "(") {
+		p.next()
+		binding = p.parseIdentifier()
+		ok := p.expect(ID.TokenPunctuation, ")")
+		if !ok {
+			return ID.NodeInvalid
+		}
+	}
+	ok := p.expect(ID.TokenPunctuation, "=>")
+	if !ok {
+		return ID.NodeInvalid
+	}
+
+	var body ID.Node
+	if p.matchToken(ID.TokenPunctuation, "{") {
+		body = p.parseBlock()
+	} else {
+		// single statement is the only one in the block
+		bodyToken := p.current
+		var stmt ID.Node
+		if p.matchToken(ID.TokenKeyword, "return") {
+			stmt = p.parseArmReturn()
+		} else {
+			stmt = p.parseExpression()
+		}
+		start, end := p.ast.AddExtra([]int{int(stmt)})
+		body = p.ast.AddNode(NodeConstructor[ID.NodeBlock](bodyToken, start, end))
+	}
+
+	rhs, _ = p.ast.AddExtra([]int{int(binding), int(body)})
+	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
+}
+
 func (p *parser) parseReturnStmt() ID.Node {
 	tag, tokenIdx, lhs, rhs := ID.NodeReturnStmt, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
 	tokenIdx = p.current
@@ -356,6 +618,24 @@ func (p *parser) parseReturnStmt() ID.Node {
 	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
 }
 
+// parseArmReturn parses return of the single statement arm, it returns one
+// expression because comma after it separates arms
+func (p *parser) parseArmReturn() ID.Node {
+	tag, tokenIdx, lhs, rhs := ID.NodeReturnStmt, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
+	tokenIdx = p.current
+
+	ok := p.expect(ID.TokenKeyword, "return")
+	if !ok {
+		return ID.NodeInvalid
+	}
+	listToken := p.current
+	start, end := p.ast.AddExtra([]int{int(p.parseExpression())})
+	lhs = p.ast.AddNode(NodeConstructor[ID.NodeExpressionList](listToken, start, end))
+	rhs = ID.NodeUndefined
+
+	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
+}
+
 func (p *parser) parseConstDecl() ID.Node {
 	tag, tokenIdx, lhs, rhs := ID.NodeConstDecl, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
 	tokenIdx = p.current
@@ -392,6 +672,42 @@ func (p *parser) parseVarDecl() ID.Node {
 	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
 }
 
+// isShortVarDecl looks ahead for `identifier {, identifier} :=`
+func (p *parser) isShortVarDecl() bool {
+	i := p.current
+	for {
+		if p.src.Token(i).Tag != ID.TokenIdentifier {
+			return false
+		}
+		i++
+		if p.src.Token(i).Tag != ID.TokenPunctuation {
+			return false
+		}
+		switch p.src.Lexeme(i) {
+		case ",":
+			i++
+		case ":=":
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+func (p *parser) parseShortVarDecl() ID.Node {
+	tag, tokenIdx, lhs, rhs := ID.NodeShortVarDecl, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
+	tokenIdx = p.current
+
+	lhs = p.parseIdentifierList()
+	ok := p.expect(ID.TokenPunctuation, ":=")
+	if !ok {
+		return ID.NodeInvalid
+	}
+	rhs = p.parseExpressionList()
+
+	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
+}
+
 func (p *parser) parseAssignment() ID.Node {
 	tag, tokenIdx, lhs, rhs := ID.NodeAssignment, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
 	tokenIdx = p.current
@@ -502,6 +818,9 @@ func (p *parser) parseOperand() ID.Node {
 	if p.isLiteral() {
 		return p.parseLiteral()
 	}
+	if p.matchToken(ID.TokenKeyword, "fn") {
+		return p.parseFunctionLit()
+	}
 	ok := p.expect(ID.TokenPunctuation, "(")
 	if !ok {
 		return ID.NodeInvalid
@@ -514,6 +833,20 @@ func (p *parser) parseOperand() ID.Node {
 	return i
 }
 
+func (p *parser) parseFunctionLit() ID.Node {
+	tag, tokenIdx, lhs, rhs := ID.NodeFunctionLit, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
+	tokenIdx = p.current
+
+	ok := p.expect(ID.TokenKeyword, "fn")
+	if !ok {
+		return ID.NodeInvalid
+	}
+	lhs = p.parseSignature()
+	rhs = p.parseBlock()
+
+	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
+}
+
 func (p *parser) parseIdentifierList() ID.Node {
 	tag, tokenIdx, lhs, rhs := ID.NodeIdentifierList, ID.TokenInvalid, ID.NodeInvalid, ID.NodeInvalid
 	tokenIdx = p.current
@@ -552,17 +885,49 @@ func (p *parser) parseLiteral() ID.Node {
 	tokenIdx = p.current
 	lhs, rhs = ID.NodeUndefined, ID.NodeUndefined
 
+	// invalid literal is reported, but parsing goes on with zero value
+	lexeme := p.src.Lexeme(tokenIdx)
+	var value int
+	var err error
 	if p.matchTag(ID.TokenIntLit) {
 		tag = ID.NodeIntLiteral
+		var v uint64
+		v, err = DecodeInt(lexeme)
+		value = int(v)
 	} else if p.matchTag(ID.TokenFloatLit) {
 		tag = ID.NodeFloatLiteral
+		var v float64
+		v, err = DecodeFloat(lexeme)
+		value = int(math.Float64bits(v))
+	} else if p.matchTag(ID.TokenImaginaryLit) {
+		tag = ID.NodeImaginaryLiteral
+		var v float64
+		v, err = DecodeImaginary(lexeme)
+		value = int(math.Float64bits(v))
+	} else if p.matchTag(ID.TokenRuneLit) {
+		tag = ID.NodeRuneLiteral
+		var v rune
+		v, err = DecodeRune(lexeme)
+		value = int(v)
 	} else if p.matchTag(ID.TokenStringLit) {
 		tag = ID.NodeStringLiteral
+		var v string
+		v, err = DecodeString(lexeme)
+		lhs = p.ast.AddString(v)
 	} else if p.matchTag(ID.TokenBoolLit) {
 		tag = ID.NodeBoolLiteral
 	} else {
 		panic("parseLiteral unimplemented")
 	}
+	if tag != ID.NodeStringLiteral && tag != ID.NodeBoolLiteral {
+		lhs, _ = p.ast.AddExtra([]int{value})
+	}
+	if err != nil {
+		c := p.src.Token(tokenIdx)
+		p.handler.Add(u.NewError(
+			u.Parser, u.EP_InvalidLiteral, c.Line, c.Col, p.src.Filename(), lexeme, err,
+		))
+	}
 
 	p.next()
 	return p.ast.AddNode(NodeConstructor[tag](tokenIdx, lhs, rhs))
@@ -0,0 +1,1222 @@
+package codegen
+
+import (
+	"fmt"
+	"math"
+	"some/analysis"
+	a "some/ast"
+	ID "some/domain"
+	T "some/typesystem"
+	"strconv"
+	"strings"
+)
+
+const prelude = `#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+`
+
+const concatHelper = `
+static const char *some_concat(const char *lhs, const char *rhs) {
+	size_t n = strlen(lhs), m = strlen(rhs);
+	char *s = malloc(n + m + 1);
+	memcpy(s, lhs, n);
+	memcpy(s + n, rhs, m + 1);
+	return s;
+}
+`
+
+const runeStringHelper = `
+static const char *some_rune_string(int64_t r) {
+	char *s = calloc(5, 1);
+	if (r < 0 || r > 0x10FFFF || (r >= 0xD800 && r <= 0xDFFF)) {
+		r = 0xFFFD;
+	}
+	if (r < 0x80) {
+		s[0] = (char)r;
+	} else if (r < 0x800) {
+		s[0] = (char)(0xC0 | (r >> 6));
+		s[1] = (char)(0x80 | (r & 0x3F));
+	} else if (r < 0x10000) {
+		s[0] = (char)(0xE0 | (r >> 12));
+		s[1] = (char)(0x80 | ((r >> 6) & 0x3F));
+		s[2] = (char)(0x80 | (r & 0x3F));
+	} else {
+		s[0] = (char)(0xF0 | (r >> 18));
+		s[1] = (char)(0x80 | ((r >> 12) & 0x3F));
+		s[2] = (char)(0x80 | ((r >> 6) & 0x3F));
+		s[3] = (char)(0x80 | (r & 0x3F));
+	}
+	return s;
+}
+`
+
+// NOTE: Errors are tagged structs as well as optionals,
+// none is the zero value of both of them
+const errorType = `
+typedef struct {
+	bool failed;
+	const char *message;
+} some_error;
+`
+
+const errorEqHelper = `
+static bool some_error_eq(some_error lhs, some_error rhs) {
+	if (!lhs.failed || !rhs.failed) {
+		return lhs.failed == rhs.failed;
+	}
+	return strcmp(lhs.message, rhs.message) == 0;
+}
+`
+
+const errorMessageHelper = `
+static const char *some_error_message(some_error e) {
+	return e.failed ? e.message : "";
+}
+`
+
+type generator struct {
+	out      *strings.Builder
+	instance analysis.Instance
+	tAst     a.TypedAST
+	repo     T.TypeRepo
+	depth    int
+	tmpCount int
+
+	names    analysis.QualifiedNames
+	captures map[ID.Node][]ID.Node
+	// type declarations by their names, variants by their names
+	// mapped to the type declarations and to their payloads,
+	// members of enumerations mapped to the type declarations
+	typeDecls map[ID.Node]ID.Node
+	variants  map[ID.Node]ID.Node
+	payloads  map[ID.Node]ID.Node
+	members   map[ID.Node]ID.Node
+	// captured variables are shared between the function and closures,
+	// so they live on the heap
+	boxed map[ID.Node]bool
+	// identifiers on the left of assignments, they write the variable, not read it
+	assigned map[ID.Node]bool
+	// function literal which body is being generated
+	lit      ID.Node
+	litCount int
+	// deferred calls of the function which body is being generated,
+	// they run in the reverse order from the cleanup label
+	defers          []ID.Node
+	returnsDeferred bool
+	// functions produced along the way: closure bodies, call helpers etc
+	helpers    map[string]bool
+	prototypes strings.Builder
+	envDefs    strings.Builder
+	lifted     strings.Builder
+
+	usesConcat       bool
+	usesRuneString   bool
+	usesError        bool
+	usesErrorEq      bool
+	usesErrorMessage bool
+	// result structs of multi-value returns and function values
+	// in order of definition
+	typeNames map[string]bool
+	typeDefs  strings.Builder
+}
+
+var basicTypes = map[ID.Type]string{
+	ID.TypeInt:     "int64_t",
+	ID.TypeFloat:   "double",
+	ID.TypeBool:    "bool",
+	ID.TypeString:  "const char *",
+	ID.TypeVoid:    "void",
+	ID.TypeInt8:    "int8_t",
+	ID.TypeInt16:   "int16_t",
+	ID.TypeInt32:   "int32_t",
+	ID.TypeInt64:   "int64_t",
+	ID.TypeUint8:   "uint8_t",
+	ID.TypeUint16:  "uint16_t",
+	ID.TypeUint32:  "uint32_t",
+	ID.TypeUint64:  "uint64_t",
+	ID.TypeUintptr: "uintptr_t",
+	ID.TypeFloat32: "float",
+	ID.TypeFloat64: "double",
+	ID.TypeError:   "some_error",
+	ID.TypeComplex: "double _Complex",
+}
+
+// NOTE: C declarators are inside-out, so name is wrapped by the type
+// rather than just prepended to it
+func (g *generator) declare(t ID.Type, name string) string {
+	it := g.repo.Subtypes(t)
+	switch g.repo.GetType(t).Kind {
+	case ID.KindIdentity:
+		basicT := it.Next()
+		basic, ok := basicTypes[basicT]
+		if decl, isDeclared := T.TypeDeclaration(basicT); isDeclared {
+			basic, ok = g.declaredType(decl), true
+		}
+		if !ok {
+			panic("Unresolved type in code generation")
+		}
+		g.usesError = g.usesError || basicT == ID.TypeError
+		if strings.HasSuffix(basic, "*") || name == "" {
+			return basic + name
+		}
+		return basic + " " + name
+	case ID.KindPtr:
+		return g.declare(it.Next(), "*"+name)
+	case ID.KindFunction:
+		if name == "" {
+			return g.functionValueType(t)
+		}
+		return g.functionValueType(t) + " " + name
+	case ID.KindTuple:
+		if name == "" {
+			return g.tuple(t)
+		}
+		return g.tuple(t) + " " + name
+	case ID.KindOptional:
+		if name == "" {
+			return g.optional(t)
+		}
+		return g.optional(t) + " " + name
+	default:
+		panic("this switch should be exaustive")
+	}
+}
+
+// tuple returns name of the struct that holds values of the tuple type,
+// struct is defined once per signature
+func (g *generator) tuple(t ID.Type) string {
+	name := "some_" + analysis.Mangle(g.repo, t)
+	if g.typeNames[name] {
+		return name
+	}
+	fields := make([]string, 0, 4)
+	it := g.repo.Subtypes(t)
+	for i := 0; !it.Done(); i++ {
+		fields = append(fields, "\t"+g.declare(it.Next(), fmt.Sprintf("_%d", i))+";\n")
+	}
+	g.typeNames[name] = true
+	fmt.Fprintf(&g.typeDefs, "\ntypedef struct {\n%s} %s;\n", strings.Join(fields, ""), name)
+	return name
+}
+
+// declaredType returns name of the C type for the type declared by decl
+func (g *generator) declaredType(decl ID.Node) string {
+	typeDecl := g.tAst.TypeDecl(g.tAst.GetNode(decl))
+	if g.tAst.GetNode(typeDecl.Type).Tag() == ID.NodeEnumType {
+		return g.enum(decl)
+	}
+	return g.union(decl)
+}
+
+// enum returns name of the enumeration declared by decl, every enumeration
+// comes with the function that returns names of its members for debugging
+func (g *generator) enum(decl ID.Node) string {
+	typeDecl := g.tAst.TypeDecl(g.tAst.GetNode(decl))
+	name := "some_" + a.Identifier_String(g.tAst.AST, typeDecl.Name)
+	if g.typeNames[name] {
+		return name
+	}
+	g.typeNames[name] = true
+	members := make([]string, 0, 4)
+	cases := strings.Builder{}
+	for _, member := range g.tAst.EnumType(g.tAst.GetNode(typeDecl.Type)).Members {
+		memberName := a.Identifier_String(g.tAst.AST, member)
+		members = append(members, name+"_"+memberName)
+		fmt.Fprintf(&cases, "\tcase %s_%s:\n\t\treturn \"%s\";\n", name, memberName, memberName)
+	}
+	fmt.Fprintf(&g.typeDefs, "\ntypedef enum { %s } %s;\n", strings.Join(members, ", "), name)
+	// NOTE: inline function is not reported when unused
+	fmt.Fprintf(&g.typeDefs, "\nstatic inline const char *%s(%s v)\n{\n\tswitch (v)\n\t{\n%s\t}\n\treturn \"\";\n}\n",
+		nameFunction(name), name, cases.String())
+	return name
+}
+
+// nameFunction returns name of the function that returns names of the members
+// of the enumeration, it is Color_name for the enumeration some_Color
+func nameFunction(enum string) string {
+	return strings.TrimPrefix(enum, "some_") + "_name"
+}
+
+// member returns declaration of the enumeration member the identifier refers to
+func (g *generator) member(i ID.Node) (ID.Node, bool) {
+	name, has := g.names.GetNodeName(i)
+	if !has {
+		return ID.NodeInvalid, false
+	}
+	decl := g.names.GetDeclarationNode(name)
+	_, isMember := g.members[decl]
+	return decl, isMember
+}
+
+// union returns name of the tagged union declared by decl,
+// variant name is the name of the tag as well as the name of the payload
+func (g *generator) union(decl ID.Node) string {
+	typeDecl := g.tAst.TypeDecl(g.tAst.GetNode(decl))
+	name := "some_" + a.Identifier_String(g.tAst.AST, typeDecl.Name)
+	if g.typeNames[name] {
+		return name
+	}
+	tags := make([]string, 0, 4)
+	fields := make([]string, 0, 4)
+	for _, variant := range g.tAst.UnionType(g.tAst.GetNode(typeDecl.Type)).Variants {
+		v := g.tAst.Variant(g.tAst.GetNode(variant))
+		variantName := a.Identifier_String(g.tAst.AST, v.Name)
+		tags = append(tags, name+"_"+variantName)
+		if v.Payload != ID.NodeUndefined {
+			fields = append(fields, "\t\t"+g.payload(v.Payload, variantName)+";\n")
+		}
+	}
+	g.typeNames[name] = true
+	union := ""
+	if len(fields) > 0 {
+		union = fmt.Sprintf("\tunion {\n%s\t};\n", strings.Join(fields, ""))
+	}
+	fmt.Fprintf(&g.typeDefs, "\ntypedef enum { %s } %s_tag;\n", strings.Join(tags, ", "), name)
+	fmt.Fprintf(&g.typeDefs, "\ntypedef struct {\n\t%s_tag tag;\n%s} %s;\n", name, union, name)
+	return name
+}
+
+// payload declares field of the union, payload is referred to by the name of its type
+func (g *generator) payload(payload ID.Node, name string) string {
+	if qualifiedName, has := g.names.GetNodeName(payload); has {
+		return g.declaredType(g.typeDecls[g.names.GetDeclarationNode(qualifiedName)]) + " " + name
+	}
+	basic, _ := T.BasicType(a.Identifier_String(g.tAst.AST, payload))
+	g.usesError = g.usesError || basic == ID.TypeError
+	if strings.HasSuffix(basicTypes[basic], "*") {
+		return basicTypes[basic] + name
+	}
+	return basicTypes[basic] + " " + name
+}
+
+// variant returns declaration of the variant the identifier refers to
+func (g *generator) variant(i ID.Node) (ID.Node, bool) {
+	name, has := g.names.GetNodeName(i)
+	if !has {
+		return ID.NodeInvalid, false
+	}
+	decl := g.names.GetDeclarationNode(name)
+	_, isVariant := g.variants[decl]
+	return decl, isVariant
+}
+
+// construct returns value of the union with the given variant
+func (g *generator) construct(variantDecl ID.Node, payload ...string) string {
+	union := g.union(g.variants[variantDecl])
+	name := a.Identifier_String(g.tAst.AST, variantDecl)
+	if len(payload) == 0 {
+		return fmt.Sprintf("((%s){.tag = %s_%s})", union, union, name)
+	}
+	return fmt.Sprintf("((%s){.tag = %s_%s, .%s = %s})", union, union, name, name, payload[0])
+}
+
+// constructor returns variant with the payload as a function value
+func (g *generator) constructor(variantDecl ID.Node, fnT ID.Type) string {
+	name := g.union(g.variants[variantDecl]) + "_" + a.Identifier_String(g.tAst.AST, variantDecl) + "_new"
+	if !g.helpers[name] {
+		g.helpers[name] = true
+		subtypes := g.subtypes(fnT)
+		signature := "static " + g.declare(subtypes[1], name+"("+g.declare(subtypes[0], "payload")+")")
+		g.prototypes.WriteString(signature + ";\n")
+		fmt.Fprintf(&g.lifted, "\n%s\n{\n\treturn %s;\n}\n", signature, g.construct(variantDecl, "payload"))
+	}
+	return g.functionValue(name, fnT)
+}
+
+// optional returns name of the struct that holds value of the optional type
+// along with the flag telling that the value is present
+func (g *generator) optional(t ID.Type) string {
+	name := "some_" + analysis.Mangle(g.repo, t)
+	if g.typeNames[name] {
+		return name
+	}
+	it := g.repo.Subtypes(t)
+	value := g.declare(it.Next(), "value")
+	g.typeNames[name] = true
+	fmt.Fprintf(&g.typeDefs, "\ntypedef struct {\n\tbool ok;\n\t%s;\n} %s;\n", value, name)
+	return name
+}
+
+// NOTE: Function value is a pair of function pointer and environment pointer,
+// the latter is NULL for functions that don't capture anything. Function
+// always takes the environment as the first parameter, so both top level
+// functions and closures are called the same way
+//
+// functionValueType returns name of the struct that holds function values
+// of the type t, struct is defined once per signature
+func (g *generator) functionValueType(t ID.Type) string {
+	name := "some_" + analysis.Mangle(g.repo, t)
+	if g.typeNames[name] {
+		return name
+	}
+	subtypes := g.subtypes(t)
+	params := []string{"void *"}
+	for _, p := range subtypes[:len(subtypes)-1] {
+		params = append(params, g.declare(p, ""))
+	}
+	fn := g.declare(subtypes[len(subtypes)-1], "(*fn)("+strings.Join(params, ", ")+")")
+	g.typeNames[name] = true
+	fmt.Fprintf(&g.typeDefs, "\ntypedef struct {\n\t%s;\n\tvoid *env;\n} %s;\n", fn, name)
+	return name
+}
+
+func paramList(params []string) string {
+	if len(params) == 0 {
+		return "void"
+	}
+	return strings.Join(params, ", ")
+}
+
+func (g *generator) isBasic(node ID.Node, basic ID.Type) bool {
+	t := g.tAst.GetNodeType(node)
+	if t == ID.TypeInvalid || g.repo.GetType(t).Kind != ID.KindIdentity {
+		return false
+	}
+	it := g.repo.Subtypes(t)
+	return it.Next() == basic
+}
+
+func (g *generator) isEnum(node ID.Node) bool {
+	t := g.tAst.GetNodeType(node)
+	if t == ID.TypeInvalid || g.repo.GetType(t).Kind != ID.KindIdentity {
+		return false
+	}
+	it := g.repo.Subtypes(t)
+	decl, isDeclared := T.TypeDeclaration(it.Next())
+	return isDeclared && g.tAst.GetNode(g.tAst.TypeDecl(g.tAst.GetNode(decl)).Type).Tag() == ID.NodeEnumType
+}
+
+func (g *generator) isString(node ID.Node) bool {
+	return g.isBasic(node, ID.TypeString)
+}
+
+func (g *generator) line(format string, args ...any) {
+	for i := 0; i < g.depth; i++ {
+		g.out.WriteByte('\t')
+	}
+	fmt.Fprintf(g.out, format, args...)
+	g.out.WriteByte('\n')
+}
+
+func (g *generator) subtypes(t ID.Type) []ID.Type {
+	subtypes := make([]ID.Type, 0, 4)
+	it := g.repo.Subtypes(t)
+	for !it.Done() {
+		subtypes = append(subtypes, it.Next())
+	}
+	return subtypes
+}
+
+func (g *generator) parameters(signature ID.Node) []ID.Node {
+	parameters := g.tAst.Signature(g.tAst.GetNode(signature)).Parameters
+	if parameters == ID.NodeUndefined {
+		return nil
+	}
+	return g.tAst.IdentifierList(g.tAst.GetNode(parameters)).Identifiers
+}
+
+// declareFunction returns declaration of the function of type fnT,
+// params are prepended by the extra ones (like environment of the closure)
+func (g *generator) declareFunction(fnT ID.Type, name string, paramNodes []ID.Node, extra ...string) string {
+	subtypes := g.subtypes(fnT)
+	params := extra
+	for i, p := range paramNodes {
+		params = append(params, g.declare(subtypes[i], a.Identifier_String(g.tAst.AST, p)))
+	}
+	return "static " + g.declare(subtypes[len(subtypes)-1], name+"("+paramList(params)+")")
+}
+
+func (g *generator) signature() string {
+	fn := g.tAst.FunctionDecl(g.tAst.GetNode(g.instance.Decl))
+	if g.instance.Name == "main" {
+		return "int main(void)"
+	}
+	return g.declareFunction(g.tAst.GetNodeType(fn.Name), g.instance.Name, g.parameters(fn.Signature))
+}
+
+// body emits function body, prologue declares everything that must be
+// visible in the whole function
+func (g *generator) body(fnT ID.Type, params []ID.Node, body ID.Node, prologue ...string) {
+	defers, returnsDeferred := g.defers, g.returnsDeferred
+	g.defers, g.returnsDeferred = nil, false
+	if body != ID.NodeUndefined {
+		g.collectDefers(body)
+	}
+	subtypes := g.subtypes(fnT)
+	returnT := subtypes[len(subtypes)-1]
+
+	g.line("{")
+	g.depth++
+	for _, line := range prologue {
+		g.line("%s", line)
+	}
+	g.deferSlots(returnT)
+	for _, p := range params {
+		if g.boxed[p] {
+			g.box(p, a.Identifier_String(g.tAst.AST, p))
+		}
+	}
+	if body != ID.NodeUndefined {
+		for _, stmt := range g.tAst.Block(g.tAst.GetNode(body)).Statements {
+			g.statement(stmt)
+		}
+	}
+	g.cleanup(returnT)
+	g.depth--
+	g.line("}")
+	g.defers, g.returnsDeferred = defers, returnsDeferred
+}
+
+// NOTE: Deferred call may be skipped by the if statement, so every defer has
+// a flag that is set when the defer statement is reached. Without loops
+// every defer statement runs at most once and in the order of appearance,
+// so running flagged calls in the reverse order gives LIFO order.
+// Returns store the result and jump to the cleanup label.
+
+// collectDefers finds defer statements of the function,
+// nested function literals have their own
+func (g *generator) collectDefers(i ID.Node) {
+	n := g.tAst.GetNode(i)
+	switch n.Tag() {
+	case ID.NodeBlock:
+		for _, stmt := range g.tAst.Block(n).Statements {
+			g.collectDefers(stmt)
+		}
+	case ID.NodeIfStmt:
+		g.collectDefers(g.tAst.IfStmt(n).Block)
+	case ID.NodeMatch:
+		for _, arm := range g.tAst.Match(n).Arms {
+			g.collectDefers(g.tAst.MatchArm(g.tAst.GetNode(arm)).Body)
+		}
+	case ID.NodeDeferStmt:
+		call := g.deferredCall(i)
+		// conversions don't have effects, their arguments are evaluated in place
+		if _, isConversion := g.instance.Conversions[call.LhsExpr]; !isConversion {
+			g.defers = append(g.defers, i)
+		}
+	}
+}
+
+func (g *generator) deferredCall(i ID.Node) a.Call {
+	expr := g.tAst.Expression(g.tAst.GetNode(g.tAst.DeferStmt(g.tAst.GetNode(i)).Expression)).Expression
+	return g.tAst.Call(g.tAst.GetNode(expr))
+}
+
+func (g *generator) arguments(call a.Call) []ID.Node {
+	if call.Arguments == ID.NodeUndefined {
+		return nil
+	}
+	return g.tAst.ExpressionList(g.tAst.GetNode(call.Arguments)).Expressions
+}
+
+// deferSlots declares flags of the deferred calls, storage for the evaluated
+// callees and arguments and for the result
+func (g *generator) deferSlots(returnT ID.Type) {
+	if len(g.defers) == 0 {
+		return
+	}
+	if returnKeyword(g.repo, returnT) != "" {
+		g.line("%s;", g.declare(returnT, "result_"))
+	}
+	for k, i := range g.defers {
+		call := g.deferredCall(i)
+		g.line("bool defer%d_on = false;", k)
+		if _, isFunction := g.instance.Functions[call.LhsExpr]; !isFunction {
+			g.line("%s;", g.declare(g.tAst.GetNodeType(call.LhsExpr), fmt.Sprintf("defer%d_fn", k)))
+		}
+		for j, arg := range g.arguments(call) {
+			g.line("%s;", g.declare(g.tAst.GetNodeType(arg), fmt.Sprintf("defer%d_a%d", k, j)))
+		}
+	}
+}
+
+// deferStmt evaluates callee and arguments of the deferred call
+func (g *generator) deferStmt(i ID.Node) {
+	k := -1
+	for j, d := range g.defers {
+		if d == i {
+			k = j
+		}
+	}
+	call := g.deferredCall(i)
+	if k < 0 {
+		// conversion
+		g.line("%s;", g.expression(g.tAst.DeferStmt(g.tAst.GetNode(i)).Expression))
+		return
+	}
+	if _, isFunction := g.instance.Functions[call.LhsExpr]; !isFunction {
+		g.line("defer%d_fn = %s;", k, g.expression(call.LhsExpr))
+	}
+	for j, arg := range g.arguments(call) {
+		g.line("defer%d_a%d = %s;", k, j, g.expression(arg))
+	}
+	g.line("defer%d_on = true;", k)
+}
+
+// cleanup runs deferred calls in the reverse order
+func (g *generator) cleanup(returnT ID.Type) {
+	if len(g.defers) == 0 {
+		return
+	}
+	if g.returnsDeferred {
+		g.depth--
+		g.line("cleanup:")
+		g.depth++
+	}
+	for k := len(g.defers) - 1; k >= 0; k-- {
+		call := g.deferredCall(g.defers[k])
+		args := make([]string, 0, 4)
+		for j := range g.arguments(call) {
+			args = append(args, fmt.Sprintf("defer%d_a%d", k, j))
+		}
+		g.line("if (defer%d_on)", k)
+		g.depth++
+		if name, isFunction := g.instance.Functions[call.LhsExpr]; isFunction {
+			g.line("%s(%s);", name, strings.Join(args, ", "))
+		} else {
+			g.line("%s;", g.callClosure(g.tAst.GetNodeType(call.LhsExpr), fmt.Sprintf("defer%d_fn", k), args))
+		}
+		g.depth--
+	}
+	if returnKeyword(g.repo, returnT) != "" {
+		g.line("return result_;")
+	}
+}
+
+// returnValue returns from the function, or jumps to the deferred calls
+func (g *generator) returnValue(value string) {
+	if len(g.defers) == 0 {
+		g.line("return %s;", value)
+		return
+	}
+	g.returnsDeferred = true
+	g.line("result_ = %s;", value)
+	g.line("goto cleanup;")
+}
+
+func (g *generator) function() {
+	fn := g.tAst.FunctionDecl(g.tAst.GetNode(g.instance.Decl))
+	g.line("%s", g.signature())
+	g.body(g.tAst.GetNodeType(fn.Name), g.parameters(fn.Signature), fn.Body)
+}
+
+// box moves captured variable to the heap
+func (g *generator) box(decl ID.Node, value string) {
+	name := a.Identifier_String(g.tAst.AST, decl)
+	g.line("%s = malloc(sizeof *%s__box);", g.declare(g.tAst.GetNodeType(decl), "*"+name+"__box"), name)
+	g.line("*%s__box = %s;", name, value)
+}
+
+// variable returns access to the local variable, captured ones are accessed
+// through the environment of the closure or through the box
+func (g *generator) variable(i ID.Node) string {
+	name := a.Identifier_String(g.tAst.AST, i)
+	qualifiedName, has := g.names.GetNodeName(i)
+	if !has {
+		return name
+	}
+	decl := g.names.GetDeclarationNode(qualifiedName)
+	if !g.boxed[decl] {
+		return name
+	}
+	for _, captured := range g.captures[g.lit] {
+		if captured == decl {
+			return "(*env->" + name + ")"
+		}
+	}
+	return "(*" + name + "__box)"
+}
+
+// reference returns pointer to the captured variable to store in the environment
+func (g *generator) reference(decl ID.Node) string {
+	name := a.Identifier_String(g.tAst.AST, decl)
+	for _, captured := range g.captures[g.lit] {
+		if captured == decl {
+			return "env->" + name
+		}
+	}
+	return name + "__box"
+}
+
+// functionLit lifts the body of the literal to the separate function
+// and returns expression that creates the closure
+func (g *generator) functionLit(i ID.Node) string {
+	lit := g.tAst.FunctionLit(g.tAst.GetNode(i))
+	name := fmt.Sprintf("%s__lit%d", g.instance.Name, g.litCount)
+	g.litCount++
+	valueT := g.functionValueType(g.tAst.GetNodeType(i))
+
+	captures := g.captures[i]
+	refs := make([]string, 0, len(captures))
+	for _, decl := range captures {
+		refs = append(refs, g.reference(decl))
+	}
+
+	signature := g.declareFunction(g.tAst.GetNodeType(i), name, g.parameters(lit.Signature), "void *env_")
+	g.prototypes.WriteString(signature + ";\n")
+
+	out, depth, enclosing := g.out, g.depth, g.lit
+	g.out, g.depth, g.lit = &strings.Builder{}, 0, i
+	g.out.WriteByte('\n')
+	g.line("%s", signature)
+	if len(captures) == 0 {
+		g.body(g.tAst.GetNodeType(i), g.parameters(lit.Signature), lit.Body)
+	} else {
+		g.body(g.tAst.GetNodeType(i), g.parameters(lit.Signature), lit.Body, fmt.Sprintf("%s_env *env = env_;", name))
+	}
+	g.lifted.WriteString(g.out.String())
+	g.out, g.depth, g.lit = out, depth, enclosing
+
+	if len(captures) == 0 {
+		return fmt.Sprintf("((%s){%s, NULL})", valueT, name)
+	}
+
+	fields := make([]string, 0, len(captures))
+	params := make([]string, 0, len(captures))
+	assignments := make([]string, 0, len(captures))
+	for _, decl := range captures {
+		field := a.Identifier_String(g.tAst.AST, decl)
+		fields = append(fields, "\t"+g.declare(g.tAst.GetNodeType(decl), "*"+field)+";\n")
+		params = append(params, g.declare(g.tAst.GetNodeType(decl), "*"+field))
+		assignments = append(assignments, fmt.Sprintf("\tenv->%s = %s;\n", field, field))
+	}
+	fmt.Fprintf(&g.envDefs, "\ntypedef struct {\n%s} %s_env;\n", strings.Join(fields, ""), name)
+	constructor := fmt.Sprintf("static %s %s_new(%s)", valueT, name, paramList(params))
+	g.prototypes.WriteString(constructor + ";\n")
+	fmt.Fprintf(&g.lifted, "\n%s\n{\n\t%s_env *env = malloc(sizeof *env);\n%s\treturn (%s){%s, env};\n}\n",
+		constructor, name, strings.Join(assignments, ""), valueT, name)
+	return fmt.Sprintf("%s_new(%s)", name, strings.Join(refs, ", "))
+}
+
+// functionValue wraps top level function into the closure with empty environment
+func (g *generator) functionValue(name string, fnT ID.Type) string {
+	valueT := g.functionValueType(fnT)
+	trampoline := name + "__value"
+	if !g.helpers[trampoline] {
+		g.helpers[trampoline] = true
+		subtypes := g.subtypes(fnT)
+		params := []string{"void *env"}
+		args := make([]string, 0, len(subtypes))
+		for j, p := range subtypes[:len(subtypes)-1] {
+			params = append(params, g.declare(p, fmt.Sprintf("a%d", j)))
+			args = append(args, fmt.Sprintf("a%d", j))
+		}
+		signature := "static " + g.declare(subtypes[len(subtypes)-1], trampoline+"("+paramList(params)+")")
+		g.prototypes.WriteString(signature + ";\n")
+		fmt.Fprintf(&g.lifted, "\n%s\n{\n\t%s%s(%s);\n}\n",
+			signature, returnKeyword(g.repo, subtypes[len(subtypes)-1]), name, strings.Join(args, ", "))
+	}
+	return fmt.Sprintf("((%s){%s, NULL})", valueT, trampoline)
+}
+
+func returnKeyword(repo T.TypeRepo, t ID.Type) string {
+	if repo.GetType(t).Kind == ID.KindIdentity {
+		it := repo.Subtypes(t)
+		if it.Next() == ID.TypeVoid {
+			return ""
+		}
+	}
+	return "return "
+}
+
+// callClosure returns call of the function value through the helper,
+// so callee expression is evaluated only once
+func (g *generator) callClosure(fnT ID.Type, callee string, args []string) string {
+	helper := "some_call_" + analysis.Mangle(g.repo, fnT)
+	if !g.helpers[helper] {
+		g.helpers[helper] = true
+		subtypes := g.subtypes(fnT)
+		params := []string{g.functionValueType(fnT) + " c"}
+		forwarded := []string{"c.env"}
+		for j, p := range subtypes[:len(subtypes)-1] {
+			params = append(params, g.declare(p, fmt.Sprintf("a%d", j)))
+			forwarded = append(forwarded, fmt.Sprintf("a%d", j))
+		}
+		returnT := subtypes[len(subtypes)-1]
+		fmt.Fprintf(&g.envDefs, "\nstatic %s\n{\n\t%sc.fn(%s);\n}\n",
+			g.declare(returnT, helper+"("+strings.Join(params, ", ")+")"),
+			returnKeyword(g.repo, returnT), strings.Join(forwarded, ", "))
+	}
+	return fmt.Sprintf("%s(%s)", helper, strings.Join(append([]string{callee}, args...), ", "))
+}
+
+// destructure stores single tuple value in the temporary and returns accessors of its fields
+func (g *generator) destructure(expr ID.Node, count int) []string {
+	tmp := fmt.Sprintf("tmp%d", g.tmpCount)
+	g.tmpCount++
+	g.line("%s = %s;", g.declare(g.tAst.GetNodeType(expr), tmp), g.expression(expr))
+	fields := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		fields = append(fields, fmt.Sprintf("%s._%d", tmp, i))
+	}
+	return fields
+}
+
+func (g *generator) declareVariable(id ID.Node, value string) {
+	if g.boxed[id] {
+		g.box(id, value)
+		return
+	}
+	name := a.Identifier_String(g.tAst.AST, id)
+	g.line("%s = %s;", g.declare(g.tAst.GetNodeType(id), name), value)
+	if !g.isRead(id) {
+		// unused variables are fine, but C compiler warns about them
+		g.line("(void)%s;", name)
+	}
+}
+
+// isRead reports whether the value of declared variable is used anywhere
+func (g *generator) isRead(decl ID.Node) bool {
+	name, has := g.names.GetNodeName(decl)
+	if !has {
+		return true
+	}
+	for _, usage := range g.names.GetNodesByName(name) {
+		if usage != decl && !g.assigned[usage] {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) declarations(ids ID.Node, exprs ID.Node) {
+	identifiers := g.tAst.IdentifierList(g.tAst.GetNode(ids)).Identifiers
+	expressions := g.tAst.ExpressionList(g.tAst.GetNode(exprs)).Expressions
+	if len(identifiers) > 1 && len(expressions) == 1 {
+		fields := g.destructure(expressions[0], len(identifiers))
+		for i, id := range identifiers {
+			g.declareVariable(id, fields[i])
+		}
+		return
+	}
+	for i, id := range identifiers {
+		g.declareVariable(id, g.expression(expressions[i]))
+	}
+}
+
+func (g *generator) statement(i ID.Node) {
+	n := g.tAst.GetNode(i)
+	switch n.Tag() {
+	case ID.NodeBlock:
+		g.line("{")
+		g.depth++
+		for _, stmt := range g.tAst.Block(n).Statements {
+			g.statement(stmt)
+		}
+		g.depth--
+		g.line("}")
+	case ID.NodeConstDecl:
+		decl := g.tAst.ConstDecl(n)
+		g.declarations(decl.IdentifierList, decl.ExpressionList)
+	case ID.NodeVarDecl:
+		decl := g.tAst.VarDecl(n)
+		g.declarations(decl.IdentifierList, decl.ExpressionList)
+	case ID.NodeShortVarDecl:
+		decl := g.tAst.ShortVarDecl(n)
+		g.declarations(decl.IdentifierList, decl.ExpressionList)
+	case ID.NodeAssignment:
+		assignment := g.tAst.Assignment(n)
+		lhs := g.tAst.ExpressionList(g.tAst.GetNode(assignment.LhsList)).Expressions
+		rhs := g.tAst.ExpressionList(g.tAst.GetNode(assignment.RhsList)).Expressions
+		if len(lhs) == 1 {
+			g.line("%s = %s;", g.expression(lhs[0]), g.expression(rhs[0]))
+			return
+		}
+		// all right hand sides are evaluated before any assignment happens
+		g.line("{")
+		g.depth++
+		tmps := make([]string, 0, len(rhs))
+		if len(rhs) == 1 {
+			tmps = g.destructure(rhs[0], len(lhs))
+		} else {
+			for _, expr := range rhs {
+				tmp := fmt.Sprintf("tmp%d", g.tmpCount)
+				g.tmpCount++
+				g.line("%s = %s;", g.declare(g.tAst.GetNodeType(expr), tmp), g.expression(expr))
+				tmps = append(tmps, tmp)
+			}
+		}
+		for j, expr := range lhs {
+			g.line("%s = %s;", g.expression(expr), tmps[j])
+		}
+		g.depth--
+		g.line("}")
+	case ID.NodeReturnStmt:
+		exprs := g.tAst.ExpressionList(g.tAst.GetNode(g.tAst.ReturnStmt(n).ExpressionList)).Expressions
+		if len(exprs) == 1 {
+			g.returnValue(g.expression(exprs[0]))
+			return
+		}
+		values := make([]string, 0, len(exprs))
+		for _, expr := range exprs {
+			values = append(values, g.expression(expr))
+		}
+		g.returnValue(fmt.Sprintf("(%s){%s}", g.tuple(g.tAst.GetNodeType(i)), strings.Join(values, ", ")))
+	case ID.NodeIfStmt:
+		ifStmt := g.tAst.IfStmt(n)
+		if g.tAst.GetNode(ifStmt.Expression).Tag() == ID.NodeShortVarDecl {
+			g.unwrap(ifStmt)
+			return
+		}
+		g.line("if (%s)", g.expression(ifStmt.Expression))
+		g.statement(ifStmt.Block)
+	case ID.NodeDeferStmt:
+		g.deferStmt(i)
+	case ID.NodeMatch:
+		g.match(i)
+	case ID.NodeExpression:
+		g.line("%s;", g.expression(i))
+	default:
+		panic(fmt.Sprintf("Code generation for statement %s is not supported", g.tAst.GetNodeString(i)))
+	}
+}
+
+// unwrap declares value and the flag of the optional for the body of the if
+func (g *generator) unwrap(ifStmt a.IfStmt) {
+	decl := g.tAst.ShortVarDecl(g.tAst.GetNode(ifStmt.Expression))
+	identifiers := g.tAst.IdentifierList(g.tAst.GetNode(decl.IdentifierList)).Identifiers
+	expr := g.tAst.ExpressionList(g.tAst.GetNode(decl.ExpressionList)).Expressions[0]
+
+	g.line("{")
+	g.depth++
+	tmp := fmt.Sprintf("tmp%d", g.tmpCount)
+	g.tmpCount++
+	g.line("%s = %s;", g.declare(g.tAst.GetNodeType(expr), tmp), g.expression(expr))
+	g.line("if (%s.ok)", tmp)
+	g.line("{")
+	g.depth++
+	for j, id := range identifiers {
+		field := tmp + ".value"
+		if j == 1 {
+			field = tmp + ".ok"
+		}
+		g.declareVariable(id, field)
+		if !g.boxed[id] {
+			// it is fine not to use any of them
+			g.line("(void)%s;", a.Identifier_String(g.tAst.AST, id))
+		}
+	}
+	for _, stmt := range g.tAst.Block(g.tAst.GetNode(ifStmt.Block)).Statements {
+		g.statement(stmt)
+	}
+	g.depth--
+	g.line("}")
+	g.depth--
+	g.line("}")
+}
+
+// match switches on the tag of the union or on the value of the enumeration,
+// exhaustiveness is checked by the typechecker
+func (g *generator) match(i ID.Node) {
+	match := g.tAst.Match(g.tAst.GetNode(i))
+	g.line("{")
+	g.depth++
+	tmp := fmt.Sprintf("tmp%d", g.tmpCount)
+	g.tmpCount++
+	g.line("%s = %s;", g.declare(g.tAst.GetNodeType(match.Expression), tmp), g.expression(match.Expression))
+	if g.isEnum(match.Expression) {
+		g.line("switch (%s)", tmp)
+	} else {
+		g.line("switch (%s.tag)", tmp)
+	}
+	g.line("{")
+	for _, id := range match.Arms {
+		arm := g.tAst.MatchArm(g.tAst.GetNode(id))
+		pattern := g.tAst.Expression(g.tAst.GetNode(arm.Pattern)).Expression
+		variantDecl, isVariant := g.variant(pattern)
+		name := a.Identifier_String(g.tAst.AST, pattern)
+		if isVariant {
+			g.line("case %s_%s:", g.union(g.variants[variantDecl]), name)
+		} else {
+			g.line("case %s:", g.expression(pattern))
+		}
+		g.line("{")
+		g.depth++
+		if arm.Binding != ID.NodeUndefined {
+			g.declareVariable(arm.Binding, tmp+"."+name)
+			if !g.boxed[arm.Binding] {
+				g.line("(void)%s;", a.Identifier_String(g.tAst.AST, arm.Binding))
+			}
+		}
+		for _, stmt := range g.tAst.Block(g.tAst.GetNode(arm.Body)).Statements {
+			g.statement(stmt)
+		}
+		g.line("break;")
+		g.depth--
+		g.line("}")
+	}
+	g.line("default:")
+	g.line("\tabort();")
+	g.line("}")
+	g.depth--
+	g.line("}")
+}
+
+var binaryOperators = map[a.NodeTag]string{
+	ID.NodeOr:                "||",
+	ID.NodeAnd:               "&&",
+	ID.NodeEquals:            "==",
+	ID.NodeNotEquals:         "!=",
+	ID.NodeGreaterThan:       ">",
+	ID.NodeLessThan:          "<",
+	ID.NodeGreaterThanEquals: ">=",
+	ID.NodeLessThanEquals:    "<=",
+	ID.NodeBinaryPlus:        "+",
+	ID.NodeBinaryMinus:       "-",
+	ID.NodeMultiply:          "*",
+	ID.NodeDivide:            "/",
+}
+
+var unaryOperators = map[a.NodeTag]string{
+	ID.NodeUnaryPlus:  "+",
+	ID.NodeUnaryMinus: "-",
+	ID.NodeNot:        "!",
+}
+
+func (g *generator) conversion(target ID.Type, arg ID.Node) string {
+	switch {
+	case target == ID.TypeString && g.isString(arg):
+		return g.expression(arg)
+	case target == ID.TypeString && g.isEnum(arg):
+		return fmt.Sprintf("%s(%s)", nameFunction(g.declare(g.tAst.GetNodeType(arg), "")), g.expression(arg))
+	case target == ID.TypeString && g.isBasic(arg, ID.TypeError):
+		g.usesErrorMessage = true
+		return fmt.Sprintf("some_error_message(%s)", g.expression(arg))
+	case target == ID.TypeError:
+		return fmt.Sprintf("((some_error){true, %s})", g.expression(arg))
+	case target == ID.TypeString:
+		g.usesRuneString = true
+		return fmt.Sprintf("some_rune_string(%s)", g.expression(arg))
+	case target == ID.TypeBool:
+		return g.expression(arg)
+	default:
+		return fmt.Sprintf("((%s)%s)", basicTypes[target], g.expression(arg))
+	}
+}
+
+func (g *generator) expression(i ID.Node) string {
+	n := g.tAst.GetNode(i)
+	if op, isBinary := binaryOperators[n.Tag()]; isBinary {
+		children := a.NodeChildren[n.Tag()](g.tAst.AST, i)
+		lhs, rhs := g.expression(children[0]), g.expression(children[1])
+		if g.isString(children[0]) {
+			if n.Tag() == ID.NodeBinaryPlus {
+				g.usesConcat = true
+				return fmt.Sprintf("some_concat(%s, %s)", lhs, rhs)
+			}
+			return fmt.Sprintf("(strcmp(%s, %s) %s 0)", lhs, rhs, op)
+		}
+		if g.isBasic(children[0], ID.TypeError) {
+			g.usesErrorEq = true
+			if n.Tag() == ID.NodeNotEquals {
+				return fmt.Sprintf("(!some_error_eq(%s, %s))", lhs, rhs)
+			}
+			return fmt.Sprintf("some_error_eq(%s, %s)", lhs, rhs)
+		}
+		return fmt.Sprintf("(%s %s %s)", lhs, op, rhs)
+	}
+	if op, isUnary := unaryOperators[n.Tag()]; isUnary {
+		children := a.NodeChildren[n.Tag()](g.tAst.AST, i)
+		return fmt.Sprintf("(%s%s)", op, g.expression(children[0]))
+	}
+
+	switch n.Tag() {
+	case ID.NodeExpression:
+		return g.expression(g.tAst.Expression(n).Expression)
+	case ID.NodeCall:
+		call := g.tAst.Call(n)
+		if target, isConversion := g.instance.Conversions[call.LhsExpr]; isConversion {
+			return g.conversion(target, g.tAst.ExpressionList(g.tAst.GetNode(call.Arguments)).Expressions[0])
+		}
+		args := make([]string, 0, 4)
+		if call.Arguments != ID.NodeUndefined {
+			for _, arg := range g.tAst.ExpressionList(g.tAst.GetNode(call.Arguments)).Expressions {
+				args = append(args, g.expression(arg))
+			}
+		}
+		if name, isFunction := g.instance.Functions[call.LhsExpr]; isFunction {
+			return fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+		}
+		if g.tAst.GetNode(call.LhsExpr).Tag() == ID.NodeIdentifier {
+			if variantDecl, isVariant := g.variant(call.LhsExpr); isVariant {
+				return g.construct(variantDecl, args...)
+			}
+		}
+		return g.callClosure(g.tAst.GetNodeType(call.LhsExpr), g.expression(call.LhsExpr), args)
+	case ID.NodeFunctionLit:
+		return g.functionLit(i)
+	case ID.NodeOptional:
+		value := g.expression(g.tAst.Optional(n).Unary)
+		return fmt.Sprintf("((%s){true, %s})", g.declare(g.tAst.GetNodeType(i), ""), value)
+	case ID.NodeIdentifier:
+		if _, has := g.names.GetNodeName(i); !has && a.Identifier_String(g.tAst.AST, i) == analysis.None {
+			return fmt.Sprintf("((%s){0})", g.declare(g.tAst.GetNodeType(i), ""))
+		}
+		if memberDecl, isMember := g.member(i); isMember {
+			return g.enum(g.members[memberDecl]) + "_" + a.Identifier_String(g.tAst.AST, i)
+		}
+		if variantDecl, isVariant := g.variant(i); isVariant {
+			if g.payloads[variantDecl] == ID.NodeUndefined {
+				return g.construct(variantDecl)
+			}
+			return g.constructor(variantDecl, g.tAst.GetNodeType(i))
+		}
+		if name, isFunction := g.instance.Functions[i]; isFunction {
+			return g.functionValue(name, g.tAst.GetNodeType(i))
+		}
+		return g.variable(i)
+	// literals are emitted from their decoded values, spelling of C literals is different
+	case ID.NodeIntLiteral:
+		value := g.tAst.IntLiteral(n).Value
+		if value > math.MaxInt64 {
+			return fmt.Sprintf("UINT64_C(%d)", value)
+		}
+		return strconv.FormatUint(value, 10)
+	case ID.NodeFloatLiteral:
+		return cFloat(g.tAst.FloatLiteral(n).Value)
+	case ID.NodeImaginaryLiteral:
+		return fmt.Sprintf("(%s * _Complex_I)", cFloat(g.tAst.ImaginaryLiteral(n).Value))
+	case ID.NodeRuneLiteral:
+		// code point is emitted as a number, C character constants are not unicode aware
+		return strconv.Itoa(int(g.tAst.RuneLiteral(n).Value))
+	case ID.NodeBoolLiteral:
+		return a.BoolLiteral_String(g.tAst.AST, i)
+	case ID.NodeStringLiteral:
+		return cString(g.tAst.StringLiteral(n).Value)
+	default:
+		panic(fmt.Sprintf("Code generation for expression %s is not supported", g.tAst.GetNodeString(i)))
+	}
+}
+
+// cFloat formats value as C double constant
+func cFloat(value float64) string {
+	s := strconv.FormatFloat(value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// cString quotes bytes of the string as C string literal, everything that is
+// not printable is escaped with octal sequences, which have no greedy hex problem
+func cString(value string) string {
+	b := strings.Builder{}
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"' || c == '\\' || c == '?':
+			// question mark is escaped to avoid trigraphs
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString("\\n")
+		case c == '\t':
+			b.WriteString("\\t")
+		case c >= ' ' && c <= '~':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "\\%03o", c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// GenerateC emits C translation unit for the monomorphized program
+func GenerateC(program analysis.MonomorphizationResult) string {
+	g := generator{
+		out:       &strings.Builder{},
+		names:     program.QualifiedNames,
+		captures:  program.Captures,
+		boxed:     make(map[ID.Node]bool),
+		assigned:  make(map[ID.Node]bool),
+		lit:       ID.NodeUndefined,
+		helpers:   make(map[string]bool),
+		typeNames: make(map[string]bool),
+		typeDecls: make(map[ID.Node]ID.Node),
+		variants:  make(map[ID.Node]ID.Node),
+		payloads:  make(map[ID.Node]ID.Node),
+		members:   make(map[ID.Node]ID.Node),
+	}
+	for _, captures := range program.Captures {
+		for _, decl := range captures {
+			g.boxed[decl] = true
+		}
+	}
+	if len(program.Instances) > 0 {
+		tAst := program.Instances[0].TypedAST
+		for i := 0; i < tAst.NodeCount(); i++ {
+			n := tAst.GetNode(ID.Node(i))
+			if n.Tag() != ID.NodeAssignment {
+				continue
+			}
+			for _, lhs := range tAst.ExpressionList(tAst.GetNode(tAst.Assignment(n).LhsList)).Expressions {
+				for tAst.GetNode(lhs).Tag() == ID.NodeExpression {
+					lhs = tAst.Expression(tAst.GetNode(lhs)).Expression
+				}
+				if tAst.GetNode(lhs).Tag() == ID.NodeIdentifier {
+					g.assigned[lhs] = true
+				}
+			}
+		}
+		for _, decl := range tAst.SourceRoot(tAst.GetNode(0)).Declarations {
+			if tAst.GetNode(decl).Tag() != ID.NodeTypeDecl {
+				continue
+			}
+			typeDecl := tAst.TypeDecl(tAst.GetNode(decl))
+			g.typeDecls[typeDecl.Name] = decl
+			if tAst.GetNode(typeDecl.Type).Tag() == ID.NodeEnumType {
+				for _, member := range tAst.EnumType(tAst.GetNode(typeDecl.Type)).Members {
+					g.members[member] = decl
+				}
+				continue
+			}
+			for _, variant := range tAst.UnionType(tAst.GetNode(typeDecl.Type)).Variants {
+				v := tAst.Variant(tAst.GetNode(variant))
+				g.variants[v.Name] = decl
+				g.payloads[v.Name] = v.Payload
+			}
+		}
+	}
+	for _, instance := range program.Instances {
+		g.instance = instance
+		g.tAst = instance.TypedAST
+		g.repo = instance.TypedAST.GetTypeRepo()
+		g.litCount = 0
+		if instance.Name != "main" {
+			g.prototypes.WriteString(g.signature() + ";\n")
+		}
+		g.out.WriteByte('\n')
+		g.function()
+	}
+
+	c := strings.Builder{}
+	c.WriteString(prelude)
+	if g.usesConcat {
+		c.WriteString(concatHelper)
+	}
+	if g.usesRuneString {
+		c.WriteString(runeStringHelper)
+	}
+	if g.usesError {
+		c.WriteString(errorType)
+	}
+	if g.usesErrorEq {
+		c.WriteString(errorEqHelper)
+	}
+	if g.usesErrorMessage {
+		c.WriteString(errorMessageHelper)
+	}
+	c.WriteString(g.typeDefs.String())
+	c.WriteString(g.envDefs.String())
+	c.WriteByte('\n')
+	c.WriteString(g.prototypes.String())
+	c.WriteString(g.lifted.String())
+	c.WriteString(g.out.String())
+	return c.String()
+}
@@ -0,0 +1,581 @@
+package codegen
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"some/analysis"
+	a "some/ast"
+	s "some/syntax"
+	u "some/util"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/utf8string"
+)
+
+func generate(code string) (string, error) {
+	text := utf8string.NewString(code)
+	src := s.NewSource("codegen_test", *text)
+	handler := u.NewHandler()
+
+	check := func() error {
+		if !handler.IsEmpty() {
+			return errors.New(strings.Join(handler.AllErrors(), ""))
+		}
+		return nil
+	}
+
+	tokenizer := s.NewTokenizer(&handler)
+	tokenizer.Tokenize(&src)
+	if err := check(); err != nil {
+		return "", err
+	}
+	parser := a.NewParser(&handler)
+	ast := parser.Parse(&src)
+	if err := check(); err != nil {
+		return "", err
+	}
+	scopeCheckResult := analysis.ScopecheckPass(&src, &ast, &handler)
+	if err := check(); err != nil {
+		return "", err
+	}
+	tAst := analysis.TypeCheckPass(scopeCheckResult, &src, &ast, &handler)
+	if err := check(); err != nil {
+		return "", err
+	}
+	program := analysis.MonomorphizationPass(scopeCheckResult, &src, tAst, &handler)
+	if err := check(); err != nil {
+		return "", err
+	}
+	return GenerateC(program), nil
+}
+
+// runC compiles and runs the program, returning its exit code
+func runC(t *testing.T, c string) int {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("C compiler is not available")
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.c")
+	binary := filepath.Join(dir, "main")
+	if err := os.WriteFile(source, []byte(c), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(cc, "-std=c99", "-Wall", "-Werror", "-o", binary, source).CombinedOutput()
+	if err != nil {
+		t.Fatalf("C compilation failed: %s\n%s", out, c)
+	}
+	err = exec.Command(binary).Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return 0
+}
+
+func TestGeneratePolymorphic(t *testing.T) {
+	code := `
+		fn apply(f, x) {
+			return f(x)
+		}
+
+		fn inc(x) {
+			return x + 1
+		}
+
+		fn twice(s) {
+			return s + s
+		}
+
+		fn main() {
+			const a = apply(inc, 41)
+			const s = apply(twice, "ab")
+			if s == "abab" {
+				return a
+			}
+			return 0
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"apply__int_int", "apply__string_string"} {
+		if !strings.Contains(c, name) {
+			t.Errorf("Expected instance %s in\n%s", name, c)
+		}
+	}
+	if code := runC(t, c); code != 42 {
+		t.Errorf("Expected exit code 42, got %d\n%s", code, c)
+	}
+}
+
+func TestGenerateSizedTypes(t *testing.T) {
+	code := `
+		fn half(x) {
+			return x / 2
+		}
+
+		fn main() {
+			const a = int8(100)
+			const b = a + 20
+			const f = float32(b) * 1.5
+			const c = half(uint16(f))
+			return int(c) - 48
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"#include <stdint.h>", "int8_t b", "float f", "half__uint16"} {
+		if !strings.Contains(c, s) {
+			t.Errorf("Expected %s in\n%s", s, c)
+		}
+	}
+	if code := runC(t, c); code != 42 {
+		t.Errorf("Expected exit code 42, got %d\n%s", code, c)
+	}
+}
+
+func TestGenerateConversions(t *testing.T) {
+	code := `
+		fn main() {
+			const f = 2.7
+			const h = string(72)
+			if h == "H" {
+				return int(f) + int(float(40))
+			}
+			return 1
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"((int64_t)f)", "some_rune_string(72)"} {
+		if !strings.Contains(c, s) {
+			t.Errorf("Expected %s in\n%s", s, c)
+		}
+	}
+	if code := runC(t, c); code != 42 {
+		t.Errorf("Expected exit code 42, got %d\n%s", code, c)
+	}
+}
+
+func TestGenerateMultipleReturn(t *testing.T) {
+	code := `
+		fn divmod(a, b) {
+			return a / b, a - a / b * b
+		}
+
+		fn main() {
+			q, r := divmod(20, 6)
+			var x, y = 0, 0
+			x, y = divmod(r, q)
+			return q * 10 + r + x * 10 + y
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(c, "} some_tup2_int_int;") {
+		t.Errorf("Expected result struct in\n%s", c)
+	}
+	if code := runC(t, c); code != 34 {
+		t.Errorf("Expected exit code 34, got %d\n%s", code, c)
+	}
+}
+
+func TestGenerateClosures(t *testing.T) {
+	code := `
+		fn apply(f, x) {
+			return f(x)
+		}
+
+		fn adder(k) {
+			return fn(x) {
+				return x + k
+			}
+		}
+
+		fn main() {
+			var total = 0
+			const count = fn(x) {
+				total = total + x
+				return total
+			}
+			count(10)
+			count(20)
+			const add2 = adder(2)
+			const twice = fn(x) {
+				return add2(add2(x))
+			}
+			return apply(twice, total) + apply(fn(x) { return x * 0 }, 5) + 6
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"adder__int__lit0_env", "*total__box = 0;"} {
+		if !strings.Contains(c, s) {
+			t.Errorf("Expected %s in\n%s", s, c)
+		}
+	}
+	if code := runC(t, c); code != 40 {
+		t.Errorf("Expected exit code 40, got %d\n%s", code, c)
+	}
+}
+
+func TestGenerateFunctionValues(t *testing.T) {
+	code := `
+		fn inc(x) {
+			return x + 1
+		}
+
+		fn dec(x) {
+			return x - 1
+		}
+
+		fn pick(up) {
+			if up {
+				return inc
+			}
+			return dec
+		}
+
+		fn both() {
+			return inc, dec
+		}
+
+		fn main() {
+			var f = pick(true)
+			const x = f(40)
+			f = pick(false)
+			up, down := both()
+			const ignore = fn(s) { }
+			ignore("x")
+			return up(f(x)) + down(1)
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"int64_t (*fn)(void *, int64_t);",
+		"} some_fn2_int_int;",
+		"some_fn2_int_int _0;",
+		"} some_fn2_string_void;",
+		"static some_fn2_int_int pick__int(bool up)",
+	} {
+		if !strings.Contains(c, s) {
+			t.Errorf("Expected %s in\n%s", s, c)
+		}
+	}
+	if code := runC(t, c); code != 41 {
+		t.Errorf("Expected exit code 41, got %d\n%s", code, c)
+	}
+}
+
+func TestGenerateDefer(t *testing.T) {
+	code := `
+		fn id(x) {
+			return x
+		}
+
+		fn run(push, early) {
+			defer push(1)
+			if early {
+				defer push(2)
+				{
+					if early {
+						return 7
+					}
+				}
+			}
+			defer push(3)
+			defer id(0)
+			return 9
+		}
+
+		fn late(push) {
+			var x = 4
+			defer push(x)
+			x = 5
+			return x
+		}
+
+		fn quiet(push) {
+			defer push(6)
+			push(8)
+		}
+
+		fn main() {
+			var trace = 0
+			const push = fn(d) { trace = trace * 10 + d }
+			const a = run(push, true)
+			const b = run(push, false)
+			const c = late(push)
+			quiet(push)
+			if trace == 2131486 {
+				return a + b + c
+			}
+			return 0
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"goto cleanup;", "cleanup:", "defer0_a0 = x;"} {
+		if !strings.Contains(c, s) {
+			t.Errorf("Expected %s in\n%s", s, c)
+		}
+	}
+	if code := runC(t, c); code != 21 {
+		t.Errorf("Expected exit code 21, got %d\n%s", code, c)
+	}
+}
+
+func TestGenerateOptionals(t *testing.T) {
+	code := `
+		fn find(key) {
+			if key > 0 {
+				return ?(key * 2)
+			}
+			return none
+		}
+
+		fn check(n) {
+			if n > 10 {
+				const reason = "too big"
+				return 0, error(reason)
+			}
+			return n, none
+		}
+
+		fn main() {
+			var total = 0
+			if v, ok := find(4) {
+				total = total + v
+			}
+			if v, ok := find(0) {
+				total = total + 100
+			}
+			n, err := check(5)
+			if err == none {
+				total = total + n
+			}
+			m, failed := check(50)
+			if failed != none {
+				const message = string(failed)
+				if message == "too big" {
+					total = total + m + 1
+				}
+			}
+			return total
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"} some_opt_int;",
+		"} some_error;",
+		"} some_tup2_int_error;",
+		"if (tmp0.ok)",
+	} {
+		if !strings.Contains(c, s) {
+			t.Errorf("Expected %s in\n%s", s, c)
+		}
+	}
+	if code := runC(t, c); code != 14 {
+		t.Errorf("Expected exit code 14, got %d\n%s", code, c)
+	}
+}
+
+func TestGenerateUnions(t *testing.T) {
+	code := `
+		type Shape union {
+			Circle int
+			Square int
+			Empty
+		}
+
+		type Scene union {
+			Single Shape
+			Nothing
+		}
+
+		fn area(s) {
+			match s {
+				Circle(r) => return 3 * r * r
+				Square(a) => {
+					const side = a
+					return side * side
+				}
+				Empty => return 0
+			}
+			return 0
+		}
+
+		fn total(scene) {
+			var sum = 0
+			match scene {
+				Single(s) => {
+					sum = area(s)
+				}
+				Nothing => {
+					sum = 1
+				}
+			}
+			return sum
+		}
+
+		fn main() {
+			const make = Square
+			return area(Circle(2)) + area(make(3)) + area(Empty) + total(Single(Circle(1))) + total(Nothing)
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"} some_Shape_tag;",
+		"} some_Shape;",
+		"some_Shape Single;",
+		"switch (tmp0.tag)",
+		"case some_Shape_Circle:",
+		"static some_Shape some_Shape_Square_new(int64_t payload)",
+	} {
+		if !strings.Contains(c, s) {
+			t.Errorf("Expected %s in\n%s", s, c)
+		}
+	}
+	if code := runC(t, c); code != 25 {
+		t.Errorf("Expected exit code 25, got %d\n%s", code, c)
+	}
+}
+
+func TestGenerateEnums(t *testing.T) {
+	code := `
+		type Color enum { Red, Green, Blue }
+
+		fn next(c) {
+			match c {
+				Red => return Green
+				Green => return Blue
+				Blue => return Red
+			}
+			return c
+		}
+
+		fn main() {
+			const c = next(next(Red))
+			var total = int(c)
+			if c == Blue {
+				total = total + 10
+			}
+			if string(next(c)) == "Red" {
+				total = total + 100
+			}
+			return total
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"typedef enum { some_Color_Red, some_Color_Green, some_Color_Blue } some_Color;",
+		"static inline const char *Color_name(some_Color v)",
+		"switch (tmp0)",
+		"case some_Color_Red:",
+	} {
+		if !strings.Contains(c, s) {
+			t.Errorf("Expected %s in\n%s", s, c)
+		}
+	}
+	if code := runC(t, c); code != 112 {
+		t.Errorf("Expected exit code 112, got %d\n%s", code, c)
+	}
+}
+
+func TestGenerateRunesAndComplex(t *testing.T) {
+	code := `
+		fn main() {
+			var total = 0
+			const r = 'a' + 1
+			if string(r) == "b" {
+				total = total + 1
+			}
+			if 'é' == 233 && '\'' == 39 {
+				total = total + 2
+			}
+			const z = 1 + 2i
+			if z * z == -3 + 4i {
+				total = total + 4
+			}
+			const half = complex(int64(3)) / 2
+			if half == 1.5 && 0i == 0 {
+				total = total + 8
+			}
+			return total
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"#include <complex.h>", "double _Complex z", "(2.0 * _Complex_I)", "int32_t r = (97 + 1);"} {
+		if !strings.Contains(c, s) {
+			t.Errorf("Expected %s in\n%s", s, c)
+		}
+	}
+	if code := runC(t, c); code != 15 {
+		t.Errorf("Expected exit code 15, got %d\n%s", code, c)
+	}
+}
+
+func TestGenerateDecodedLiterals(t *testing.T) {
+	code := `
+		fn main() {
+			var total = 0
+			if 0b1010 + 0o17 + 0x_F + 1_000 == 1040 {
+				total = total + 1
+			}
+			if int8(-128) < 0 && uint64(18446744073709551615) > 0 {
+				total = total + 2
+			}
+			const quoted = "say \"hi\"?\té"
+			if quoted == "say \x22hi\x22?\x09\xc3\xa9" {
+				total = total + 4
+			}
+			if 1_0.5e1 == 105 && 017 == 15 {
+				total = total + 8
+			}
+			return total
+		}
+	`
+	c, err := generate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"UINT64_C(18446744073709551615)", `"say \"hi\"\?\t\303\251"`, "105.0"} {
+		if !strings.Contains(c, s) {
+			t.Errorf("Expected %s in\n%s", s, c)
+		}
+	}
+	if code := runC(t, c); code != 15 {
+		t.Errorf("Expected exit code 15, got %d\n%s", code, c)
+	}
+}
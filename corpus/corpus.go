@@ -0,0 +1,53 @@
+// Package corpus gives tests the sources of the testdata directories
+package corpus
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// dirs are relative to the module root
+var dirs = []string{"testdata", filepath.Join("analysis", "testdata")}
+
+type Source struct {
+	// Name is the path relative to the module root
+	Name string
+	Code string
+}
+
+// root returns the module root, tests run in the directories of their packages
+func root() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(filepath.Dir(file))
+}
+
+// Sources returns sources of the testdata directories
+func Sources(tb testing.TB) []Source {
+	sources := []Source{}
+	for _, dir := range dirs {
+		paths, err := filepath.Glob(filepath.Join(root(), dir, "*.some"))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if len(paths) == 0 {
+			tb.Fatalf("no sources in %s", dir)
+		}
+		for _, path := range paths {
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			sources = append(sources, Source{filepath.Join(dir, filepath.Base(path)), string(contents)})
+		}
+	}
+	return sources
+}
+
+// Seed adds sources of the testdata directories to the corpus of the fuzz target
+func Seed(f *testing.F) {
+	for _, source := range Sources(f) {
+		f.Add(source.Code)
+	}
+}
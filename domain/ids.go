@@ -31,6 +31,7 @@ const (
 	TokenWS                 = antlr_parser.SomeWS
 	TokenTerminator         = antlr_parser.SomeTERMINATOR
 	TokenLineComment        = antlr_parser.SomeLINE_COMMENT
+	TokenBlockComment       = antlr_parser.SomeBLOCK_COMMENT
 )
 
 type Node int
@@ -45,16 +46,25 @@ const (
 	NodeBlock
 
 	NodeFunctionDecl
+	NodeTypeDecl
+	NodeUnionType
+	NodeVariant
+	NodeEnumType
 	NodeSignature
 	NodeConstDecl
 	NodeVarDecl
+	NodeShortVarDecl
 	NodeAssignment
 	NodeReturnStmt
 	NodeIfStmt
+	NodeDeferStmt
+	NodeMatch
+	NodeMatchArm
 
 	NodeExpression
 	NodeSelector
 	NodeCall
+	NodeFunctionLit
 
 	NodeOr
 	NodeAnd
@@ -72,9 +82,12 @@ const (
 	NodeUnaryPlus
 	NodeUnaryMinus
 	NodeNot
+	NodeOptional
 
 	NodeIntLiteral
 	NodeFloatLiteral
+	NodeImaginaryLiteral
+	NodeRuneLiteral
 	NodeStringLiteral
 	NodeBoolLiteral
 	NodeIdentifier
@@ -90,6 +103,8 @@ const (
 	KindIdentity Kind = iota
 	KindPtr
 	KindFunction
+	KindTuple
+	KindOptional
 )
 
 type Type int
@@ -102,4 +117,21 @@ const (
 	TypeFloat
 	TypeBool
 	TypeString
+	TypeVoid
+	TypeInt8
+	TypeInt16
+	TypeInt32
+	TypeInt64
+	TypeUint8
+	TypeUint16
+	TypeUint32
+	TypeUint64
+	TypeUintptr
+	TypeFloat32
+	TypeFloat64
+	TypeError
+	TypeComplex
 )
+
+// TypeLast is the last one of the basic types
+const TypeLast = TypeComplex
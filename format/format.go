@@ -0,0 +1,393 @@
+package format
+
+import (
+	a "some/ast"
+	ID "some/domain"
+	s "some/syntax"
+	"strings"
+)
+
+// NOTE: formatter prints the AST, not the tokens, so everything that is not
+// in the AST is lost except comments, those are attached to the closest
+// line item (declaration, statement, variant, match arm) by their position
+// in the source: comments before an item are printed on separate lines above
+// it, a comment on the last line of an item that follows its last token is
+// printed after it and a comment after the opening brace stays on its line
+
+type formatter struct {
+	src      *s.Source
+	ast      *a.AST
+	comments []s.Comment
+	// first comment that is not printed yet
+	next int
+
+	out   *strings.Builder
+	depth int
+	// blank line is not printed before the first item of a block
+	fresh bool
+	// source line where the last printed item ends
+	prevLine int
+}
+
+// Format returns canonical source of the AST, source must be the one
+// the AST was parsed from, formatting is idempotent
+func Format(src *s.Source, ast *a.AST) string {
+	f := formatter{
+		src:      src,
+		ast:      ast,
+		comments: src.Comments(),
+		out:      &strings.Builder{},
+		fresh:    true,
+	}
+
+	root := ast.SourceRoot(ast.GetNode(0))
+	for _, decl := range root.Declarations {
+		if f.out.Len() > 0 {
+			// declarations are always separated by a single blank line
+			f.out.WriteByte('\n')
+			f.fresh = true
+		}
+		f.item(decl, false, f.declaration)
+	}
+	f.leading(-1)
+	return f.out.String()
+}
+
+func (f *formatter) line(text string) {
+	f.out.WriteString(strings.Repeat("\t", f.depth))
+	f.out.WriteString(text)
+	f.out.WriteByte('\n')
+}
+
+// gap keeps a single blank line if there was one in the source
+func (f *formatter) gap(line int) {
+	if !f.fresh && line > f.prevLine+1 {
+		f.out.WriteByte('\n')
+	}
+	f.fresh = false
+}
+
+// leading prints comments that start before the offset, all of them if it is negative
+func (f *formatter) leading(offset int) {
+	for f.next < len(f.comments) {
+		c := f.comments[f.next]
+		if offset >= 0 && c.Start >= offset {
+			break
+		}
+		f.gap(c.Line)
+		f.line(f.src.CommentText(c))
+		f.prevLine = c.EndLine
+		f.next++
+	}
+}
+
+// item prints line item with its comments, commas separate items of the list
+func (f *formatter) item(i ID.Node, commas bool, render func(ID.Node) string) {
+	first := f.ast.GetNode(i).Token()
+	t := f.src.Token(first)
+	f.leading(t.Start)
+	f.gap(t.Line)
+
+	text := render(i)
+	lastToken := f.lastToken(first, commas)
+	text += f.trailing(lastToken)
+	f.line(text)
+}
+
+// trailing returns comments on the line of the token that follow it, comments
+// after the tokens that come next belong to the items of those tokens
+func (f *formatter) trailing(i ID.Token) string {
+	text := ""
+	last := f.src.Token(i).Line
+	f.prevLine = last
+	for f.next < len(f.comments) {
+		c := f.comments[f.next]
+		if c.Line != last || c.Start > f.src.Token(f.following(i)).Start {
+			break
+		}
+		text += " " + f.src.CommentText(c)
+		last = c.EndLine
+		f.prevLine = last
+		f.next++
+	}
+	return text
+}
+
+// following returns the first token after the one that is not a separator
+func (f *formatter) following(i ID.Token) ID.Token {
+	for i++; ; i++ {
+		t := f.src.Token(i)
+		if t.Tag == ID.TokenEOF || (t.Tag != ID.TokenTerminator && f.src.Lexeme(i) != ",") {
+			return i
+		}
+	}
+}
+
+// lastToken returns the last token of the item starting at the token
+func (f *formatter) lastToken(first ID.Token, commas bool) ID.Token {
+	depth := 0
+	last := first
+	for i := first; ; i++ {
+		t := f.src.Token(i)
+		if t.Tag == ID.TokenEOF {
+			break
+		}
+		lexeme := f.src.Lexeme(i)
+		if depth == 0 && (t.Tag == ID.TokenTerminator || (commas && lexeme == ",")) {
+			break
+		}
+		if t.Tag == ID.TokenPunctuation {
+			if lexeme == "{" || lexeme == "(" {
+				depth++
+			} else if lexeme == "}" || lexeme == ")" {
+				depth--
+				if depth < 0 {
+					break
+				}
+			}
+		}
+		last = i
+	}
+	return last
+}
+
+// opening returns the first opening brace at or after the token
+func (f *formatter) opening(i ID.Token) ID.Token {
+	for f.src.Lexeme(i) != "{" {
+		i++
+	}
+	return i
+}
+
+// closing returns matching closing brace of the first opening brace
+// at or after the token
+func (f *formatter) closing(i ID.Token) ID.Token {
+	i = f.opening(i)
+	depth := 0
+	for ; ; i++ {
+		if f.src.Token(i).Tag != ID.TokenPunctuation {
+			continue
+		}
+		switch f.src.Lexeme(i) {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+}
+
+// braces prints items inside of the braces one per line, open is the token
+// at or before the opening brace
+func (f *formatter) braces(open ID.Token, items []ID.Node, commas bool, render func(ID.Node) string) string {
+	out, fresh, prevLine := f.out, f.fresh, f.prevLine
+	f.out, f.fresh = &strings.Builder{}, true
+	opening := f.trailing(f.opening(open))
+	f.depth++
+
+	for _, i := range items {
+		f.item(i, commas, render)
+	}
+	f.leading(f.src.Token(f.closing(open)).Start)
+
+	f.depth--
+	text := "{" + opening + "\n" + f.out.String() + strings.Repeat("\t", f.depth) + "}"
+	f.out, f.fresh, f.prevLine = out, fresh, prevLine
+	return text
+}
+
+func (f *formatter) declaration(i ID.Node) string {
+	n := f.ast.GetNode(i)
+	switch n.Tag() {
+	case ID.NodeFunctionDecl:
+		decl := f.ast.FunctionDecl(n)
+		text := "fn " + f.expression(decl.Name) + f.signature(decl.Signature)
+		if decl.Body != ID.NodeUndefined {
+			text += " " + f.block(decl.Body)
+		}
+		return text
+	case ID.NodeTypeDecl:
+		decl := f.ast.TypeDecl(f.ast.GetNode(i))
+		return "type " + f.expression(decl.Name) + " " + f.typeExpr(decl.Type)
+	}
+	panic("unexpected declaration " + f.ast.GetNodeString(i))
+}
+
+func (f *formatter) typeExpr(i ID.Node) string {
+	n := f.ast.GetNode(i)
+	switch n.Tag() {
+	case ID.NodeUnionType:
+		return "union " + f.braces(n.Token(), f.ast.UnionType(n).Variants, false, f.variant)
+	case ID.NodeEnumType:
+		return "enum " + f.braces(n.Token(), f.ast.EnumType(n).Members, true, f.expression)
+	}
+	panic("unexpected type " + f.ast.GetNodeString(i))
+}
+
+func (f *formatter) variant(i ID.Node) string {
+	variant := f.ast.Variant(f.ast.GetNode(i))
+	text := f.expression(variant.Name)
+	if variant.Payload != ID.NodeUndefined {
+		text += " " + f.expression(variant.Payload)
+	}
+	return text
+}
+
+func (f *formatter) signature(i ID.Node) string {
+	signature := f.ast.Signature(f.ast.GetNode(i))
+	return "(" + f.list(signature.Parameters) + ")"
+}
+
+func (f *formatter) block(i ID.Node) string {
+	n := f.ast.GetNode(i)
+	return f.braces(n.Token(), f.ast.Block(n).Statements, false, f.statement)
+}
+
+func (f *formatter) statement(i ID.Node) string {
+	n := f.ast.GetNode(i)
+	switch n.Tag() {
+	case ID.NodeConstDecl:
+		decl := f.ast.ConstDecl(n)
+		return "const " + f.list(decl.IdentifierList) + " = " + f.list(decl.ExpressionList)
+	case ID.NodeVarDecl:
+		decl := f.ast.VarDecl(n)
+		return "var " + f.list(decl.IdentifierList) + " = " + f.list(decl.ExpressionList)
+	case ID.NodeShortVarDecl:
+		decl := f.ast.ShortVarDecl(n)
+		return f.list(decl.IdentifierList) + " := " + f.list(decl.ExpressionList)
+	case ID.NodeAssignment:
+		assignment := f.ast.Assignment(n)
+		return f.list(assignment.LhsList) + " = " + f.list(assignment.RhsList)
+	case ID.NodeReturnStmt:
+		return "return " + f.list(f.ast.ReturnStmt(n).ExpressionList)
+	case ID.NodeIfStmt:
+		stmt := f.ast.IfStmt(n)
+		var condition string
+		if f.ast.GetNode(stmt.Expression).Tag() == ID.NodeShortVarDecl {
+			condition = f.statement(stmt.Expression)
+		} else {
+			condition = f.expression(stmt.Expression)
+		}
+		return "if " + condition + " " + f.block(stmt.Block)
+	case ID.NodeDeferStmt:
+		return "defer " + f.expression(f.ast.DeferStmt(n).Expression)
+	case ID.NodeMatch:
+		match := f.ast.Match(n)
+		return "match " + f.expression(match.Expression) + " " + f.braces(n.Token(), match.Arms, true, f.arm)
+	case ID.NodeBlock:
+		return f.block(i)
+	}
+	return f.expression(i)
+}
+
+func (f *formatter) arm(i ID.Node) string {
+	arm := f.ast.MatchArm(f.ast.GetNode(i))
+	text := f.expression(arm.Pattern)
+	if arm.Binding != ID.NodeUndefined {
+		text += "(" + f.expression(arm.Binding) + ")"
+	}
+	body := f.ast.GetNode(arm.Body)
+	if f.src.Lexeme(body.Token()) != "{" {
+		// single statement body was written without braces
+		return text + " => " + f.statement(f.ast.Block(body).Statements[0])
+	}
+	return text + " => " + f.block(arm.Body)
+}
+
+// list prints identifier or expression list
+func (f *formatter) list(i ID.Node) string {
+	n := f.ast.GetNode(i)
+	var items []ID.Node
+	if n.Tag() == ID.NodeIdentifierList {
+		items = f.ast.IdentifierList(n).Identifiers
+	} else {
+		items = f.ast.ExpressionList(n).Expressions
+	}
+	texts := make([]string, len(items))
+	for k, item := range items {
+		texts[k] = f.expression(item)
+	}
+	return strings.Join(texts, ", ")
+}
+
+func (f *formatter) expression(i ID.Node) string {
+	n := f.ast.GetNode(i)
+	switch n.Tag() {
+	case ID.NodeExpression:
+		return f.expression(f.ast.Expression(n).Expression)
+	case ID.NodeSelector:
+		selector := f.ast.Selector(n)
+		return f.operand(selector.LhsExpr) + "." + f.expression(selector.Identifier)
+	case ID.NodeCall:
+		call := f.ast.Call(n)
+		args := ""
+		if call.Arguments != ID.NodeUndefined {
+			args = f.list(call.Arguments)
+		}
+		return f.operand(call.LhsExpr) + "(" + args + ")"
+	case ID.NodeFunctionLit:
+		lit := f.ast.FunctionLit(n)
+		return "fn" + f.signature(lit.Signature) + " " + f.block(lit.Body)
+	case ID.NodeIdentifier, ID.NodeIntLiteral, ID.NodeFloatLiteral, ID.NodeImaginaryLiteral,
+		ID.NodeRuneLiteral, ID.NodeStringLiteral, ID.NodeBoolLiteral:
+		return f.src.Lexeme(n.Token())
+	}
+
+	if lexeme, precedence, ok := a.BinaryOperator(n.Tag()); ok {
+		children := a.NodeChildren[n.Tag()](*f.ast, i)
+		lhs, rhs := f.binaryOperand(children[0], precedence, false), f.binaryOperand(children[1], precedence, true)
+		return lhs + " " + lexeme + " " + rhs
+	}
+	if lexeme, ok := a.UnaryOperator(n.Tag()); ok {
+		operand := a.NodeChildren[n.Tag()](*f.ast, i)[0]
+		text := f.unaryOperand(operand)
+		if (lexeme == "-" || lexeme == "+") && strings.HasPrefix(text, lexeme) {
+			// `- -x` is not a decrement
+			lexeme += " "
+		}
+		return lexeme + text
+	}
+	panic("unexpected expression " + f.ast.GetNodeString(i))
+}
+
+// inner skips parentheses
+func (f *formatter) inner(i ID.Node) ID.Node {
+	for f.ast.GetNode(i).Tag() == ID.NodeExpression {
+		i = f.ast.Expression(f.ast.GetNode(i)).Expression
+	}
+	return i
+}
+
+func (f *formatter) parenthesized(i ID.Node, needed bool) string {
+	if needed {
+		return "(" + f.expression(i) + ")"
+	}
+	return f.expression(i)
+}
+
+// binaryOperand keeps parentheses which change the order of evaluation,
+// as all operators are left associative it is the case for the operator of
+// lower precedence or the operator of the same precedence on the right
+func (f *formatter) binaryOperand(i ID.Node, precedence int, right bool) string {
+	_, inner, ok := a.BinaryOperator(f.ast.GetNode(f.inner(i)).Tag())
+	return f.parenthesized(i, ok && (inner < precedence || (right && inner == precedence)))
+}
+
+func (f *formatter) unaryOperand(i ID.Node) string {
+	_, _, ok := a.BinaryOperator(f.ast.GetNode(f.inner(i)).Tag())
+	return f.parenthesized(i, ok)
+}
+
+// operand keeps parentheses around anything but operands, because
+// selector and call apply to the operand only
+func (f *formatter) operand(i ID.Node) string {
+	switch f.ast.GetNode(f.inner(i)).Tag() {
+	case ID.NodeIdentifier, ID.NodeIntLiteral, ID.NodeFloatLiteral, ID.NodeImaginaryLiteral,
+		ID.NodeRuneLiteral, ID.NodeStringLiteral, ID.NodeBoolLiteral, ID.NodeFunctionLit:
+		return f.expression(i)
+	}
+	return "(" + f.expression(i) + ")"
+}
@@ -0,0 +1,306 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	a "some/ast"
+	ID "some/domain"
+	s "some/syntax"
+	u "some/util"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/utf8string"
+)
+
+func parse(code string) (*s.Source, *a.AST, error) {
+	text := utf8string.NewString(code)
+	src := s.NewSource("format_test", *text)
+	handler := u.NewHandler()
+
+	tokenizer := s.NewTokenizer(&handler)
+	tokenizer.Tokenize(&src)
+	if !handler.IsEmpty() {
+		return nil, nil, errors.New(strings.Join(handler.AllErrors(), ""))
+	}
+	parser := a.NewParser(&handler)
+	ast := parser.Parse(&src)
+	if !handler.IsEmpty() {
+		return nil, nil, errors.New(strings.Join(handler.AllErrors(), ""))
+	}
+	return &src, &ast, nil
+}
+
+func format(code string) (string, error) {
+	src, ast, err := parse(code)
+	if err != nil {
+		return "", err
+	}
+	return Format(src, ast), nil
+}
+
+// dump skips expression nodes, they only group their operand, so sources
+// that differ in redundant parentheses have the same dump
+func dump(ast *a.AST) string {
+	str := strings.Builder{}
+	ast.TraversePreorder(func(ast *a.AST, i ID.Node) bool {
+		if ast.GetNode(i).Tag() != ID.NodeExpression {
+			str.WriteString("(" + ast.GetNodeString(i))
+		}
+		return false
+	}, func(ast *a.AST, i ID.Node) bool {
+		if ast.GetNode(i).Tag() != ID.NodeExpression {
+			str.WriteByte(')')
+		}
+		return false
+	})
+	return str.String()
+}
+
+// anchors describes where the comments are: the token before the comment and
+// if the comment is on its line, comments followed by tokens on the same line
+// are moved to the end of the line, so they are not described
+func anchors(src *s.Source) []string {
+	result := []string{}
+	for _, c := range src.Comments() {
+		before, sameLine, ends := "", false, true
+		for i := 0; i < src.TokenCount(); i++ {
+			t := src.Token(ID.Token(i))
+			if t.Tag == ID.TokenEOF {
+				break
+			}
+			if t.Tag == ID.TokenTerminator {
+				continue
+			}
+			if t.Start > c.Start {
+				ends = t.Line > c.EndLine
+				break
+			}
+			before, sameLine = src.Lexeme(ID.Token(i)), t.Line == c.Line
+		}
+		anchor := ""
+		if ends {
+			anchor = fmt.Sprintf("%s after %q on the same line %v", src.CommentText(c), before, sameLine)
+		}
+		result = append(result, anchor)
+	}
+	return result
+}
+
+// roundTrip checks that formatted code parses to the same AST, comments follow
+// the same tokens and formatting is idempotent
+func roundTrip(code string) (string, error) {
+	src, ast, err := parse(code)
+	if err != nil {
+		return "", err
+	}
+	formatted, err := format(code)
+	if err != nil {
+		return "", err
+	}
+	formattedSrc, formattedAst, err := parse(formatted)
+	if err != nil {
+		return "", fmt.Errorf("formatted code doesn't parse:\n%s\n%s", formatted, err)
+	}
+	if lhs, rhs := dump(ast), dump(formattedAst); lhs != rhs {
+		return "", fmt.Errorf("AST are not equal\n%s\n%s", u.FormatSExpr(lhs), u.FormatSExpr(rhs))
+	}
+	lhs, rhs := anchors(src), anchors(formattedSrc)
+	if len(lhs) != len(rhs) {
+		return "", fmt.Errorf("expected %d comments, got %d in\n%s", len(lhs), len(rhs), formatted)
+	}
+	for k := range lhs {
+		if lhs[k] != "" && lhs[k] != rhs[k] {
+			return "", fmt.Errorf("comment moved in\n%s\nexpected %s\ngot %s", formatted, lhs[k], rhs[k])
+		}
+	}
+	again, err := format(formatted)
+	if err != nil {
+		return "", err
+	}
+	if again != formatted {
+		return "", fmt.Errorf("formatting is not idempotent\n%s\n%s", formatted, again)
+	}
+	return formatted, nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	codes := []string{`
+		fn main() {
+			const a, b = 1, 2.5
+			var s = "hello"
+			x, y := a * (b + 1), -(a - b)
+			x = x - (y - 1) / 2 * a
+			if ok := x > y || x == 0 && !(y < 1) {
+				return x
+			}
+			return y
+		}
+	`, `
+		fn apply(f, x) {
+			defer print("done")
+			add := fn(a, b) {
+				return a + b
+			}
+			{
+				z := fn(y) { return y }(x)
+				f(f(x), add(z, 'a'), 1i)
+			}
+			return add(x, 0x_ff)
+		}
+		fn extern(a, b)
+	`, `
+		type Shape union {
+			Circle float
+			Square int
+			Empty
+		}
+		type Color enum { Red, Green, Blue }
+		fn area(s, c) {
+			match c {
+				Red => return 1
+				Green => {
+					print(string(c))
+				}
+				Blue => return 3
+			}
+			match s {
+				Circle(r) => return r * r
+				Square(a) => {
+					b := a * a
+					return b
+				}
+				Empty => return 0
+			}
+		}
+	`, `
+		fn parens(f, x) {
+			y := ((1 + 2)) * ((x))
+			z := -((y)) - (-(x - 1))
+			(f)((y), (z))
+			if ((y > z)) {
+				return (x)
+			}
+			return ((f)(x)) + (((y)))
+		}
+	`}
+	for _, code := range codes {
+		if _, err := roundTrip(code); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	code := `
+		type Color enum { Red, Green }
+		fn main() { x := ((1 + 2)) + (3 * 4); if (x > 1) { return (x) - (1 - 2) }
+		return (f)(x) }
+	`
+	expected := `type Color enum {
+	Red
+	Green
+}
+
+fn main() {
+	x := 1 + 2 + 3 * 4
+	if x > 1 {
+		return x - (1 - 2)
+	}
+	return f(x)
+}
+`
+	formatted, err := format(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, formatted)
+	}
+	if _, err := roundTrip(code); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	code := `
+// main is the entry point
+/* of the
+   program */
+fn main() {
+	// leading
+	x := 1 // trailing
+
+
+	/* after a blank line */ y := 2
+	match x {
+		// arm
+		Some => return x // of the arm
+	}
+	return x + y
+	// closing
+}
+// the end
+`
+	expected := `// main is the entry point
+/* of the
+   program */
+fn main() {
+	// leading
+	x := 1 // trailing
+
+	/* after a blank line */
+	y := 2
+	match x {
+		// arm
+		Some => return x // of the arm
+	}
+	return x + y
+	// closing
+}
+// the end
+`
+	formatted, err := format(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, formatted)
+	}
+	if _, err := roundTrip(code); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFormatTrailingComments(t *testing.T) {
+	code := `
+fn main() { // opening
+	if x { return 1 } // after the block
+	match x { Some => return x, None => return 0 } // after the match
+	y := 1 + /* inside */ 2
+	return y
+}
+`
+	expected := `fn main() { // opening
+	if x {
+		return 1
+	} // after the block
+	match x {
+		Some => return x
+		None => return 0
+	} // after the match
+	y := 1 + 2 /* inside */
+	return y
+}
+`
+	formatted, err := format(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, formatted)
+	}
+	if _, err := roundTrip(code); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,390 @@
+package gen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// NOTE: programs are well-typed by construction, every value has the type
+// chosen by generator and every parameter is used at its type right at the
+// start of the function, so inference has nothing left unresolved.
+// Programs always terminate: functions call only the functions declared
+// before them and there are no loops. Integer division is only by positive
+// literal, so there is no division by zero, but overflow is possible
+
+const (
+	maxFunctions  = 5
+	maxParams     = 3
+	maxStatements = 4
+	maxBlockDepth = 2
+	maxExprDepth  = 3
+	// function literals are not nested deeper
+	maxNesting = 2
+)
+
+type kind int
+
+const (
+	kindInt kind = iota
+	kindFloat
+	kindBool
+	kindString
+	kindFunction
+)
+
+var basicKinds = [...]kind{kindInt, kindFloat, kindBool, kindString}
+
+// typ is the type of generated value, functions take and return only basic types
+type typ struct {
+	kind   kind
+	params []*typ
+	result *typ
+}
+
+func basic(k kind) *typ {
+	return &typ{kind: k}
+}
+
+func (t *typ) equals(other *typ) bool {
+	if t.kind != other.kind || len(t.params) != len(other.params) {
+		return false
+	}
+	if t.kind != kindFunction {
+		return true
+	}
+	for i := range t.params {
+		if !t.params[i].equals(other.params[i]) {
+			return false
+		}
+	}
+	return t.result.equals(other.result)
+}
+
+type value struct {
+	name string
+	t    *typ
+	// declared with var, so it can be assigned
+	mutable bool
+}
+
+type generator struct {
+	rnd    *rand.Rand
+	out    *strings.Builder
+	indent int
+	// top level functions in the order of declaration
+	functions []value
+	// visible variables, the ones before start belong to enclosing functions
+	scope   []value
+	start   int
+	nesting int
+	names   int
+}
+
+// Generate returns random well-typed program, the same seed gives the same program
+func Generate(seed int64) string {
+	g := generator{rnd: rand.New(rand.NewSource(seed)), out: &strings.Builder{}}
+	for i := g.rnd.Intn(maxFunctions) + 1; i > 0; i-- {
+		g.function()
+	}
+	g.main()
+	return g.out.String()
+}
+
+func (g *generator) name(prefix string) string {
+	g.names++
+	return fmt.Sprintf("%s%d", prefix, g.names)
+}
+
+func (g *generator) line(format string, args ...any) {
+	g.out.WriteString(strings.Repeat("\t", g.indent))
+	fmt.Fprintf(g.out, format, args...)
+	g.out.WriteByte('\n')
+}
+
+func (g *generator) randomType(functions bool) *typ {
+	if functions && g.rnd.Intn(4) == 0 {
+		t := &typ{kind: kindFunction, result: g.randomType(false)}
+		for i := g.rnd.Intn(2) + 1; i > 0; i-- {
+			t.params = append(t.params, g.randomType(false))
+		}
+		return t
+	}
+	return basic(basicKinds[g.rnd.Intn(len(basicKinds))])
+}
+
+func (g *generator) params(t *typ) []value {
+	params := make([]value, len(t.params))
+	for i, p := range t.params {
+		params[i] = value{name: g.name("p"), t: p}
+	}
+	return params
+}
+
+func names(values []value) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = v.name
+	}
+	return strings.Join(s, ", ")
+}
+
+func (g *generator) function() {
+	t := &typ{kind: kindFunction, result: g.randomType(false)}
+	for i := g.rnd.Intn(maxParams + 1); i > 0; i-- {
+		t.params = append(t.params, g.randomType(true))
+	}
+	name := g.name("f")
+	params := g.params(t)
+	g.line("fn %s(%s) {", name, names(params))
+	g.indent++
+	g.body(params, t.result)
+	g.indent--
+	g.line("}")
+	g.line("")
+	// declared after the body, so there is no recursion
+	g.functions = append(g.functions, value{name: name, t: t})
+}
+
+func (g *generator) main() {
+	g.line("fn main() {")
+	g.indent++
+	g.body(nil, basic(kindInt))
+	g.indent--
+	g.line("}")
+}
+
+// body uses the params, generates statements and returns the result
+func (g *generator) body(params []value, result *typ) {
+	outer, start := len(g.scope), g.start
+	g.start = outer
+	g.scope = append(g.scope, params...)
+	for _, p := range params {
+		expr, t := g.use(p.name, p.t)
+		g.declare("const", expr, t)
+	}
+	if g.nesting < maxNesting {
+		g.statements(result, g.nesting)
+	}
+	g.line("return %s", g.expression(result, maxExprDepth))
+	g.scope, g.start = g.scope[:outer], start
+}
+
+// use returns expression of basic type that fixes the type of the value
+func (g *generator) use(expr string, t *typ) (string, *typ) {
+	switch t.kind {
+	case kindInt:
+		return expr + " + 0", t
+	case kindFloat:
+		return expr + " + 0.0", t
+	case kindBool:
+		return expr + " && true", t
+	case kindString:
+		return expr + ` + ""`, t
+	}
+	args := make([]string, len(t.params))
+	for i, p := range t.params {
+		args[i] = g.literal(p)
+	}
+	return g.use(fmt.Sprintf("%s(%s)", expr, strings.Join(args, ", ")), t.result)
+}
+
+// declare writes declaration of the new variable with const, var or :=
+func (g *generator) declare(form string, expr string, t *typ) {
+	v := value{name: g.name("v"), t: t, mutable: form != "const"}
+	if form == ":=" {
+		g.line("%s := %s", v.name, expr)
+	} else {
+		g.line("%s %s = %s", form, v.name, expr)
+	}
+	g.scope = append(g.scope, v)
+}
+
+func (g *generator) statements(result *typ, depth int) {
+	for i := g.rnd.Intn(maxStatements) + 1; i > 0; i-- {
+		g.statement(result, depth)
+	}
+}
+
+func (g *generator) statement(result *typ, depth int) {
+	choice := g.rnd.Intn(6)
+	if choice == 0 && depth < maxBlockDepth {
+		g.line("if %s {", g.expression(basic(kindBool), maxExprDepth))
+		g.indent++
+		outer := len(g.scope)
+		g.statements(result, depth+1)
+		if g.rnd.Intn(2) == 0 {
+			g.line("return %s", g.expression(result, maxExprDepth))
+		}
+		g.scope = g.scope[:outer]
+		g.indent--
+		g.line("}")
+		return
+	}
+	if choice == 1 {
+		if v, ok := g.pick(g.scope[g.start:], func(v value) bool { return v.mutable }); ok {
+			g.line("%s = %s", v.name, g.expression(v.t, maxExprDepth))
+			return
+		}
+	}
+	if choice == 2 {
+		if call, ok := g.call(nil, maxExprDepth); ok {
+			g.line("%s", call)
+			return
+		}
+	}
+
+	t := g.randomType(g.nesting == 0)
+	expr := g.expression(t, maxExprDepth)
+	switch {
+	case t.kind == kindFunction || g.rnd.Intn(3) == 0:
+		g.declare("const", expr, t)
+	case g.rnd.Intn(2) == 0:
+		g.declare("var", expr, t)
+	default:
+		g.declare(":=", expr, t)
+	}
+}
+
+// pick returns random value satisfying the predicate
+func (g *generator) pick(values []value, ok func(value) bool) (value, bool) {
+	candidates := []value{}
+	for _, v := range values {
+		if ok(v) {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		return value{}, false
+	}
+	return candidates[g.rnd.Intn(len(candidates))], true
+}
+
+// call returns call of a function returning the result, any result if it is nil
+func (g *generator) call(result *typ, depth int) (string, bool) {
+	callable := func(v value) bool {
+		if v.t.kind != kindFunction || (result != nil && !v.t.result.equals(result)) {
+			return false
+		}
+		for _, p := range v.t.params {
+			if p.kind == kindFunction && g.nesting >= maxNesting {
+				return false
+			}
+		}
+		return true
+	}
+	f, ok := g.pick(append(append([]value{}, g.functions...), g.scope...), callable)
+	if !ok {
+		return "", false
+	}
+	args := make([]string, len(f.t.params))
+	for i, p := range f.t.params {
+		args[i] = g.expression(p, depth-1)
+	}
+	return fmt.Sprintf("%s(%s)", f.name, strings.Join(args, ", ")), true
+}
+
+func (g *generator) expression(t *typ, depth int) string {
+	if t.kind == kindFunction {
+		return g.functionValue(t)
+	}
+	if depth <= 0 || g.rnd.Intn(4) == 0 {
+		return g.leaf(t)
+	}
+	if g.rnd.Intn(4) == 0 {
+		if call, ok := g.call(t, depth); ok {
+			return call
+		}
+	}
+
+	sub := func(t *typ) string { return g.expression(t, depth-1) }
+	binary := func(operand *typ, ops ...string) string {
+		lhs, rhs := sub(operand), sub(operand)
+		if lhs == rhs {
+			// C compiler warns about comparison of the value with itself
+			rhs = g.literal(operand)
+		}
+		return fmt.Sprintf("(%s %s %s)", lhs, ops[g.rnd.Intn(len(ops))], rhs)
+	}
+	switch t.kind {
+	case kindInt:
+		switch g.rnd.Intn(5) {
+		case 0:
+			return fmt.Sprintf("(%s * %d)", sub(t), g.rnd.Intn(10))
+		case 1:
+			return fmt.Sprintf("(%s / %d)", sub(t), g.rnd.Intn(9)+1)
+		case 2:
+			return fmt.Sprintf("-(%s)", sub(t))
+		case 3:
+			return fmt.Sprintf("int(%s)", sub(basic(kindFloat)))
+		}
+		return binary(t, "+", "-")
+	case kindFloat:
+		switch g.rnd.Intn(4) {
+		case 0:
+			return fmt.Sprintf("(%s * %s)", sub(t), g.literal(t))
+		case 1:
+			return fmt.Sprintf("-(%s)", sub(t))
+		case 2:
+			return fmt.Sprintf("float(%s)", sub(basic(kindInt)))
+		}
+		return binary(t, "+", "-")
+	case kindBool:
+		switch g.rnd.Intn(4) {
+		case 0:
+			return fmt.Sprintf("!(%s)", sub(t))
+		case 1:
+			return binary(t, "&&", "||")
+		case 2:
+			return binary(basic(basicKinds[g.rnd.Intn(2)]), "<", ">", "<=", ">=", "==", "!=")
+		}
+		return binary(basic(basicKinds[2+g.rnd.Intn(2)]), "==", "!=")
+	}
+	return binary(t, "+")
+}
+
+func (g *generator) leaf(t *typ) string {
+	if g.rnd.Intn(2) == 0 {
+		if v, ok := g.pick(g.scope, func(v value) bool { return v.t.equals(t) }); ok {
+			return v.name
+		}
+	}
+	return g.literal(t)
+}
+
+func (g *generator) literal(t *typ) string {
+	switch t.kind {
+	case kindInt:
+		return fmt.Sprint(g.rnd.Intn(100))
+	case kindFloat:
+		return fmt.Sprintf("%d.%d", g.rnd.Intn(10), g.rnd.Intn(10))
+	case kindBool:
+		return fmt.Sprint(g.rnd.Intn(2) == 0)
+	}
+	letters := make([]byte, g.rnd.Intn(4))
+	for i := range letters {
+		letters[i] = byte('a' + g.rnd.Intn(26))
+	}
+	return `"` + string(letters) + `"`
+}
+
+// functionValue returns function of the type, declared or literal
+func (g *generator) functionValue(t *typ) string {
+	if g.nesting >= maxNesting || g.rnd.Intn(2) == 0 {
+		declared := append(append([]value{}, g.functions...), g.scope...)
+		if v, ok := g.pick(declared, func(v value) bool { return v.t.equals(t) }); ok {
+			return v.name
+		}
+	}
+
+	out, indent := g.out, g.indent
+	g.out = &strings.Builder{}
+	g.indent++
+	g.nesting++
+	params := g.params(t)
+	g.body(params, t.result)
+	g.nesting--
+	body := g.out.String()
+	g.out, g.indent = out, indent
+	return fmt.Sprintf("fn(%s) {\n%s%s}", names(params), body, strings.Repeat("\t", indent))
+}
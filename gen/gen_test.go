@@ -0,0 +1,109 @@
+package gen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"some/analysis"
+	a "some/ast"
+	"some/codegen"
+	s "some/syntax"
+	u "some/util"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/utf8string"
+)
+
+// compile runs the whole pipeline on the program, panics are errors too
+func compile(code string) (c string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	src := s.NewSource("gen_test", *utf8string.NewString(code))
+	handler := u.NewHandler()
+	check := func() error {
+		if !handler.IsEmpty() {
+			return errors.New(strings.Join(handler.AllErrors(), ""))
+		}
+		return nil
+	}
+
+	tokenizer := s.NewTokenizer(&handler)
+	tokenizer.Tokenize(&src)
+	if err := check(); err != nil {
+		return "", err
+	}
+	parser := a.NewParser(&handler)
+	ast := parser.Parse(&src)
+	if err := check(); err != nil {
+		return "", err
+	}
+	scopeCheckResult := analysis.ScopecheckPass(&src, &ast, &handler)
+	if err := check(); err != nil {
+		return "", err
+	}
+	tAst := analysis.TypeCheckPass(scopeCheckResult, &src, &ast, &handler)
+	if err := check(); err != nil {
+		return "", err
+	}
+	analysis.ErrorCheckPass(scopeCheckResult, &src, tAst, &handler)
+	program := analysis.MonomorphizationPass(scopeCheckResult, &src, tAst, &handler)
+	if err := check(); err != nil {
+		return "", err
+	}
+	return codegen.GenerateC(program), nil
+}
+
+func TestGenerateReproducible(t *testing.T) {
+	for seed := int64(0); seed < 10; seed++ {
+		if Generate(seed) != Generate(seed) {
+			t.Errorf("Expected the same program for seed %d", seed)
+		}
+	}
+	if Generate(1) == Generate(2) {
+		t.Errorf("Expected different programs for different seeds")
+	}
+}
+
+func TestGeneratedCompile(t *testing.T) {
+	for seed := int64(0); seed < 300; seed++ {
+		code := Generate(seed)
+		if _, err := compile(code); err != nil {
+			t.Fatalf("seed %d: %s\n%s", seed, err, code)
+		}
+	}
+}
+
+func TestGeneratedRun(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("C compiler is not available")
+	}
+	dir := t.TempDir()
+	for seed := int64(0); seed < 20; seed++ {
+		code := Generate(seed)
+		c, err := compile(code)
+		if err != nil {
+			t.Fatalf("seed %d: %s\n%s", seed, err, code)
+		}
+		source := filepath.Join(dir, "main.c")
+		binary := filepath.Join(dir, "main")
+		if err := os.WriteFile(source, []byte(c), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command(cc, "-std=c99", "-Wall", "-Werror", "-o", binary, source).CombinedOutput(); err != nil {
+			t.Fatalf("seed %d: C compilation failed: %s\n%s", seed, out, code)
+		}
+		// any exit code is fine, but the program must not crash
+		if err := exec.Command(binary).Run(); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() < 0 {
+				t.Fatalf("seed %d: %s\n%s", seed, err, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"some/analysis"
+	p "some/ast"
+	"some/codegen"
+	ID "some/domain"
+	s "some/syntax"
+	u "some/util"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/utf8string"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files of testdata with the actual output")
+
+// NOTE: every testdata/foo.some has golden files of the stages it reaches:
+// - foo.tokens every token with its position
+// - foo.ast formatted dump of the AST
+// - foo.typed formatted dump of the typed AST
+// - foo.c generated C program
+// - foo.stdout output of the compiled program followed by its exit code
+// - foo.errors errors and warnings, the stage with errors is the last one
+// golden of the stage that is not reached must not exist
+
+var goldenStages = []string{".tokens", ".ast", ".errors", ".typed", ".c", ".stdout"}
+
+var tokenNames = map[ID.Token]string{
+	ID.TokenEOF:          "EOF",
+	ID.TokenKeyword:      "keyword",
+	ID.TokenIdentifier:   "identifier",
+	ID.TokenPunctuation:  "punctuation",
+	ID.TokenUnaryOp:      "unary",
+	ID.TokenBinaryOp:     "binary",
+	ID.TokenIntLit:       "int",
+	ID.TokenFloatLit:     "float",
+	ID.TokenImaginaryLit: "imaginary",
+	ID.TokenRuneLit:      "rune",
+	ID.TokenStringLit:    "string",
+	ID.TokenBoolLit:      "bool",
+	ID.TokenTerminator:   "terminator",
+}
+
+func dumpTokens(src *s.Source) string {
+	str := strings.Builder{}
+	for i := 0; i < src.TokenCount(); i++ {
+		t := src.Token(ID.Token(i))
+		if t.Tag == ID.TokenEOF {
+			str.WriteString("EOF\n")
+			continue
+		}
+		name, ok := tokenNames[t.Tag]
+		if !ok {
+			name = fmt.Sprint(t.Tag)
+		}
+		fmt.Fprintf(&str, "%d:%d %s %q\n", t.Line, t.Col, name, src.Lexeme(ID.Token(i)))
+	}
+	return str.String()
+}
+
+func dumpErrors(handler u.ErrorHandler) string {
+	str := strings.Builder{}
+	for _, e := range append(append([]u.Error{}, handler.Errors()...), handler.Warnings()...) {
+		line, col, _ := e.Position()
+		fmt.Fprintf(&str, "%s at %d:%d %s\n", e.Name(), line, col, strings.TrimSpace(e.Message()))
+	}
+	return str.String()
+}
+
+// errNoCompiler means the program can't be run, so its output is unknown
+var errNoCompiler = errors.New("C compiler is not available")
+
+func runProgram(t *testing.T, c string) (string, error) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		return "", errNoCompiler
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.c")
+	binary := filepath.Join(dir, "main")
+	if err := os.WriteFile(source, []byte(c), 0644); err != nil {
+		return "", err
+	}
+	if out, err := exec.Command(cc, "-std=c99", "-Wall", "-Werror", "-o", binary, source).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("C compilation failed: %s", out)
+	}
+	cmd := exec.Command(binary)
+	stdout := strings.Builder{}
+	cmd.Stdout = &stdout
+	code := 0
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return "", err
+		}
+		code = exitErr.ExitCode()
+	}
+	return fmt.Sprintf("%sexit %d\n", stdout.String(), code), nil
+}
+
+// runStages returns outputs of the stages by the golden extension, pipeline
+// stops on the first stage with errors
+func runStages(t *testing.T, filename string, contents []byte) map[string]string {
+	outputs := map[string]string{}
+	src := s.NewSource(filename, *utf8string.NewString(string(contents)))
+	handler := u.NewHandler()
+	failed := func() bool {
+		if handler.IsEmpty() {
+			return false
+		}
+		outputs[".errors"] = dumpErrors(handler)
+		return true
+	}
+
+	tokenizer := s.NewTokenizer(&handler)
+	tokenizer.Tokenize(&src)
+	if failed() {
+		return outputs
+	}
+	outputs[".tokens"] = dumpTokens(&src)
+	parser := p.NewParser(&handler)
+	ast := parser.Parse(&src)
+	if failed() {
+		return outputs
+	}
+	outputs[".ast"] = strings.TrimSpace(u.FormatSExpr(ast.Dump(0))) + "\n"
+	scopeCheckResult := analysis.ScopecheckPass(&src, &ast, &handler)
+	if failed() {
+		return outputs
+	}
+	tAst := analysis.TypeCheckPass(scopeCheckResult, &src, &ast, &handler)
+	if failed() {
+		return outputs
+	}
+	outputs[".typed"] = strings.TrimSpace(u.FormatSExpr(tAst.Dump())) + "\n"
+	analysis.ErrorCheckPass(scopeCheckResult, &src, tAst, &handler)
+	program := analysis.MonomorphizationPass(scopeCheckResult, &src, tAst, &handler)
+	if failed() {
+		return outputs
+	}
+	if len(handler.Warnings()) > 0 {
+		outputs[".errors"] = dumpErrors(handler)
+	}
+	outputs[".c"] = codegen.GenerateC(program)
+
+	stdout, err := runProgram(t, outputs[".c"])
+	if errors.Is(err, errNoCompiler) {
+		// the golden stays as it is
+		t.Log(err)
+		return outputs
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs[".stdout"] = stdout
+	return outputs
+}
+
+func checkGolden(t *testing.T, path string, actual string, reached bool) {
+	if *update {
+		if reached {
+			if err := os.WriteFile(path, []byte(actual), 0644); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && reached:
+		t.Errorf("%s is missing, run tests with -update to create it", path)
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		t.Fatal(err)
+	case !reached:
+		t.Errorf("%s exists, but the stage is not reached", path)
+	case string(expected) != actual:
+		t.Errorf("%s doesn't match the output\n%s", path, u.Diff(path, "actual", string(expected), actual))
+	}
+}
+
+func TestGolden(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.some"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("No sources in testdata")
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputs := runStages(t, filepath.Base(path), contents)
+			base := strings.TrimSuffix(path, ".some")
+			for _, ext := range goldenStages {
+				actual, reached := outputs[ext]
+				if _, generated := outputs[".c"]; ext == ".stdout" && generated && !reached {
+					continue
+				}
+				checkGolden(t, base+ext, actual, reached)
+			}
+		})
+	}
+}
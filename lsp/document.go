@@ -0,0 +1,317 @@
+package lsp
+
+import (
+	"fmt"
+	"some/analysis"
+	a "some/ast"
+	ID "some/domain"
+	s "some/syntax"
+	u "some/util"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/exp/utf8string"
+)
+
+// document is the result of the pipeline on the text, every stage runs only
+// if the previous one succeeded, so results of later stages may be missing
+type document struct {
+	uri   string
+	lines []string
+
+	src   *s.Source
+	ast   *a.AST
+	names *analysis.QualifiedNames
+	tAst  *a.TypedAST
+
+	errors   []u.Error
+	warnings []u.Error
+	// the pipeline is not expected to panic, but the server must survive it
+	failure any
+}
+
+func newDocument(uri string, text string) *document {
+	d := &document{uri: uri, lines: strings.Split(text, "\n")}
+	handler := u.NewHandler()
+	defer func() {
+		d.failure = recover()
+		d.errors = handler.Errors()
+		d.warnings = handler.Warnings()
+	}()
+
+	src := s.NewSource(uri, *utf8string.NewString(text))
+	tokenizer := s.NewTokenizer(&handler)
+	tokenizer.Tokenize(&src)
+	if !handler.IsEmpty() {
+		return d
+	}
+	d.src = &src
+	parser := a.NewParser(&handler)
+	ast := parser.Parse(&src)
+	if !handler.IsEmpty() {
+		return d
+	}
+	d.ast = &ast
+	scopeCheckResult := analysis.ScopecheckPass(&src, &ast, &handler)
+	d.names = &scopeCheckResult.QualifiedNames
+	if !handler.IsEmpty() {
+		return d
+	}
+	tAst := analysis.TypeCheckPass(scopeCheckResult, &src, &ast, &handler)
+	if !handler.IsEmpty() {
+		return d
+	}
+	d.tAst = &tAst
+	analysis.ErrorCheckPass(scopeCheckResult, &src, tAst, &handler)
+	if !handler.IsEmpty() {
+		return d
+	}
+	analysis.MonomorphizationPass(scopeCheckResult, &src, tAst, &handler)
+	return d
+}
+
+// NOTE: lines of the source start from 1 and columns count runes,
+// lines of the protocol start from 0 and characters count utf16 code units
+
+func (d *document) position(line, col int) Position {
+	p := Position{Line: line - 1}
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return Position{}
+	}
+	for i, r := range []rune(d.lines[p.Line]) {
+		if i >= col {
+			break
+		}
+		p.Character += utf16.RuneLen(r)
+	}
+	return p
+}
+
+func (d *document) location(p Position) (line, col int) {
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return -1, -1
+	}
+	units := 0
+	for _, r := range []rune(d.lines[p.Line]) {
+		if units >= p.Character {
+			break
+		}
+		units += utf16.RuneLen(r)
+		col++
+	}
+	return p.Line + 1, col
+}
+
+func (d *document) tokenRange(i ID.Token) Range {
+	t := d.src.Token(i)
+	length := len([]rune(d.src.Lexeme(i)))
+	return Range{Start: d.position(t.Line, t.Col), End: d.position(t.Line, t.Col+length)}
+}
+
+// tokenAt finds the token under the cursor, the cursor may be right after the token
+func (d *document) tokenAt(p Position) (ID.Token, bool) {
+	line, col := d.location(p)
+	found := false
+	var token ID.Token
+	for i := 0; i < d.src.TokenCount(); i++ {
+		t := d.src.Token(ID.Token(i))
+		if t.Tag == ID.TokenTerminator || t.Line != line {
+			continue
+		}
+		length := len([]rune(d.src.Lexeme(ID.Token(i))))
+		if t.Col <= col && col <= t.Col+length {
+			// the token starting at the cursor wins over the one ending there
+			token, found = ID.Token(i), true
+		}
+	}
+	return token, found
+}
+
+// nodeAt finds node of the token under the cursor, identifiers are preferred
+// over nodes sharing the token with them
+func (d *document) nodeAt(p Position) (ID.Node, bool) {
+	if d.ast == nil {
+		return ID.NodeInvalid, false
+	}
+	token, ok := d.tokenAt(p)
+	if !ok {
+		return ID.NodeInvalid, false
+	}
+	node, found := ID.NodeInvalid, false
+	for i := 0; i < d.ast.NodeCount(); i++ {
+		n := d.ast.GetNode(ID.Node(i))
+		if n.Token() != token || n.Tag() == ID.NodeSource {
+			continue
+		}
+		if n.Tag() == ID.NodeIdentifier {
+			return ID.Node(i), true
+		}
+		if !found {
+			node, found = ID.Node(i), true
+		}
+	}
+	return node, found
+}
+
+func (d *document) nodeName(i ID.Node) (analysis.QualifiedName, bool) {
+	if d.names == nil {
+		return "", false
+	}
+	if d.ast.GetNode(i).Tag() != ID.NodeIdentifier {
+		return "", false
+	}
+	return d.names.GetNodeName(i)
+}
+
+func (d *document) diagnostics() []Diagnostic {
+	diagnostics := make([]Diagnostic, 0, len(d.errors)+len(d.warnings))
+	add := func(e u.Error, severity int) {
+		line, col, _ := e.Position()
+		if line < 1 {
+			// error at EOF
+			line, col = len(d.lines), len([]rune(d.lines[len(d.lines)-1]))
+		}
+		r := Range{Start: d.position(line, col), End: d.position(line, col)}
+		if d.src != nil {
+			for i := 0; i < d.src.TokenCount(); i++ {
+				t := d.src.Token(ID.Token(i))
+				if t.Line == line && t.Col == col && t.Tag != ID.TokenTerminator && t.Tag != ID.TokenEOF {
+					r = d.tokenRange(ID.Token(i))
+					break
+				}
+			}
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    r,
+			Severity: severity,
+			Source:   "some",
+			Message:  strings.TrimSpace(e.Message()),
+		})
+	}
+	for _, e := range d.errors {
+		add(e, severityError)
+	}
+	for _, w := range d.warnings {
+		add(w, severityWarning)
+	}
+	if d.failure != nil {
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: severityError,
+			Source:   "some",
+			Message:  fmt.Sprintf("internal compiler error: %v", d.failure),
+		})
+	}
+	return diagnostics
+}
+
+func (d *document) hover(p Position) *Hover {
+	if d.tAst == nil {
+		return nil
+	}
+	node, ok := d.nodeAt(p)
+	if !ok {
+		return nil
+	}
+	t := d.tAst.GetNodeType(node)
+	if t == ID.TypeInvalid {
+		return nil
+	}
+	repo := d.tAst.GetTypeRepo()
+	text := repo.GetString(t)
+	if d.ast.GetNode(node).Tag() == ID.NodeIdentifier {
+		text = a.Identifier_String(*d.ast, node) + " " + text
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "plaintext", Value: text},
+		Range:    d.tokenRange(d.ast.GetNode(node).Token()),
+	}
+}
+
+func (d *document) nodeLocation(i ID.Node) Location {
+	return Location{URI: d.uri, Range: d.tokenRange(d.ast.GetNode(i).Token())}
+}
+
+func (d *document) definition(p Position) []Location {
+	node, ok := d.nodeAt(p)
+	if !ok {
+		return []Location{}
+	}
+	name, ok := d.nodeName(node)
+	if !ok {
+		return []Location{}
+	}
+	decl := d.names.GetDeclarationNode(name)
+	if decl == ID.NodeInvalid {
+		return []Location{}
+	}
+	return []Location{d.nodeLocation(decl)}
+}
+
+func (d *document) references(p Position, includeDeclaration bool) []Location {
+	locations := []Location{}
+	node, ok := d.nodeAt(p)
+	if !ok {
+		return locations
+	}
+	name, ok := d.nodeName(node)
+	if !ok {
+		return locations
+	}
+	decl := d.names.GetDeclarationNode(name)
+	for i := 0; i < d.ast.NodeCount(); i++ {
+		id := ID.Node(i)
+		if id == decl && !includeDeclaration {
+			continue
+		}
+		if other, ok := d.nodeName(id); ok && other == name {
+			locations = append(locations, d.nodeLocation(id))
+		}
+	}
+	return locations
+}
+
+func (d *document) symbols() []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	if d.ast == nil {
+		return symbols
+	}
+	root := d.ast.SourceRoot(d.ast.GetNode(0))
+	for _, i := range root.Declarations {
+		n := d.ast.GetNode(i)
+		if n.Tag() != ID.NodeFunctionDecl {
+			continue
+		}
+		decl := d.ast.FunctionDecl(n)
+		start := d.tokenRange(n.Token()).Start
+		end := d.tokenRange(d.lastToken(n.Token())).End
+		symbols = append(symbols, DocumentSymbol{
+			Name:           a.Identifier_String(*d.ast, decl.Name),
+			Kind:           symbolKindFunction,
+			Range:          Range{Start: start, End: end},
+			SelectionRange: d.tokenRange(d.ast.GetNode(decl.Name).Token()),
+		})
+	}
+	return symbols
+}
+
+// lastToken returns the last token of the declaration starting at the token
+func (d *document) lastToken(first ID.Token) ID.Token {
+	depth := 0
+	last := first
+	for i := first; int(i) < d.src.TokenCount(); i++ {
+		t := d.src.Token(i)
+		if t.Tag == ID.TokenEOF || (depth == 0 && t.Tag == ID.TokenTerminator) {
+			break
+		}
+		if t.Tag == ID.TokenPunctuation {
+			switch d.src.Lexeme(i) {
+			case "{", "(":
+				depth++
+			case "}", ")":
+				depth--
+			}
+		}
+		last = i
+	}
+	return last
+}
@@ -0,0 +1,224 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// Server speaks JSON-RPC with the editor, every document is analysed
+// from scratch on each change
+type Server struct {
+	in   *bufio.Reader
+	out  io.Writer
+	docs map[string]*document
+	// requests after shutdown are errors, exit ends the session
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+	}
+}
+
+// Serve handles messages until exit notification or the end of input
+func (s *Server) Serve() error {
+	for {
+		content, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			if err := s.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(req); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) read() ([]byte, error) {
+	headers, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(headers) == 0 {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %w", err)
+	}
+	content := make([]byte, length)
+	_, err = io.ReadFull(s.in, content)
+	return content, err
+}
+
+func (s *Server) write(msg any) error {
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
+
+func (s *Server) reply(req request, result any) error {
+	return s.write(response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+func (s *Server) replyError(req *request, code int, message string) error {
+	resp := errorResponse{JSONRPC: "2.0", Error: responseError{Code: code, Message: message}}
+	if req != nil {
+		resp.ID = req.ID
+	}
+	return s.write(resp)
+}
+
+func (s *Server) notify(method string, params any) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) publishDiagnostics(uri string) error {
+	diagnostics := []Diagnostic{}
+	if d, ok := s.docs[uri]; ok {
+		diagnostics = d.diagnostics()
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+func (s *Server) handle(req request) (err error) {
+	isNotification := req.ID == nil
+	if s.shutdown && !isNotification {
+		return s.replyError(&req, codeInvalidRequest, "server is shut down")
+	}
+
+	defer func() {
+		if r := recover(); r != nil && !isNotification {
+			err = s.replyError(&req, codeInternalError, fmt.Sprint(r))
+		}
+	}()
+
+	decode := func(params any) bool {
+		if err := json.Unmarshal(req.Params, params); err != nil {
+			if !isNotification {
+				s.replyError(&req, codeInvalidParams, err.Error())
+			}
+			return false
+		}
+		return true
+	}
+
+	switch req.Method {
+	case "initialize":
+		result := initializeResult{Capabilities: serverCapabilities{
+			TextDocumentSync:       syncFull,
+			HoverProvider:          true,
+			DefinitionProvider:     true,
+			ReferencesProvider:     true,
+			DocumentSymbolProvider: true,
+		}}
+		result.ServerInfo.Name = "some"
+		return s.reply(req, result)
+	case "shutdown":
+		s.shutdown = true
+		return s.reply(req, nil)
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if !decode(&params) {
+			return nil
+		}
+		uri := params.TextDocument.URI
+		s.docs[uri] = newDocument(uri, params.TextDocument.Text)
+		return s.publishDiagnostics(uri)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if !decode(&params) || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		// the sync is full, so the last change is the whole text
+		uri := params.TextDocument.URI
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		s.docs[uri] = newDocument(uri, text)
+		return s.publishDiagnostics(uri)
+	case "textDocument/didClose":
+		var params didCloseParams
+		if !decode(&params) {
+			return nil
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return s.publishDiagnostics(params.TextDocument.URI)
+
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if !decode(&params) {
+			return nil
+		}
+		d, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return s.reply(req, nil)
+		}
+		if hover := d.hover(params.Position); hover != nil {
+			return s.reply(req, hover)
+		}
+		return s.reply(req, nil)
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if !decode(&params) {
+			return nil
+		}
+		locations := []Location{}
+		if d, ok := s.docs[params.TextDocument.URI]; ok {
+			locations = d.definition(params.Position)
+		}
+		return s.reply(req, locations)
+	case "textDocument/references":
+		var params referenceParams
+		if !decode(&params) {
+			return nil
+		}
+		locations := []Location{}
+		if d, ok := s.docs[params.TextDocument.URI]; ok {
+			locations = d.references(params.Position, params.Context.IncludeDeclaration)
+		}
+		return s.reply(req, locations)
+	case "textDocument/documentSymbol":
+		var params documentSymbolParams
+		if !decode(&params) {
+			return nil
+		}
+		symbols := []DocumentSymbol{}
+		if d, ok := s.docs[params.TextDocument.URI]; ok {
+			symbols = d.symbols()
+		}
+		return s.reply(req, symbols)
+	}
+
+	if isNotification {
+		// unknown notifications are ignored
+		return nil
+	}
+	return s.replyError(&req, codeMethodNotFound, "method not found: "+req.Method)
+}
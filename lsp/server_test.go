@@ -0,0 +1,201 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+const uri = "file:///test.some"
+
+// script is a client sending messages one after another and reading all
+// replies at the end, requests have ids starting from 1 in order
+type script struct {
+	in    bytes.Buffer
+	count int
+}
+
+func (c *script) send(method string, params any, isRequest bool) int {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+	if isRequest {
+		c.count++
+		msg["id"] = c.count
+	}
+	content, _ := json.Marshal(msg)
+	fmt.Fprintf(&c.in, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return c.count
+}
+
+func (c *script) request(method string, params any) int {
+	return c.send(method, params, true)
+}
+
+func (c *script) notify(method string, params any) {
+	c.send(method, params, false)
+}
+
+// run returns responses by their id and notifications in order
+func (c *script) run(t *testing.T) (map[int]map[string]any, []map[string]any) {
+	out := bytes.Buffer{}
+	if err := NewServer(&c.in, &out).Serve(); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := map[int]map[string]any{}
+	notifications := []map[string]any{}
+	reader := bufio.NewReader(&out)
+	for {
+		headers, err := textproto.NewReader(reader).ReadMIMEHeader()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		length, _ := strconv.Atoi(headers.Get("Content-Length"))
+		content := make([]byte, length)
+		if _, err := io.ReadFull(reader, content); err != nil {
+			t.Fatal(err)
+		}
+		msg := map[string]any{}
+		if err := json.Unmarshal(content, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if id, ok := msg["id"].(float64); ok {
+			responses[int(id)] = msg
+		} else {
+			notifications = append(notifications, msg)
+		}
+	}
+	return responses, notifications
+}
+
+func position(line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+// ranges extracts start line and character of locations
+func ranges(t *testing.T, result any) [][2]int {
+	items, ok := result.([]any)
+	if !ok {
+		t.Fatalf("Expected list of locations, got %v", result)
+	}
+	starts := [][2]int{}
+	for _, item := range items {
+		r := item.(map[string]any)["range"].(map[string]any)
+		if selection, ok := item.(map[string]any)["selectionRange"]; ok {
+			r = selection.(map[string]any)
+		}
+		start := r["start"].(map[string]any)
+		starts = append(starts, [2]int{int(start["line"].(float64)), int(start["character"].(float64))})
+	}
+	return starts
+}
+
+func TestServer(t *testing.T) {
+	code := `fn add(a, b) {
+	return a + b
+}
+
+fn main() {
+	x := add(1, 2)
+	y := "é" + string(x)
+	return add(x, 3)
+}
+`
+	c := script{}
+	initialize := c.request("initialize", map[string]any{})
+	c.notify("initialized", map[string]any{})
+	c.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "some", "version": 1, "text": code},
+	})
+	hoverX := c.request("textDocument/hover", position(7, 12))
+	hoverAdd := c.request("textDocument/hover", position(5, 6))
+	hoverY := c.request("textDocument/hover", position(6, 1))
+	hoverNothing := c.request("textDocument/hover", position(3, 0))
+	definition := c.request("textDocument/definition", position(7, 12))
+	references := c.request("textDocument/references", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": 0, "character": 4},
+		"context":      map[string]any{"includeDeclaration": true},
+	})
+	symbols := c.request("textDocument/documentSymbol", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+	})
+	unknown := c.request("textDocument/unknown", map[string]any{})
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []any{map[string]any{"text": "fn main() {\n\treturn z\n}\n"}},
+	})
+	shutdown := c.request("shutdown", nil)
+	c.notify("exit", nil)
+
+	responses, notifications := c.run(t)
+
+	capabilities := responses[initialize]["result"].(map[string]any)["capabilities"].(map[string]any)
+	if capabilities["hoverProvider"] != true || capabilities["textDocumentSync"] != 1.0 {
+		t.Errorf("Unexpected capabilities %v", capabilities)
+	}
+
+	hover := func(id int) any {
+		result, ok := responses[id]["result"].(map[string]any)
+		if !ok {
+			return responses[id]["result"]
+		}
+		return result["contents"].(map[string]any)["value"]
+	}
+	if h := hover(hoverX); h != "x int" {
+		t.Errorf("Expected hover of x, got %v", h)
+	}
+	if h := hover(hoverAdd); h != "add (FN int int int )" {
+		t.Errorf("Expected hover of add, got %v", h)
+	}
+	if h := hover(hoverY); h != "y string" {
+		t.Errorf("Expected hover of y, got %v", h)
+	}
+	if h := hover(hoverNothing); h != nil {
+		t.Errorf("Expected no hover, got %v", h)
+	}
+
+	if r := ranges(t, responses[definition]["result"]); !reflect.DeepEqual(r, [][2]int{{5, 1}}) {
+		t.Errorf("Expected definition of x, got %v", r)
+	}
+	if r := ranges(t, responses[references]["result"]); !reflect.DeepEqual(r, [][2]int{{0, 3}, {5, 6}, {7, 8}}) {
+		t.Errorf("Expected references of add, got %v", r)
+	}
+	if r := ranges(t, responses[symbols]["result"]); !reflect.DeepEqual(r, [][2]int{{0, 3}, {4, 3}}) {
+		t.Errorf("Expected symbols of functions, got %v", r)
+	}
+	if e, ok := responses[unknown]["error"].(map[string]any); !ok || e["code"] != float64(codeMethodNotFound) {
+		t.Errorf("Expected method not found, got %v", responses[unknown])
+	}
+	if _, ok := responses[shutdown]["result"]; !ok {
+		t.Errorf("Expected null result of shutdown, got %v", responses[shutdown])
+	}
+
+	if len(notifications) != 2 {
+		t.Fatalf("Expected diagnostics after open and change, got %v", notifications)
+	}
+	diagnostics := func(i int) []any {
+		return notifications[i]["params"].(map[string]any)["diagnostics"].([]any)
+	}
+	if d := diagnostics(0); len(d) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", d)
+	}
+	d := diagnostics(1)
+	if r := ranges(t, d); len(d) != 1 || !reflect.DeepEqual(r, [][2]int{{1, 8}}) {
+		t.Fatalf("Expected diagnostic of z, got %v", d)
+	}
+	if m := d[0].(map[string]any)["message"]; m != "Lookup for identifier z failed" {
+		t.Errorf("Unexpected message %v", m)
+	}
+}
@@ -5,38 +5,260 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"some/analysis"
 	p "some/ast"
+	f "some/format"
+	g "some/gen"
+	"some/lsp"
+	"some/reduce"
+	"some/refactor"
 	s "some/syntax"
 	u "some/util"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/exp/utf8string"
 )
 
-func main() {
-	filepath := flag.String("path", "undefined", "filepath to source")
-	flag.Parse()
-	contents, err := ioutil.ReadFile(*filepath)
-	if err != nil {
-		panic(err)
-	}
-
+func parse(filename string, contents []byte) (*s.Source, *p.AST, error) {
 	text := utf8string.NewString(string(contents))
-	src := s.NewSource("ast_test", *text)
+	src := s.NewSource(filename, *text)
 
 	handler := u.NewHandler()
 	tokenizer := s.NewTokenizer(&handler)
 	tokenizer.Tokenize(&src)
 	if !handler.IsEmpty() {
 		errs := handler.AllErrors()
-		panic(errors.New(strings.Join(errs, "")))
+		return nil, nil, errors.New(strings.Join(errs, ""))
 	}
 
 	parser := p.NewParser(&handler)
 	ast := parser.Parse(&src)
 	if !handler.IsEmpty() {
 		errs := handler.AllErrors()
-		panic(errors.New(strings.Join(errs, "")))
+		return nil, nil, errors.New(strings.Join(errs, ""))
+	}
+	return &src, &ast, nil
+}
+
+// formatFiles prints formatted files, writes them back or prints the diff
+func formatFiles(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	diff := flags.Bool("d", false, "print diff instead of the formatted source")
+	flags.Parse(args)
+
+	failed := false
+	for _, filename := range flags.Args() {
+		contents, err := ioutil.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		src, ast, err := parse(filename, contents)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", filename, err)
+			failed = true
+			continue
+		}
+
+		formatted := f.Format(src, ast)
+		if *diff {
+			fmt.Print(u.Diff(filename, filename+" (formatted)", string(contents), formatted))
+		}
+		if *write && formatted != string(contents) {
+			if err := ioutil.WriteFile(filename, []byte(formatted), 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+			}
+		}
+		if !*diff && !*write {
+			fmt.Print(formatted)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// quiet disables logs that go to stdout, when it is the output of the command
+func quiet() {
+	u.Log.Disable("Info")
+	u.Log.Disable("Debug")
+	u.Log.Disable("Warning")
+}
+
+// renameIdentifier renames declaration or usage at the position with all of its usages
+func renameIdentifier(args []string) {
+	flags := flag.NewFlagSet("rename", flag.ExitOnError)
+	pos := flags.String("pos", "", "position of the identifier as file:line:col, line from 1 and column from 0")
+	to := flags.String("to", "", "new name")
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	flags.Parse(args)
+
+	fail := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	quiet()
+	parts := strings.Split(*pos, ":")
+	if len(parts) < 3 || *to == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	filename := strings.Join(parts[:len(parts)-2], ":")
+	line, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		fail(err)
+	}
+	col, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		fail(err)
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fail(err)
+	}
+	src, ast, err := parse(filename, contents)
+	if err != nil {
+		fail(err)
+	}
+	handler := u.NewHandler()
+	result := analysis.ScopecheckPass(src, ast, &handler)
+	if !handler.IsEmpty() {
+		fail(errors.New(strings.Join(handler.AllErrors(), "")))
+	}
+
+	token, ok := src.TokenAt(line, col)
+	if !ok {
+		fail(fmt.Errorf("%s: no identifier at the position", *pos))
+	}
+	edits, err := refactor.Rename(src, ast, result.QualifiedNames, token, *to)
+	if err != nil {
+		fail(err)
+	}
+	renamed := src.Apply(edits)
+	if !*write {
+		fmt.Print(renamed)
+		return
+	}
+	if err := ioutil.WriteFile(filename, []byte(renamed), 0644); err != nil {
+		fail(err)
+	}
+}
+
+// generateProgram prints random well-typed program, seed is reported,
+// so the program can be generated again
+func generateProgram(args []string) {
+	flags := flag.NewFlagSet("gen", flag.ExitOnError)
+	seed := flags.Int64("seed", time.Now().UnixNano(), "seed of the program")
+	flags.Parse(args)
+
+	fmt.Fprintf(os.Stderr, "seed %d\n", *seed)
+	fmt.Print(g.Generate(*seed))
+}
+
+// reduceFile prints the smallest source that fails the same way as the file,
+// the same panic message or the same error by default
+func reduceFile(args []string) {
+	flags := flag.NewFlagSet("reduce", flag.ExitOnError)
+	panicText := flags.String("panic", "", "text of the panic message the compiler must panic with")
+	errorName := flags.String("error", "", "name of the error the compiler must report, e.g. Sema-0003")
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	flags.Parse(args)
+
+	fail := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	quiet()
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	filename := flags.Arg(0)
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fail(err)
+	}
+
+	var interesting reduce.Predicate
+	switch {
+	case *panicText != "":
+		interesting = reduce.Panics(*panicText)
+	case *errorName != "":
+		interesting = reduce.Reports(*errorName)
+	default:
+		message, errs := reduce.Run(string(contents))
+		switch {
+		case message != "":
+			fmt.Fprintf(os.Stderr, "panic %s\n", message)
+			interesting = reduce.Panics(message)
+		case len(errs) > 0:
+			fmt.Fprintf(os.Stderr, "error %s\n", errs[0].Name())
+			interesting = reduce.Reports(errs[0].Name())
+		default:
+			fail(fmt.Errorf("%s compiles without errors", filename))
+		}
+	}
+
+	reduced, err := reduce.Reduce(string(contents), interesting)
+	if err != nil {
+		fail(fmt.Errorf("%s: %s", filename, err))
+	}
+	if !*write {
+		fmt.Print(reduced)
+		return
+	}
+	if err := ioutil.WriteFile(filename, []byte(reduced), 0644); err != nil {
+		fail(err)
+	}
+}
+
+// serveLSP runs language server over stdio, stdout belongs to the protocol
+func serveLSP() {
+	quiet()
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			formatFiles(os.Args[2:])
+			return
+		case "gen":
+			generateProgram(os.Args[2:])
+			return
+		case "lsp":
+			serveLSP()
+			return
+		case "reduce":
+			reduceFile(os.Args[2:])
+			return
+		case "rename":
+			renameIdentifier(os.Args[2:])
+			return
+		}
+	}
+
+	filepath := flag.String("path", "undefined", "filepath to source")
+	flag.Parse()
+	contents, err := ioutil.ReadFile(*filepath)
+	if err != nil {
+		panic(err)
+	}
+
+	_, ast, err := parse("ast_test", contents)
+	if err != nil {
+		panic(err)
 	}
 
 	dump := ast.Dump(0)
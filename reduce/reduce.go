@@ -0,0 +1,427 @@
+package reduce
+
+import (
+	"errors"
+	"fmt"
+	"some/analysis"
+	a "some/ast"
+	"some/codegen"
+	ID "some/domain"
+	f "some/format"
+	s "some/syntax"
+	u "some/util"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/utf8string"
+)
+
+// NOTE: reducer works on the AST, so every candidate it tries parses:
+// - declarations and statements are deleted, first in big chunks, then
+//   one by one, as in delta debugging
+// - if statements are replaced by statements of their blocks
+// - expressions are replaced by their operands or by literals of basic types,
+//   literals are never replaced, so every accepted candidate has fewer tokens
+//   or fewer non-literal expressions and reduction terminates
+// panics of the parser can't be reduced, the source must parse
+
+// Predicate tells if the source is still interesting, e.g. crashes the compiler
+// the same way as the original one
+type Predicate func(code string) bool
+
+// Run compiles the source through all passes and returns the panic message,
+// or errors and warnings of the first stage that failed
+func Run(code string) (panicMessage string, errs []u.Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicMessage = fmt.Sprint(r)
+		}
+	}()
+	src := s.NewSource("reduce", *utf8string.NewString(code))
+	handler := u.NewHandler()
+	failed := func() bool {
+		errs = append(append([]u.Error{}, handler.Errors()...), handler.Warnings()...)
+		return !handler.IsEmpty()
+	}
+
+	tokenizer := s.NewTokenizer(&handler)
+	tokenizer.Tokenize(&src)
+	if failed() {
+		return
+	}
+	parser := a.NewParser(&handler)
+	ast := parser.Parse(&src)
+	if failed() {
+		return
+	}
+	scopeCheckResult := analysis.ScopecheckPass(&src, &ast, &handler)
+	if failed() {
+		return
+	}
+	tAst := analysis.TypeCheckPass(scopeCheckResult, &src, &ast, &handler)
+	if failed() {
+		return
+	}
+	analysis.ErrorCheckPass(scopeCheckResult, &src, tAst, &handler)
+	program := analysis.MonomorphizationPass(scopeCheckResult, &src, tAst, &handler)
+	if failed() {
+		return
+	}
+	codegen.GenerateC(program)
+	return
+}
+
+// Panics holds if the compiler panics with the message containing the text
+func Panics(text string) Predicate {
+	return func(code string) bool {
+		message, _ := Run(code)
+		return message != "" && strings.Contains(message, text)
+	}
+}
+
+// Reports holds if the compiler reports error or warning with the name, e.g. Sema-0003
+func Reports(name string) Predicate {
+	return func(code string) bool {
+		_, errs := Run(code)
+		for _, e := range errs {
+			if e.Name() == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type reducer struct {
+	interesting Predicate
+	// results of the predicate by the candidate
+	tried map[string]bool
+
+	code string
+	src  *s.Source
+	ast  *a.AST
+}
+
+// parse returns false if the code doesn't parse, parser doesn't panic on invalid
+// sources, recover is only defensive, so a parser bug fails the candidate
+func parse(code string) (src *s.Source, ast *a.AST, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+	source := s.NewSource("reduce", *utf8string.NewString(code))
+	handler := u.NewHandler()
+	tokenizer := s.NewTokenizer(&handler)
+	tokenizer.Tokenize(&source)
+	if !handler.IsEmpty() {
+		return nil, nil, false
+	}
+	parser := a.NewParser(&handler)
+	tree := parser.Parse(&source)
+	if !handler.IsEmpty() {
+		return nil, nil, false
+	}
+	return &source, &tree, true
+}
+
+// Reduce returns the smallest source it finds for which the predicate still holds
+func Reduce(code string, interesting Predicate) (string, error) {
+	src, ast, ok := parse(code)
+	if !ok {
+		return "", errors.New("source doesn't parse")
+	}
+	if !interesting(code) {
+		return "", errors.New("source is not interesting")
+	}
+	r := reducer{interesting: interesting, tried: map[string]bool{}, code: code, src: src, ast: ast}
+
+	r.accept(r.withoutComments())
+	for changed := true; changed; {
+		changed = r.removeNodes()
+		if r.unwrapBlocks() {
+			changed = true
+		}
+		if r.simplifyExpressions() {
+			changed = true
+		}
+	}
+
+	formatted := f.Format(r.src, r.ast)
+	if formatted != r.code && !r.check(formatted) {
+		return r.code, nil
+	}
+	return formatted, nil
+}
+
+// check calls the predicate once for every candidate
+func (r *reducer) check(candidate string) bool {
+	result, ok := r.tried[candidate]
+	if !ok {
+		result = r.interesting(candidate)
+		r.tried[candidate] = result
+	}
+	return result
+}
+
+// accept makes the candidate current if it parses and is interesting
+func (r *reducer) accept(candidate string) bool {
+	if candidate == r.code {
+		return false
+	}
+	if interesting, ok := r.tried[candidate]; ok && !interesting {
+		return false
+	}
+	src, ast, ok := parse(candidate)
+	if !ok || !r.check(candidate) {
+		return false
+	}
+	r.code, r.src, r.ast = candidate, src, ast
+	return true
+}
+
+func (r *reducer) withoutComments() string {
+	text := utf8string.NewString(r.code)
+	str := strings.Builder{}
+	offset := 0
+	for _, c := range r.src.Comments() {
+		str.WriteString(text.Slice(offset, c.Start))
+		if c.EndLine > c.Line {
+			// multiline comment separates lines
+			str.WriteByte('\n')
+		}
+		offset = c.End + 1
+	}
+	str.WriteString(text.Slice(offset, text.RuneCount()))
+	return str.String()
+}
+
+// apply returns the current code with edits applied, edits inside of the
+// earlier ones are dropped
+func (r *reducer) apply(edits []s.Edit) string {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].Token < edits[j].Token })
+	disjoint := make([]s.Edit, 0, len(edits))
+	last := ID.TokenInvalid
+	for _, e := range edits {
+		if e.Token <= last {
+			continue
+		}
+		disjoint = append(disjoint, e)
+		last = e.Token
+		if e.Last > last {
+			last = e.Last
+		}
+	}
+	return r.src.Apply(disjoint)
+}
+
+func (r *reducer) children(i ID.Node) []ID.Node {
+	return a.NodeChildren[r.ast.GetNode(i).Tag()](*r.ast, i)
+}
+
+// span returns the first and the last token of the node, groups opened
+// in the node are closed in it and the other way around, empty argument
+// list after the node belongs to it
+func (r *reducer) span(i ID.Node) (first, last ID.Token, ok bool) {
+	first, last = ID.TokenInvalid, ID.TokenInvalid
+	r.ast.TraverseSubtreePreorder(i, func(ast *a.AST, i ID.Node) bool {
+		t := ast.GetNode(i).Token()
+		if t < 0 {
+			return false
+		}
+		if first == ID.TokenInvalid || t < first {
+			first = t
+		}
+		if t > last {
+			last = t
+		}
+		return false
+	}, func(*a.AST, ID.Node) bool { return false })
+	if first == ID.TokenInvalid {
+		return first, last, false
+	}
+
+	depth := 0
+	for t := first; t <= last || depth > 0; t++ {
+		token := r.src.Token(t)
+		if token.Tag == ID.TokenEOF {
+			return first, last, false
+		}
+		if token.Tag == ID.TokenPunctuation {
+			switch r.src.Lexeme(t) {
+			case "(", "{":
+				depth++
+			case ")", "}":
+				depth--
+				if depth < 0 {
+					// parenthesis of the first operand is not a token of any node
+					if first == 0 || r.src.Lexeme(first-1) != "(" {
+						return first, last, false
+					}
+					first--
+					depth = 0
+				}
+			}
+		}
+		if t > last {
+			last = t
+		}
+	}
+	if int(last)+2 < r.src.TokenCount() && r.src.Lexeme(last+1) == "(" && r.src.Lexeme(last+2) == ")" {
+		last += 2
+	}
+	return first, last, true
+}
+
+func (r *reducer) text(first, last ID.Token) string {
+	return utf8string.NewString(r.code).Slice(r.src.Token(first).Start, r.src.Token(last).End+1)
+}
+
+// removable returns declarations and statements in preorder
+func (r *reducer) removable() []ID.Node {
+	nodes := []ID.Node{}
+	r.ast.TraversePreorder(func(ast *a.AST, i ID.Node) bool {
+		if tag := ast.GetNode(i).Tag(); tag == ID.NodeSource || tag == ID.NodeBlock {
+			nodes = append(nodes, r.children(i)...)
+		}
+		return false
+	}, func(*a.AST, ID.Node) bool { return false })
+	return nodes
+}
+
+// removeNodes deletes chunks of declarations and statements, chunks get
+// smaller until single nodes are deleted
+func (r *reducer) removeNodes() bool {
+	changed := false
+	nodes := r.removable()
+	for size := len(nodes); size > 0; size /= 2 {
+		for start := 0; start < len(nodes); {
+			end := start + size
+			if end > len(nodes) {
+				end = len(nodes)
+			}
+			edits := []s.Edit{}
+			for _, i := range nodes[start:end] {
+				first, last, ok := r.span(i)
+				if !ok {
+					continue
+				}
+				if r.src.Token(last+1).Tag == ID.TokenTerminator {
+					last++
+				}
+				edits = append(edits, s.Edit{Token: first, Last: last})
+			}
+			if len(edits) > 0 && r.accept(r.apply(edits)) {
+				// nodes before the chunk stay the same in preorder
+				changed = true
+				nodes = r.removable()
+				continue
+			}
+			start = end
+		}
+	}
+	return changed
+}
+
+func isLiteral(tag ID.Token) bool {
+	switch tag {
+	case ID.TokenIntLit, ID.TokenFloatLit, ID.TokenImaginaryLit, ID.TokenRuneLit, ID.TokenStringLit, ID.TokenBoolLit:
+		return true
+	}
+	return false
+}
+
+// unwrapBlocks replaces if statements with statements of their blocks
+func (r *reducer) unwrapBlocks() bool {
+	changed := false
+	for i := 0; i < r.ast.NodeCount(); i++ {
+		n := r.ast.GetNode(ID.Node(i))
+		if n.Tag() != ID.NodeIfStmt {
+			continue
+		}
+		first, last, ok := r.span(ID.Node(i))
+		if !ok {
+			continue
+		}
+		open, close, ok := r.span(r.ast.IfStmt(n).Block)
+		if !ok {
+			continue
+		}
+		statements := ""
+		if close-1 > open {
+			statements = r.text(open+1, close-1)
+		}
+		if r.accept(r.apply([]s.Edit{{Token: first, Last: last, Text: statements}})) {
+			// nodes are renumbered, the next if statement is searched from the start
+			changed = true
+			i = -1
+		}
+	}
+	return changed
+}
+
+var literals = []string{"0", "0.0", "true", `""`}
+
+func isExpression(tag a.NodeTag) bool {
+	switch tag {
+	case ID.NodeExpression, ID.NodeSelector, ID.NodeCall, ID.NodeFunctionLit, ID.NodeIdentifier:
+		return true
+	}
+	if _, _, ok := a.BinaryOperator(tag); ok {
+		return true
+	}
+	_, ok := a.UnaryOperator(tag)
+	return ok
+}
+
+// replacements returns simpler expressions for the node, its operands first
+func (r *reducer) replacements(i ID.Node) []string {
+	result := []string{}
+	tag := r.ast.GetNode(i).Tag()
+	_, _, binary := a.BinaryOperator(tag)
+	_, unary := a.UnaryOperator(tag)
+	if binary || unary {
+		for _, c := range r.children(i) {
+			if first, last, ok := r.span(c); ok {
+				result = append(result, r.text(first, last))
+			}
+		}
+	}
+	return append(result, literals...)
+}
+
+// simplifyExpressions replaces expressions with simpler ones
+func (r *reducer) simplifyExpressions() bool {
+	changed := false
+	expressions := func() []ID.Node {
+		nodes := []ID.Node{}
+		r.ast.TraversePreorder(func(ast *a.AST, i ID.Node) bool {
+			if isExpression(ast.GetNode(i).Tag()) {
+				nodes = append(nodes, i)
+			}
+			return false
+		}, func(*a.AST, ID.Node) bool { return false })
+		return nodes
+	}
+	nodes := expressions()
+	for k := 0; k < len(nodes); {
+		first, last, ok := r.span(nodes[k])
+		accepted := false
+		if ok && !(first == last && isLiteral(r.src.Token(first).Tag)) {
+			for _, replacement := range r.replacements(nodes[k]) {
+				if r.accept(r.apply([]s.Edit{{Token: first, Last: last, Text: replacement}})) {
+					accepted = true
+					break
+				}
+			}
+		}
+		if !accepted {
+			k++
+			continue
+		}
+		// replacement is at the same position in preorder, it is simplified further
+		changed = true
+		nodes = expressions()
+	}
+	return changed
+}
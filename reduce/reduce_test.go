@@ -0,0 +1,88 @@
+package reduce
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReduce(t *testing.T) {
+	code := `// helper adds one
+fn helper(a) {
+	return a + 1
+}
+
+fn main() {
+	const x = helper(2)
+	/* the one */
+	const y = "boom"
+	if x > 1 {
+		z := x * 2
+		return z
+	}
+	return x
+}
+`
+	expected := `fn main() {
+	const y = "boom"
+}
+`
+	reduced, err := Reduce(code, func(code string) bool { return strings.Contains(code, `"boom"`) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reduced != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, reduced)
+	}
+}
+
+func TestReduceError(t *testing.T) {
+	code := `fn twice(f, x) {
+	return f(f(x))
+}
+
+fn main() {
+	const inc = fn(a) {
+		return a + 1
+	}
+	x := twice(inc, 2) * 3
+	if x > 10 {
+		const small = int8(x - 10) + int8(300)
+		return int(small)
+	}
+	return x
+}
+`
+	expected := `fn main() {
+	const small = int8(300)
+	return 0
+}
+`
+	reduced, err := Reduce(code, Reports("Sema-0019"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reduced != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, reduced)
+	}
+}
+
+func TestReduceFail(t *testing.T) {
+	always := func(string) bool { return true }
+	if _, err := Reduce("fn main() {", always); err == nil {
+		t.Errorf("Expected error for the source that doesn't parse")
+	}
+	if _, err := Reduce("fn main() {\n\treturn 0\n}\n", Reports("Sema-0019")); err == nil {
+		t.Errorf("Expected error for the source that is not interesting")
+	}
+}
+
+func TestRun(t *testing.T) {
+	message, errs := Run("fn main() {\n\treturn 0\n}\n")
+	if message != "" || len(errs) != 0 {
+		t.Errorf("Expected no panic and errors, got %q %v", message, errs)
+	}
+	message, errs = Run("fn main() {\n\treturn y\n}\n")
+	if message != "" || len(errs) != 1 || errs[0].Name() != "Sema-0002" {
+		t.Errorf("Expected Sema-0002, got %q %v", message, errs)
+	}
+}
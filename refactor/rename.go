@@ -0,0 +1,108 @@
+package refactor
+
+import (
+	"fmt"
+	"some/analysis"
+	a "some/ast"
+	ID "some/domain"
+	s "some/syntax"
+	T "some/typesystem"
+	u "some/util"
+
+	"golang.org/x/exp/utf8string"
+)
+
+// NOTE: rename is safe if every usage resolves to the same declaration
+// before and after it, lookup finds the innermost declaration of the name
+// declared before the usage, so new name must not be declared:
+// - in the same scope as the renamed declaration
+// - in the enclosing scope and used after the renamed declaration in its scope
+// - in the nested scope before the usage of the renamed declaration in it
+
+// Rename returns edits that rename declaration or usage at the token and all other usages of it
+func Rename(src *s.Source, ast *a.AST, names analysis.QualifiedNames, token ID.Token, newName string) ([]s.Edit, error) {
+	node := ID.NodeInvalid
+	for i := 0; i < ast.NodeCount(); i++ {
+		n := ast.GetNode(ID.Node(i))
+		if n.Tag() == ID.NodeIdentifier && n.Token() == token {
+			node = ID.Node(i)
+			break
+		}
+	}
+	if node == ID.NodeInvalid {
+		return nil, fmt.Errorf("%s is not an identifier", position(src, token))
+	}
+	oldName := a.Identifier_String(*ast, node)
+	name, has := names.GetNodeName(node)
+	if !has {
+		return nil, fmt.Errorf("%s is not declared in the source", oldName)
+	}
+	if err := checkName(newName); err != nil {
+		return nil, err
+	}
+	if newName == oldName {
+		return nil, nil
+	}
+
+	decl := names.GetDeclarationNode(name)
+	declScope, _ := names.GetNodeScope(decl)
+	nodes := names.GetNodesByName(name)
+	tokenOf := func(i ID.Node) ID.Token { return ast.GetNode(i).Token() }
+
+	for _, other := range names.GetDeclarations() {
+		if a.Identifier_String(*ast, other) != newName {
+			continue
+		}
+		otherName, _ := names.GetNodeName(other)
+		otherScope, _ := names.GetNodeScope(other)
+		switch {
+		case otherScope == declScope:
+			return nil, fmt.Errorf("%s is already declared in the scope of %s at %s",
+				newName, oldName, position(src, tokenOf(other)))
+
+		case declScope.Within(otherScope):
+			for _, usage := range names.GetNodesByName(otherName) {
+				scope, _ := names.GetNodeScope(usage)
+				if usage != other && scope.Within(declScope) && tokenOf(usage) > tokenOf(decl) {
+					return nil, fmt.Errorf("%s renamed to %s would shadow the declaration at %s used at %s",
+						oldName, newName, position(src, tokenOf(other)), position(src, tokenOf(usage)))
+				}
+			}
+
+		case otherScope.Within(declScope):
+			for _, usage := range nodes {
+				scope, _ := names.GetNodeScope(usage)
+				if usage != decl && scope.Within(otherScope) && tokenOf(usage) > tokenOf(other) {
+					return nil, fmt.Errorf("%s renamed to %s would be shadowed by the declaration at %s at its usage at %s",
+						oldName, newName, position(src, tokenOf(other)), position(src, tokenOf(usage)))
+				}
+			}
+		}
+	}
+
+	edits := make([]s.Edit, 0, len(nodes))
+	for _, i := range nodes {
+		edits = append(edits, s.Edit{Token: tokenOf(i), Text: newName})
+	}
+	return edits, nil
+}
+
+// checkName accepts only identifiers that are not predeclared
+func checkName(name string) error {
+	src := s.NewSource("name", *utf8string.NewString(name))
+	handler := u.NewHandler()
+	tokenizer := s.NewTokenizer(&handler)
+	tokenizer.Tokenize(&src)
+	if !handler.IsEmpty() || src.TokenCount() != 2 || src.Token(0).Tag != ID.TokenIdentifier {
+		return fmt.Errorf("%q is not an identifier", name)
+	}
+	if _, isType := T.BasicType(name); isType || name == analysis.None {
+		return fmt.Errorf("%s is predeclared", name)
+	}
+	return nil
+}
+
+func position(src *s.Source, token ID.Token) string {
+	line, col := src.Location(token)
+	return fmt.Sprintf("%s:%d:%d", src.Filename(), line, col)
+}
@@ -0,0 +1,180 @@
+package refactor
+
+import (
+	"errors"
+	"some/analysis"
+	a "some/ast"
+	s "some/syntax"
+	u "some/util"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/utf8string"
+)
+
+func rename(code string, line, col int, newName string) (string, error) {
+	text := utf8string.NewString(code)
+	src := s.NewSource("rename_test", *text)
+	handler := u.NewHandler()
+	check := func() error {
+		if !handler.IsEmpty() {
+			return errors.New(strings.Join(handler.AllErrors(), ""))
+		}
+		return nil
+	}
+
+	tokenizer := s.NewTokenizer(&handler)
+	tokenizer.Tokenize(&src)
+	if err := check(); err != nil {
+		return "", err
+	}
+	parser := a.NewParser(&handler)
+	ast := parser.Parse(&src)
+	if err := check(); err != nil {
+		return "", err
+	}
+	result := analysis.ScopecheckPass(&src, &ast, &handler)
+	if err := check(); err != nil {
+		return "", err
+	}
+
+	token, ok := src.TokenAt(line, col)
+	if !ok {
+		return "", errors.New("no token at the position")
+	}
+	edits, err := Rename(&src, &ast, result.QualifiedNames, token, newName)
+	if err != nil {
+		return "", err
+	}
+	return src.Apply(edits), nil
+}
+
+func TestRename(t *testing.T) {
+	code := `fn add(a, b) {
+	return a + b
+}
+
+fn main() {
+	x := add(1, 2)
+	f := fn(y) {
+		return x + y
+	}
+	if x > 1 {
+		x := 2
+		return x
+	}
+	return f(x)
+}
+`
+	cases := []struct {
+		line, col int
+		name      string
+		expected  string
+	}{
+		{1, 3, "sum", `fn sum(a, b) {
+	return a + b
+}
+
+fn main() {
+	x := sum(1, 2)
+	f := fn(y) {
+		return x + y
+	}
+	if x > 1 {
+		x := 2
+		return x
+	}
+	return f(x)
+}
+`},
+		// usage of the outer x, the inner one stays
+		{14, 10, "total", `fn add(a, b) {
+	return a + b
+}
+
+fn main() {
+	total := add(1, 2)
+	f := fn(y) {
+		return total + y
+	}
+	if total > 1 {
+		x := 2
+		return x
+	}
+	return f(total)
+}
+`},
+		{2, 12, "second", `fn add(a, second) {
+	return a + second
+}
+
+fn main() {
+	x := add(1, 2)
+	f := fn(y) {
+		return x + y
+	}
+	if x > 1 {
+		x := 2
+		return x
+	}
+	return f(x)
+}
+`},
+		// declared in the other function
+		{8, 13, "a", strings.ReplaceAll(code, "y", "a")},
+	}
+	for _, c := range cases {
+		result, err := rename(code, c.line, c.col, c.name)
+		if err != nil {
+			t.Errorf("%d:%d to %s: %s", c.line, c.col, c.name, err)
+			continue
+		}
+		if result != c.expected {
+			t.Errorf("%d:%d to %s: expected\n%s\ngot\n%s", c.line, c.col, c.name, c.expected, result)
+		}
+	}
+}
+
+func TestRenameFail(t *testing.T) {
+	code := `fn add(a, b) {
+	return a + b
+}
+
+fn main() {
+	x := add(1, 2)
+	y := 3
+	f := fn(z) {
+		w := 1
+		return x + z + w
+	}
+	return f(y)
+}
+`
+	cases := []struct {
+		line, col int
+		name      string
+		err       string
+	}{
+		// same scope
+		{7, 1, "x", "x is already declared in the scope of y at rename_test:6:1"},
+		{2, 8, "b", "b is already declared in the scope of a at rename_test:1:10"},
+		// x would be captured by the parameter
+		{8, 9, "x", "z renamed to x would shadow the declaration at rename_test:6:1 used at rename_test:10:9"},
+		// w would capture the usage of x
+		{6, 1, "w", "x renamed to w would be shadowed by the declaration at rename_test:9:2 at its usage at rename_test:10:9"},
+		{6, 1, "1x", `"1x" is not an identifier`},
+		{6, 1, "return", `"return" is not an identifier`},
+		{6, 1, "int", "int is predeclared"},
+		{6, 3, "y", "rename_test:6:3 is not an identifier"},
+	}
+	for _, c := range cases {
+		_, err := rename(code, c.line, c.col, c.name)
+		if err == nil {
+			t.Errorf("%d:%d to %s: expected error %s", c.line, c.col, c.name, c.err)
+			continue
+		}
+		if err.Error() != c.err {
+			t.Errorf("%d:%d to %s: expected error\n%s\ngot\n%s", c.line, c.col, c.name, c.err, err)
+		}
+	}
+}
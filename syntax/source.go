@@ -3,6 +3,8 @@ package syntax
 import (
 	"fmt"
 	ID "some/domain"
+	"sort"
+	"strings"
 
 	"golang.org/x/exp/utf8string"
 )
@@ -11,6 +13,16 @@ type Source struct {
 	filename string
 	text     utf8string.String
 	tokens   []token
+	// comments in the order of appearance, they are not tokens
+	comments []Comment
+}
+
+// Comment is a line or block comment, position is the same as of the token,
+// line comment doesn't include the line break
+type Comment struct {
+	Start, End int
+	Line, Col  int
+	EndLine    int
 }
 
 func NewSource(filename string, text utf8string.String) Source {
@@ -24,8 +36,12 @@ func (s Source) Location(id ID.Token) (line, col int) {
 	return
 }
 
+// Lexeme returns the text of the token, EOF has no text
 func (s Source) Lexeme(id ID.Token) string {
 	t := s.Token(id)
+	if t.Tag == ID.TokenEOF {
+		return ""
+	}
 	return s.text.Slice(int(t.Start), int(t.End+1))
 }
 
@@ -37,6 +53,94 @@ func (s Source) Token(id ID.Token) token {
 	return s.tokens[id]
 }
 
+// TokenCount returns number of tokens including the EOF token
+func (s Source) TokenCount() int {
+	return len(s.tokens)
+}
+
+// TokenAt returns the token covering the position, positions are the same
+// as in the errors: lines start from 1 and columns from 0
+func (s Source) TokenAt(line, col int) (ID.Token, bool) {
+	for i, t := range s.tokens {
+		if t.Tag == ID.TokenTerminator || t.Tag == ID.TokenEOF || t.Line != line {
+			continue
+		}
+		if t.Col <= col && col <= t.Col+t.End-t.Start {
+			return ID.Token(i), true
+		}
+	}
+	return ID.TokenInvalid, false
+}
+
+// Edit replaces text of the token, or of the tokens from Token to Last
+// with everything between them if Last is after Token
+type Edit struct {
+	Token ID.Token
+	Last  ID.Token
+	Text  string
+}
+
+// Apply returns the text of the source with edits applied, edits may go
+// in any order, but must not overlap
+func (s Source) Apply(edits []Edit) string {
+	sorted := make([]Edit, len(edits))
+	copy(sorted, edits)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Token < sorted[j].Token })
+
+	str := strings.Builder{}
+	offset := 0
+	for _, e := range sorted {
+		t := s.Token(e.Token)
+		str.WriteString(s.text.Slice(offset, t.Start))
+		str.WriteString(e.Text)
+		if e.Last > e.Token {
+			t = s.Token(e.Last)
+		}
+		offset = t.End + 1
+	}
+	str.WriteString(s.text.Slice(offset, s.text.RuneCount()))
+	return str.String()
+}
+
+// Comments returns all comments of the source
+func (s Source) Comments() []Comment {
+	return s.comments
+}
+
+// CommentText returns comment as it is written, with the comment markers
+func (s Source) CommentText(c Comment) string {
+	return s.text.Slice(c.Start, c.End+1)
+}
+
+// LeadComments returns group of comments on the lines right before the token,
+// group must start after the line of the previous token, so the comment
+// trailing the code is not a lead comment of the next line
+func (s Source) LeadComments(id ID.Token) []Comment {
+	t := s.Token(id)
+	prevLine, prevEnd := 0, -1
+	for i := int(id) - 1; i >= 0; i-- {
+		if prev := s.Token(ID.Token(i)); prev.Tag != ID.TokenTerminator {
+			prevLine, prevEnd = prev.Line, prev.End
+			break
+		}
+	}
+	end := len(s.comments)
+	for end > 0 && s.comments[end-1].Start > t.Start {
+		end--
+	}
+	start := end
+	line := t.Line
+	for start > 0 {
+		c := s.comments[start-1]
+		if c.EndLine != line-1 || c.Start <= prevEnd || c.Line <= prevLine {
+			break
+		}
+		line = c.Line
+		start--
+	}
+	return s.comments[start:end]
+}
+
 func (s Source) TraceToken(tag ID.Token, lexeme string, line int, col int) string {
 	str := fmt.Sprintf("\ttag = %d\n", tag)
 	if lexeme != "" {
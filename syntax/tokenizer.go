@@ -3,6 +3,7 @@ package syntax
 import (
 	ID "some/domain"
 	"some/util"
+	"strings"
 
 	antlr_parser "some/antlr"
 
@@ -31,11 +32,38 @@ func (tok *tokenizer) Tokenize(src *Source) {
 
 	antlrTokens := lexer.GetAllTokens()
 	src.tokens = make([]token, 0, len(antlrTokens))
+	src.comments = make([]Comment, 0)
 	for i := range antlrTokens {
 		t := antlrTokens[i]
 		if t.GetChannel() == antlr.TokenHiddenChannel {
 			continue
 		}
+		switch t.GetTokenType() {
+		case antlr_parser.SomeLINE_COMMENT:
+			// line break at the end of the comment is not a part of it
+			src.comments = append(src.comments, Comment{
+				Start:   t.GetStart(),
+				End:     t.GetStop() - 1,
+				Line:    t.GetLine(),
+				Col:     t.GetColumn(),
+				EndLine: t.GetLine(),
+			})
+		case antlr_parser.SomeBLOCK_COMMENT:
+			text := src.text.Slice(t.GetStart(), t.GetStop()+1)
+			lines := strings.Count(text, "\n")
+			src.comments = append(src.comments, Comment{
+				Start:   t.GetStart(),
+				End:     t.GetStop(),
+				Line:    t.GetLine(),
+				Col:     t.GetColumn(),
+				EndLine: t.GetLine() + lines,
+			})
+			// comment spanning several lines acts like a line break
+			if lines > 0 {
+				src.tokens = tok.tryInsertSemicolon(src, t)
+			}
+			continue
+		}
 		if t.GetTokenType() == antlr_parser.SomeTERMINATOR ||
 			t.GetTokenType() == antlr_parser.SomeLINE_COMMENT {
 			src.tokens = tok.tryInsertSemicolon(src, t)
@@ -1,161 +1,80 @@
 package syntax
 
 import (
+	"some/corpus"
 	ID "some/domain"
 	"some/util"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"golang.org/x/exp/utf8string"
 )
 
-func TestTokenizerTokens(t *testing.T) {
-	text := utf8string.NewString(`fn identifier()
-	break
-	&& == + - * / 
-	!
-	129389512754912957199521
-	3.63252e-24
-	"some string"
-	Идентификатор
-	`)
+// NOTE: tokens of the sources are golden files of testdata in the root
+
+func TestTokenizerComments(t *testing.T) {
+	text := utf8string.NewString(`x /* inline */ y
+	a /* spans
+	lines */ b // trailing
+	c`)
 
 	handler := util.NewHandler()
 	src := NewSource("tokenizer_test", *text)
 	tokenizer := NewTokenizer(&handler)
 	tokenizer.Tokenize(&src)
 
-	tokens := src.tokens
-	expected := [...]struct {
-		ID.Token
-		string
-	}{
-		{ID.TokenKeyword, "fn"},
-		{ID.TokenIdentifier, "identifier"},
-		{ID.TokenPunctuation, "("},
-		{ID.TokenPunctuation, ")"},
-		{ID.TokenTerminator, "\n"},
-		{ID.TokenKeyword, "break"},
-		{ID.TokenTerminator, "\n"},
-		{ID.TokenBinaryOp, "&&"},
-		{ID.TokenBinaryOp, "=="},
-		{ID.TokenBinaryOp, "+"},
-		{ID.TokenBinaryOp, "-"},
-		{ID.TokenUnaryOp, "*"},
-		{ID.TokenBinaryOp, "/"},
-		{ID.TokenUnaryOp, "!"},
-		{ID.TokenIntLit, "129389512754912957199521"},
-		{ID.TokenTerminator, "\n"},
-		{ID.TokenFloatLit, "3.63252e-24"},
-		{ID.TokenTerminator, "\n"},
-		{ID.TokenStringLit, "\"some string\""},
-		{ID.TokenTerminator, "\n"},
-		{ID.TokenIdentifier, "Идентификатор"},
-		{ID.TokenTerminator, "\n"},
-	}
-
-	if !handler.IsEmpty() {
-		errs := handler.AllErrors()
-		t.Error(strings.Join(errs, " "))
-	}
-
-	if tokens[len(tokens)-1].Tag != ID.TokenEOF {
-		t.Errorf("Missed EOF at the end of token stream")
-	}
-	tokens = tokens[:len(tokens)-1]
-
-	// for i := range tokens {
-	// 	t := tokens[i]
-	// 	if t.tag == ID.TokenTerminator {
-	// 		fmt.Print(";")
-	// 	} else {
-	// 		fmt.Print(source.Slice(int(t.start), int(t.end)+1))
-	// 	}
-	// 	fmt.Print(" ")
-	// }
-
-	if len(tokens) != len(expected) {
-		t.Errorf("Same tokens arrays expected, got tokens=%d and expected=%d", len(tokens), len(expected))
-	}
-
-	tokensLen := len(tokens)
-	for i := 0; i < tokensLen; i++ {
-		lhs := tokens[i]
-		rhs := expected[i]
-		asStr := text.Slice(int(lhs.Start), int(lhs.End)+1)
-		if asStr != rhs.string {
-			t.Errorf("[%d] Strings %s != %s", i, asStr, rhs.string)
-		}
-		if lhs.Tag != rhs.Token {
-			t.Errorf("[%d] Types %d != %d", i, lhs.Tag, rhs.Token)
+	lexemes := make([]string, 0, len(src.tokens))
+	for i := 0; i < len(src.tokens)-1; i++ {
+		if src.tokens[i].Tag == ID.TokenTerminator {
+			lexemes = append(lexemes, ";")
+		} else {
+			lexemes = append(lexemes, src.Lexeme(ID.Token(i)))
 		}
 	}
-}
-
-func TestTokenizerProgram(t *testing.T) {
-	text := utf8string.NewString(`
-	fn main() {
-
-	}
-
-	fn some(a, b) {
-
+	// only comment spanning lines terminates the statement
+	if got := strings.Join(lexemes, " "); got != "x y ; a ; b ; c" {
+		t.Errorf("Expected tokens x y ; a ; b ; c, got %s", got)
 	}
-	`)
-
-	handler := util.NewHandler()
-	src := NewSource("tokenizer_test", *text)
-	tokenizer := NewTokenizer(&handler)
-	tokenizer.Tokenize(&src)
 
-	tokens := src.tokens
-	expected := [...]struct {
-		ID.Token
-		string
+	expected := []struct {
+		text          string
+		line, endLine int
 	}{
-		{ID.TokenKeyword, "fn"},
-		{ID.TokenIdentifier, "main"},
-		{ID.TokenPunctuation, "("},
-		{ID.TokenPunctuation, ")"},
-		{ID.TokenPunctuation, "{"},
-		{ID.TokenPunctuation, "}"},
-		{ID.TokenTerminator, "\n"},
-		{ID.TokenKeyword, "fn"},
-		{ID.TokenIdentifier, "some"},
-		{ID.TokenPunctuation, "("},
-		{ID.TokenIdentifier, "a"},
-		{ID.TokenPunctuation, ","},
-		{ID.TokenIdentifier, "b"},
-		{ID.TokenPunctuation, ")"},
-		{ID.TokenPunctuation, "{"},
-		{ID.TokenPunctuation, "}"},
-		{ID.TokenTerminator, "\n"},
-	}
-
-	if !handler.IsEmpty() {
-		errs := handler.AllErrors()
-		t.Error(strings.Join(errs, " "))
+		{"/* inline */", 1, 1},
+		{"/* spans\n\tlines */", 2, 3},
+		{"// trailing", 3, 3},
 	}
-
-	if tokens[len(tokens)-1].Tag != ID.TokenEOF {
-		t.Errorf("Missed EOF at the end of token stream")
+	comments := src.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("Expected %d comments, got %d", len(expected), len(comments))
 	}
-	tokens = tokens[:len(tokens)-1]
-
-	if len(tokens) != len(expected) {
-		t.Errorf("Same tokens arrays expected, got tokens=%d and expected=%d", len(tokens), len(expected))
+	for i, c := range comments {
+		if text := src.CommentText(c); text != expected[i].text || c.Line != expected[i].line || c.EndLine != expected[i].endLine {
+			t.Errorf("[%d] Expected %q at %d-%d, got %q at %d-%d",
+				i, expected[i].text, expected[i].line, expected[i].endLine, text, c.Line, c.EndLine)
+		}
 	}
+}
 
-	tokensLen := len(tokens)
-	for i := 0; i < tokensLen; i++ {
-		lhs := tokens[i]
-		rhs := expected[i]
-		asStr := text.Slice(int(lhs.Start), int(lhs.End)+1)
-		if asStr != rhs.string {
-			t.Errorf("[%d] Strings %s != %s", i, asStr, rhs.string)
+func FuzzTokenize(f *testing.F) {
+	corpus.Seed(f)
+	f.Fuzz(func(t *testing.T, code string) {
+		if !utf8.ValidString(code) {
+			t.Skip()
 		}
-		if lhs.Tag != rhs.Token {
-			t.Errorf("[%d] Types %d != %d", i, lhs.Tag, rhs.Token)
+		handler := util.NewHandler()
+		src := NewSource("fuzz", *utf8string.NewString(code))
+		tokenizer := NewTokenizer(&handler)
+		tokenizer.Tokenize(&src)
+		if !handler.IsEmpty() {
+			return
 		}
-	}
+		if n := src.TokenCount(); n == 0 || src.Token(ID.Token(n-1)).Tag != ID.TokenEOF {
+			t.Errorf("Expected tokens to end with EOF")
+		}
+		for i := 0; i < src.TokenCount()-1; i++ {
+			src.Lexeme(ID.Token(i))
+		}
+	})
 }
@@ -0,0 +1,28 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+	bool failed;
+	const char *message;
+} some_error;
+
+
+int main(void)
+{
+	some_error _ = ((some_error){0});
+	(void)_;
+	int64_t a = 8;
+	int64_t b = 2;
+	int64_t c = (8 * 3);
+	int64_t d = (-16);
+	const char *e = "E";
+	if ((strcmp(e, "E") == 0))
+	{
+		return ((c + d) + (a / b));
+	}
+	return 0;
+}
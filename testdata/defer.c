@@ -0,0 +1,50 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+	void (*fn)(void *);
+	void *env;
+} some_fn1_void;
+
+static void some_call_fn1_void(some_fn1_void c)
+{
+	c.fn(c.env);
+}
+
+static void main__lit0(void *env_);
+static int64_t log__int(int64_t x);
+
+static void main__lit0(void *env_)
+{
+}
+
+int main(void)
+{
+	int64_t result_;
+	bool defer0_on = false;
+	int64_t defer0_a0;
+	bool defer1_on = false;
+	some_fn1_void defer1_fn;
+	int64_t x = 3;
+	defer0_a0 = x;
+	defer0_on = true;
+	defer1_fn = ((some_fn1_void){main__lit0, NULL});
+	defer1_on = true;
+	result_ = x;
+	goto cleanup;
+cleanup:
+	if (defer1_on)
+		some_call_fn1_void(defer1_fn);
+	if (defer0_on)
+		log__int(defer0_a0);
+	return result_;
+}
+
+static int64_t log__int(int64_t x)
+{
+	return x;
+}
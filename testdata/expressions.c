@@ -0,0 +1,28 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+static int64_t f__int(int64_t a, int64_t b);
+
+int main(void)
+{
+	int64_t x = 8;
+	int64_t y = ((x * 8) + 3);
+	y = (x + (3 / 4));
+	int64_t z = 0;
+	{
+		int64_t tmp0 = z;
+		int64_t tmp1 = f__int(x, y);
+		y = tmp0;
+		z = tmp1;
+	}
+	return (z - y);
+}
+
+static int64_t f__int(int64_t a, int64_t b)
+{
+	return (a * b);
+}
@@ -0,0 +1,18 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+static int64_t some__int(int64_t a, int64_t b);
+
+int main(void)
+{
+	return some__int(1, 2);
+}
+
+static int64_t some__int(int64_t a, int64_t b)
+{
+	return (a - b);
+}
@@ -0,0 +1,45 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+	int64_t (*fn)(void *, int64_t);
+	void *env;
+} some_fn2_int_int;
+
+typedef struct {
+	void (*fn)(void *);
+	void *env;
+} some_fn1_void;
+
+static void some_call_fn1_void(some_fn1_void c)
+{
+	c.fn(c.env);
+}
+
+static int64_t some_call_fn2_int_int(some_fn2_int_int c, int64_t a0)
+{
+	return c.fn(c.env, a0);
+}
+
+static int64_t main__lit0(void *env_, int64_t x);
+static void main__lit1(void *env_);
+
+static int64_t main__lit0(void *env_, int64_t x)
+{
+	return x;
+}
+
+static void main__lit1(void *env_)
+{
+}
+
+int main(void)
+{
+	some_fn2_int_int f = ((some_fn2_int_int){main__lit0, NULL});
+	some_call_fn1_void(((some_fn1_void){main__lit1, NULL}));
+	return some_call_fn2_int_int(f, 0);
+}
@@ -0,0 +1,92 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef enum { some_Shape_Circle, some_Shape_Empty } some_Shape_tag;
+
+typedef struct {
+	some_Shape_tag tag;
+	union {
+		int64_t Circle;
+	};
+} some_Shape;
+
+typedef enum { some_Color_Red, some_Color_Green, some_Color_Blue } some_Color;
+
+static inline const char *Color_name(some_Color v)
+{
+	switch (v)
+	{
+	case some_Color_Red:
+		return "Red";
+	case some_Color_Green:
+		return "Green";
+	case some_Color_Blue:
+		return "Blue";
+	}
+	return "";
+}
+
+static int64_t radius(some_Shape s);
+static int64_t code__int(some_Color c);
+
+int main(void)
+{
+	return (radius(((some_Shape){.tag = some_Shape_Circle, .Circle = 4})) + code__int(some_Color_Blue));
+}
+
+static int64_t radius(some_Shape s)
+{
+	{
+		some_Shape tmp0 = s;
+		switch (tmp0.tag)
+		{
+		case some_Shape_Circle:
+		{
+			int64_t r = tmp0.Circle;
+			(void)r;
+			return r;
+			break;
+		}
+		case some_Shape_Empty:
+		{
+			return 0;
+			break;
+		}
+		default:
+			abort();
+		}
+	}
+	return 0;
+}
+
+static int64_t code__int(some_Color c)
+{
+	{
+		some_Color tmp1 = c;
+		switch (tmp1)
+		{
+		case some_Color_Red:
+		{
+			return 1;
+			break;
+		}
+		case some_Color_Green:
+		{
+			return 2;
+			break;
+		}
+		case some_Color_Blue:
+		{
+			return 3;
+			break;
+		}
+		default:
+			abort();
+		}
+	}
+	return 0;
+}
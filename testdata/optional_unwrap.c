@@ -0,0 +1,40 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+	bool ok;
+	int64_t value;
+} some_opt_int;
+
+static some_opt_int find__int(bool ok);
+
+int main(void)
+{
+	some_opt_int x = find__int(true);
+	{
+		some_opt_int tmp0 = x;
+		if (tmp0.ok)
+		{
+			int64_t v = tmp0.value;
+			(void)v;
+			bool ok = tmp0.ok;
+			(void)ok;
+			(void)ok;
+			return v;
+		}
+	}
+	return 0;
+}
+
+static some_opt_int find__int(bool ok)
+{
+	if (ok)
+	{
+		return ((some_opt_int){true, 42});
+	}
+	return ((some_opt_int){0});
+}
@@ -0,0 +1,82 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+static const char *some_concat(const char *lhs, const char *rhs) {
+	size_t n = strlen(lhs), m = strlen(rhs);
+	char *s = malloc(n + m + 1);
+	memcpy(s, lhs, n);
+	memcpy(s + n, rhs, m + 1);
+	return s;
+}
+
+typedef struct {
+	int64_t (*fn)(void *, int64_t);
+	void *env;
+} some_fn2_int_int;
+
+typedef struct {
+	const char *(*fn)(void *, const char *);
+	void *env;
+} some_fn2_string_string;
+
+static int64_t some_call_fn2_int_int(some_fn2_int_int c, int64_t a0)
+{
+	return c.fn(c.env, a0);
+}
+
+static const char *some_call_fn2_string_string(some_fn2_string_string c, const char *a0)
+{
+	return c.fn(c.env, a0);
+}
+
+static int64_t inc__int__value(void *env, int64_t a0);
+static const char *twice__string__value(void *env, const char *a0);
+static int64_t apply__int_int(some_fn2_int_int f, int64_t x);
+static int64_t inc__int(int64_t x);
+static const char *apply__string_string(some_fn2_string_string f, const char *x);
+static const char *twice__string(const char *s);
+
+static int64_t inc__int__value(void *env, int64_t a0)
+{
+	return inc__int(a0);
+}
+
+static const char *twice__string__value(void *env, const char *a0)
+{
+	return twice__string(a0);
+}
+
+int main(void)
+{
+	int64_t a = apply__int_int(((some_fn2_int_int){inc__int__value, NULL}), 41);
+	const char *s = apply__string_string(((some_fn2_string_string){twice__string__value, NULL}), "ab");
+	if ((strcmp(s, "abab") == 0))
+	{
+		return a;
+	}
+	return 0;
+}
+
+static int64_t apply__int_int(some_fn2_int_int f, int64_t x)
+{
+	return some_call_fn2_int_int(f, x);
+}
+
+static int64_t inc__int(int64_t x)
+{
+	return (x + 1);
+}
+
+static const char *apply__string_string(some_fn2_string_string f, const char *x)
+{
+	return some_call_fn2_string_string(f, x);
+}
+
+static const char *twice__string(const char *s)
+{
+	return some_concat(s, s);
+}
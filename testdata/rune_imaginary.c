@@ -0,0 +1,19 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+
+int main(void)
+{
+	int32_t r = 233;
+	double _Complex z = (2.5 * _Complex_I);
+	(void)z;
+	if ((r == 233))
+	{
+		return 1;
+	}
+	return 0;
+}
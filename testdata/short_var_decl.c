@@ -0,0 +1,26 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+	int64_t _0;
+	int64_t _1;
+} some_tup2_int_int;
+
+static some_tup2_int_int f__int(int64_t x);
+
+int main(void)
+{
+	some_tup2_int_int tmp0 = f__int(1);
+	int64_t q = tmp0._0;
+	int64_t r = tmp0._1;
+	return (q + r);
+}
+
+static some_tup2_int_int f__int(int64_t x)
+{
+	return (some_tup2_int_int){x, (x + 1)};
+}
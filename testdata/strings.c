@@ -0,0 +1,29 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+static const char *some_concat(const char *lhs, const char *rhs) {
+	size_t n = strlen(lhs), m = strlen(rhs);
+	char *s = malloc(n + m + 1);
+	memcpy(s, lhs, n);
+	memcpy(s + n, rhs, m + 1);
+	return s;
+}
+
+
+int main(void)
+{
+	const char *s = some_concat(some_concat(some_concat("a", "b"), "c"), "d");
+	const char *quoted = some_concat("\"", "\\");
+	const char *unused = "";
+	(void)unused;
+	unused = some_concat(s, quoted);
+	if ((strcmp(s, "abcd") == 0))
+	{
+		return 1;
+	}
+	return 0;
+}
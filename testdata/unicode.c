@@ -0,0 +1,18 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+
+int main(void)
+{
+	const char *имя = "\303\251";
+	int32_t r = 233;
+	if ((strcmp(имя, "\303\251") == 0))
+	{
+		return ((int64_t)r);
+	}
+	return 0;
+}
@@ -0,0 +1,46 @@
+#include <complex.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef enum { some_Shape_Circle, some_Shape_Empty } some_Shape_tag;
+
+typedef struct {
+	some_Shape_tag tag;
+	union {
+		int64_t Circle;
+	};
+} some_Shape;
+
+static int64_t radius(some_Shape s);
+
+int main(void)
+{
+	return (radius(((some_Shape){.tag = some_Shape_Circle, .Circle = 3})) + radius(((some_Shape){.tag = some_Shape_Empty})));
+}
+
+static int64_t radius(some_Shape s)
+{
+	{
+		some_Shape tmp0 = s;
+		switch (tmp0.tag)
+		{
+		case some_Shape_Circle:
+		{
+			int64_t r = tmp0.Circle;
+			(void)r;
+			return r;
+			break;
+		}
+		case some_Shape_Empty:
+		{
+			break;
+		}
+		default:
+			abort();
+		}
+	}
+	return 0;
+}
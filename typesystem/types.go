@@ -1,10 +1,183 @@
 package typesystem
 
 import (
-	"fmt"
 	ID "some/domain"
+	"strconv"
+	"strings"
 )
 
+// TypeClass is a set of basic types that constrained type variable can be resolved to
+type TypeClass uint
+
+const ClassAny TypeClass = 0
+
+func classOf(types ...ID.Type) (c TypeClass) {
+	for _, t := range types {
+		c |= 1 << (-t - 1)
+	}
+	return
+}
+
+var (
+	ClassInteger = classOf(
+		ID.TypeInt, ID.TypeInt8, ID.TypeInt16, ID.TypeInt32, ID.TypeInt64,
+		ID.TypeUint8, ID.TypeUint16, ID.TypeUint32, ID.TypeUint64, ID.TypeUintptr)
+	ClassFloat   = classOf(ID.TypeFloat, ID.TypeFloat32, ID.TypeFloat64)
+	ClassComplex = classOf(ID.TypeComplex)
+	ClassReal    = ClassInteger | ClassFloat
+	ClassNum     = ClassReal | ClassComplex
+	// NOTE: Untyped constants adapt to their context, integer literal is allowed
+	// to become float, but not the other way around
+	ClassUntypedInt       = ClassNum
+	ClassUntypedFloat     = ClassFloat | ClassComplex
+	ClassUntypedImaginary = ClassComplex
+	ClassConcat           = ClassNum | classOf(ID.TypeString)
+	ClassOrd              = ClassReal | classOf(ID.TypeString)
+	ClassEq               = ClassOrd | classOf(ID.TypeBool, ID.TypeError, ID.TypeComplex) | ClassEnum
+	// ClassNullable is the class of none, it is allowed to become
+	// either an error or any of the optional types
+	ClassNullable = classOf(ID.TypeError) | ClassOptional
+)
+
+// ClassOptional is not a basic type, it allows every type of the optional kind
+const ClassOptional TypeClass = 1 << 62
+
+// ClassEnum is not a basic type, it allows every declared enumeration
+const ClassEnum TypeClass = 1 << 61
+
+var basicTypes = map[string]ID.Type{
+	"int":     ID.TypeInt,
+	"float":   ID.TypeFloat,
+	"bool":    ID.TypeBool,
+	"string":  ID.TypeString,
+	"void":    ID.TypeVoid,
+	"int8":    ID.TypeInt8,
+	"int16":   ID.TypeInt16,
+	"int32":   ID.TypeInt32,
+	"int64":   ID.TypeInt64,
+	"uint8":   ID.TypeUint8,
+	"uint16":  ID.TypeUint16,
+	"uint32":  ID.TypeUint32,
+	"uint64":  ID.TypeUint64,
+	"uintptr": ID.TypeUintptr,
+	"float32": ID.TypeFloat32,
+	"float64": ID.TypeFloat64,
+	"error":   ID.TypeError,
+	"complex": ID.TypeComplex,
+}
+
+// aliases are the other names of basic types, they are never printed
+var aliases = map[string]ID.Type{
+	"rune": ID.TypeInt32,
+}
+
+// BasicType returns basic type with the given name
+func BasicType(name string) (ID.Type, bool) {
+	if t, ok := aliases[name]; ok {
+		return t, ok
+	}
+	t, ok := basicTypes[name]
+	return t, ok
+}
+
+// Allows reports whether basic type belongs to the class
+func (c TypeClass) Allows(basic ID.Type) bool {
+	if c == ClassAny {
+		return true
+	}
+	if basic >= 0 || basic < ID.TypeLast {
+		return false
+	}
+	return c&classOf(basic) != 0
+}
+
+// AllowsOptional reports whether optional types belong to the class
+func (c TypeClass) AllowsOptional() bool {
+	return c == ClassAny || c&ClassOptional != 0
+}
+
+// AllowsEnum reports whether enumerations belong to the class
+func (c TypeClass) AllowsEnum() bool {
+	return c == ClassAny || c&ClassEnum != 0
+}
+
+// ConversionClass returns class of types that could be converted to the target type
+func ConversionClass(target ID.Type) (TypeClass, bool) {
+	switch {
+	case target == ID.TypeComplex:
+		return ClassNum, true
+	case ClassReal.Allows(target):
+		return ClassReal | ClassEnum, true
+	case target == ID.TypeString:
+		return ClassInteger | classOf(ID.TypeString, ID.TypeError) | ClassEnum, true
+	case target == ID.TypeBool:
+		return classOf(ID.TypeBool), true
+	case target == ID.TypeError:
+		return classOf(ID.TypeString), true
+	default:
+		return ClassAny, false
+	}
+}
+
+// Default returns basic type that unresolved variable of the class resolves to
+func (c TypeClass) Default() ID.Type {
+	for _, t := range [...]ID.Type{ID.TypeInt, ID.TypeFloat, ID.TypeComplex, ID.TypeString, ID.TypeBool, ID.TypeError} {
+		if c.Allows(t) {
+			return t
+		}
+	}
+	panic("Something went horribly wrong")
+}
+
+// Intersect returns class of types allowed by both c and other,
+// false means that there is no such type
+func (c TypeClass) Intersect(other TypeClass) (TypeClass, bool) {
+	if c == ClassAny {
+		return other, true
+	}
+	if other == ClassAny {
+		return c, true
+	}
+	return c & other, c&other != 0
+}
+
+func (c TypeClass) String() string {
+	if c == ClassAny {
+		return "any"
+	}
+	names := make([]string, 0, 4)
+	for t := ID.TypeInt; t >= ID.TypeLast; t-- {
+		if c.Allows(t) {
+			names = append(names, basicTypeName(t))
+		}
+	}
+	if c&ClassOptional != 0 {
+		names = append(names, "?T")
+	}
+	if c&ClassEnum != 0 {
+		names = append(names, "enum")
+	}
+	return strings.Join(names, "|")
+}
+
+// NOTE: Declared types are identified the same way as basic ones, by the negative
+// id (after the last basic type) derived from the node of declaration,
+// so two types are the same only if they come from the same declaration
+
+// DeclaredType returns type declared by the node decl
+func DeclaredType(decl ID.Node) ID.Type {
+	return ID.TypeLast - 1 - ID.Type(decl)
+}
+
+// TypeDeclaration returns node that declares type t, false means
+// that t is not a declared type
+func TypeDeclaration(t ID.Type) (ID.Node, bool) {
+	if t >= ID.TypeLast || t == ID.TypeInvalid {
+		return ID.NodeInvalid, false
+	}
+	return ID.Node(ID.TypeLast - 1 - t), true
+}
+
 type nodeType struct {
 	Node     ID.Node
 	Kind     ID.Kind
@@ -14,16 +187,28 @@ type nodeType struct {
 type TypeRepo struct {
 	nodeTypes []nodeType
 	extraData []ID.Type
+	// names of declared types
+	declared map[ID.Type]string
 }
 
 func NewTypeRepo() TypeRepo {
 	r := TypeRepo{
 		nodeTypes: make([]nodeType, 0, 64),
 		extraData: make([]ID.Type, 0, 64),
+		declared:  make(map[ID.Type]string),
 	}
 	return r
 }
 
+func (r *TypeRepo) DeclareType(t ID.Type, name string) {
+	r.declared[t] = name
+}
+
+// DeclaredTypes returns names of declared types known to the repo
+func (r TypeRepo) DeclaredTypes() map[ID.Type]string {
+	return r.declared
+}
+
 func (r *TypeRepo) AddType(node ID.Node, kind ID.Kind, subtypes ...ID.Type) ID.Type {
 	lhs := ID.TypeInvalid
 	rhs := ID.TypeInvalid
@@ -31,8 +216,12 @@ func (r *TypeRepo) AddType(node ID.Node, kind ID.Kind, subtypes ...ID.Type) ID.T
 	case ID.KindIdentity:
 		fallthrough
 	case ID.KindPtr:
+		fallthrough
+	case ID.KindOptional:
 		lhs = subtypes[0]
 	case ID.KindFunction:
+		fallthrough
+	case ID.KindTuple:
 		r.extraData = append(r.extraData, subtypes...)
 		lhs = ID.Type(len(r.extraData) - len(subtypes))
 		rhs = ID.Type(len(r.extraData))
@@ -86,13 +275,44 @@ func (r TypeRepo) IsTypeVariable(id ID.Type) bool {
 		return t.lhs >= 0
 	case ID.KindPtr:
 		fallthrough
+	case ID.KindOptional:
+		fallthrough
 	case ID.KindFunction:
+		fallthrough
+	case ID.KindTuple:
 		return false
 	default:
 		panic("this switch should be exaustive")
 	}
 }
 
+// NOTE: Type variable keeps its constraint in the otherwise unused rhs
+func (r TypeRepo) Constraint(id ID.Type) TypeClass {
+	t := r.GetType(id)
+	if t.rhs == ID.TypeInvalid {
+		return ClassAny
+	}
+	return TypeClass(t.rhs)
+}
+
+func (r *TypeRepo) Constrain(id ID.Type, class TypeClass) {
+	if class == ClassAny {
+		r.nodeTypes[id].rhs = ID.TypeInvalid
+		return
+	}
+	r.nodeTypes[id].rhs = ID.Type(class)
+}
+
+// TypeVariable returns id of the variable itself: types produced by unification
+// refer to the variable they were unified with
+func (r TypeRepo) TypeVariable(id ID.Type) ID.Type {
+	t := r.GetType(id)
+	if t.lhs == ID.TypeVar {
+		return id
+	}
+	return t.lhs
+}
+
 func (r TypeRepo) SameKind(id1, id2 ID.Type) bool {
 	t1 := r.GetType(id1)
 	t2 := r.GetType(id2)
@@ -104,6 +324,8 @@ func (r TypeRepo) SameKind(id1, id2 ID.Type) bool {
 		return true
 	case ID.KindPtr:
 		return t2.Kind == ID.KindPtr
+	case ID.KindOptional:
+		return t2.Kind == ID.KindOptional
 	case ID.KindFunction:
 		argCount1 := r.Subtypes(id1).Count()
 		argCount2 := r.Subtypes(id2).Count()
@@ -111,57 +333,99 @@ func (r TypeRepo) SameKind(id1, id2 ID.Type) bool {
 		sameKinds := t2.Kind == ID.KindFunction
 		sameKinds = sameKinds && (argCount1 == argCount2)
 		return sameKinds
+	case ID.KindTuple:
+		return t2.Kind == ID.KindTuple && r.Subtypes(id1).Count() == r.Subtypes(id2).Count()
 	default:
 		panic("this switch should be exaustive")
 	}
 }
 
-type typeVarNameGenerator struct {
-	nextLetter   rune
-	seenTypeVars map[ID.Type]string
+// Substitute copies type id from src into r replacing type variables with types from subst
+// (these types must belong to r). Returns false if some type variable has no substitution
+func (r *TypeRepo) Substitute(node ID.Node, src TypeRepo, id ID.Type, subst map[ID.Type]ID.Type) (ID.Type, bool) {
+	t := src.GetType(id)
+	if t.Kind == ID.KindIdentity {
+		if !src.IsTypeVariable(id) {
+			if name, declared := src.declared[t.lhs]; declared {
+				r.declared[t.lhs] = name
+			}
+			return r.AddType(node, ID.KindIdentity, t.lhs), true
+		}
+		substT, has := subst[src.TypeVariable(id)]
+		if !has {
+			return r.AddType(node, ID.KindIdentity, ID.TypeVar), false
+		}
+		return r.Substitute(node, *r, substT, nil)
+	}
+
+	subtypes := make([]ID.Type, 0, 4)
+	it := src.Subtypes(id)
+	for !it.Done() {
+		subtypes = append(subtypes, it.Next())
+	}
+	ok := true
+	for i := range subtypes {
+		subT, substituted := r.Substitute(ID.NodeInvalid, src, subtypes[i], subst)
+		subtypes[i] = subT
+		ok = ok && substituted
+	}
+	return r.AddType(node, t.Kind, subtypes...), ok
+}
+
+// TypePrinter is the context of type printing, it names type variables
+// in the order of appearance: a, b, ..., z, a1, b1, ..., names are kept
+// between calls, so the same variable has the same name in all types printed
+type TypePrinter struct {
+	repo  TypeRepo
+	names map[ID.Type]string
 }
 
-func newTypeVarNameGenerator() typeVarNameGenerator {
-	return typeVarNameGenerator{
-		nextLetter:   'a',
-		seenTypeVars: make(map[ID.Type]string),
+func NewTypePrinter(repo TypeRepo) *TypePrinter {
+	return &TypePrinter{
+		repo:  repo,
+		names: make(map[ID.Type]string),
 	}
 }
 
-func (g *typeVarNameGenerator) nextName(id ID.Type) string {
-	_, ok := g.seenTypeVars[id]
+func (p *TypePrinter) variableName(id ID.Type) string {
+	name, ok := p.names[id]
 	if !ok {
-		seenCount := len(g.seenTypeVars)
-		g.seenTypeVars[id] = fmt.Sprintf("%c%d", g.nextLetter, seenCount/26)
-		g.nextLetter = g.nextLetter + 1
-		if g.nextLetter >= 'z' {
-			g.nextLetter = 'a'
+		n := len(p.names)
+		name = string(rune('a' + n%26))
+		if n >= 26 {
+			name += strconv.Itoa(n / 26)
+		}
+		p.names[id] = name
+	}
+	return name
+}
+
+func basicTypeName(id ID.Type) string {
+	for name, t := range basicTypes {
+		if t == id {
+			return name
 		}
 	}
-	return g.seenTypeVars[id]
+	panic("Something went horribly wrong")
 }
 
-var nameGenerator = newTypeVarNameGenerator()
+// GetString returns the type with type variables named from the start,
+// so it is the same for the same type expression
+func (r TypeRepo) GetString(id ID.Type) string {
+	return NewTypePrinter(r).String(id)
+}
 
-func (r TypeRepo) GetString(id ID.Type) (s string) {
+func (p *TypePrinter) String(id ID.Type) (s string) {
+	r := p.repo
 	t := r.GetType(id)
 
 	typeString := func(parentID, id ID.Type) string {
-		if !r.IsTypeVariable(id) {
-			switch id {
-			case ID.TypeInt:
-				return "int"
-			case ID.TypeFloat:
-				return "float"
-			case ID.TypeString:
-				return "string"
-			case ID.TypeBool:
-				return "bool"
-			default:
-				panic("this switch should be exaustive")
-			}
+		if name, declared := r.declared[id]; declared {
+			return name
+		} else if !r.IsTypeVariable(id) {
+			return basicTypeName(id)
 		} else {
-			return nameGenerator.nextName(parentID)
+			return p.variableName(r.TypeVariable(parentID))
 		}
 	}
 
@@ -170,7 +434,11 @@ func (r TypeRepo) GetString(id ID.Type) (s string) {
 		s += typeString(id, t.lhs)
 	case ID.KindPtr:
 		s += "(^ "
-		s += r.GetString(t.lhs)
+		s += p.String(t.lhs)
+		s += ")"
+	case ID.KindOptional:
+		s += "(? "
+		s += p.String(t.lhs)
 		s += ")"
 	case ID.KindFunction:
 		s += "(FN "
@@ -179,10 +447,17 @@ func (r TypeRepo) GetString(id ID.Type) (s string) {
 			if subtypes.Done() {
 				break
 			}
-			sub := r.GetString(subtypes.Next())
+			sub := p.String(subtypes.Next())
 			s += sub + " "
 		}
 		s += ")"
+	case ID.KindTuple:
+		s += "(TUPLE "
+		subtypes := r.Subtypes(id)
+		for !subtypes.Done() {
+			s += p.String(subtypes.Next()) + " "
+		}
+		s += ")"
 	default:
 		panic("this switch should be exaustive")
 	}
@@ -202,7 +477,11 @@ func newTypeIterator(t nodeType, extraData []ID.Type) typeIterator {
 		fallthrough
 	case ID.KindPtr:
 		fallthrough
+	case ID.KindOptional:
+		fallthrough
 	case ID.KindFunction:
+		fallthrough
+	case ID.KindTuple:
 		it.subtypeIndex = it.lhs
 	default:
 		panic("this switch should be exaustive")
@@ -219,9 +498,13 @@ func (i typeIterator) Count() int {
 	case ID.KindIdentity:
 		return 1
 	case ID.KindPtr:
+		fallthrough
+	case ID.KindOptional:
 		return 1
 	case ID.KindFunction:
-		return int(i.rhs) - int(i.lhs) + 1
+		fallthrough
+	case ID.KindTuple:
+		return int(i.rhs) - int(i.lhs)
 	default:
 		panic("this switch should be exaustive")
 	}
@@ -233,8 +516,12 @@ func (i *typeIterator) Next() ID.Type {
 	case ID.KindIdentity:
 		fallthrough
 	case ID.KindPtr:
+		fallthrough
+	case ID.KindOptional:
 		i.subtypeIndex = ID.TypeInvalid
 	case ID.KindFunction:
+		fallthrough
+	case ID.KindTuple:
 		e = i.extraData[i.subtypeIndex]
 		i.subtypeIndex++
 		if i.subtypeIndex >= i.rhs {
@@ -0,0 +1,40 @@
+package typesystem
+
+import (
+	ID "some/domain"
+	"testing"
+)
+
+func TestTypeVariableNames(t *testing.T) {
+	p := NewTypePrinter(NewTypeRepo())
+	expected := map[int]string{0: "a", 1: "b", 25: "z", 26: "a1", 27: "b1", 52: "a2"}
+	for i := 0; i < 53; i++ {
+		name := p.variableName(ID.Type(i))
+		if e, ok := expected[i]; ok && name != e {
+			t.Errorf("Expected %s for variable %d, got %s", e, i, name)
+		}
+	}
+	if name := p.variableName(ID.Type(1)); name != "b" {
+		t.Errorf("Expected the same name for the same variable, got %s", name)
+	}
+}
+
+func TestTypeStringNormalized(t *testing.T) {
+	r := NewTypeRepo()
+	x := r.AddType(ID.NodeInvalid, ID.KindIdentity, ID.TypeVar)
+	y := r.AddType(ID.NodeInvalid, ID.KindIdentity, ID.TypeVar)
+	f := r.AddType(ID.NodeInvalid, ID.KindFunction, y, x, y)
+	for i := 0; i < 2; i++ {
+		if s := r.GetString(f); s != "(FN a b a )" {
+			t.Errorf("Expected (FN a b a ), got %s", s)
+		}
+	}
+
+	p := NewTypePrinter(r)
+	if s := p.String(x); s != "a" {
+		t.Errorf("Expected a, got %s", s)
+	}
+	if s := p.String(f); s != "(FN b a b )" {
+		t.Errorf("Expected names kept by the printer, got %s", s)
+	}
+}
@@ -0,0 +1,116 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffLine struct {
+	op   byte
+	text string
+	// line numbers of the line in both texts, counting from 1
+	lhs, rhs int
+}
+
+// Diff returns line diff of two texts in unified format, empty if they are equal
+func Diff(lhsName, rhsName, lhs, rhs string) string {
+	if lhs == rhs {
+		return ""
+	}
+	a, b := splitLines(lhs), splitLines(rhs)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = Max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i], i + 1, j + 1})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i], i + 1, j})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j], i, j + 1})
+			j++
+		}
+	}
+
+	str := strings.Builder{}
+	str.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", lhsName, rhsName))
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+		// hunk includes changes separated by no more than two contexts
+		end := start
+		for k := start; k < len(lines) && k <= end+2*diffContext+1; k++ {
+			if lines[k].op != ' ' {
+				end = k
+			}
+		}
+		from, to := Max(start-diffContext, 0), Min(end+diffContext+1, len(lines))
+		writeHunk(&str, lines[from:to])
+		start = to
+	}
+	return str.String()
+}
+
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func writeHunk(str *strings.Builder, lines []diffLine) {
+	lhsStart, rhsStart := 0, 0
+	lhsCount, rhsCount := 0, 0
+	for _, l := range lines {
+		if l.op != '+' {
+			if lhsCount == 0 {
+				lhsStart = l.lhs
+			}
+			lhsCount++
+		}
+		if l.op != '-' {
+			if rhsCount == 0 {
+				rhsStart = l.rhs
+			}
+			rhsCount++
+		}
+	}
+	if lhsCount == 0 {
+		lhsStart = lines[0].lhs
+	}
+	if rhsCount == 0 {
+		rhsStart = lines[0].rhs
+	}
+	str.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", lhsStart, lhsCount, rhsStart, rhsCount))
+	for _, l := range lines {
+		str.WriteByte(l.op)
+		str.WriteString(l.text)
+		if !strings.HasSuffix(l.text, "\n") {
+			str.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
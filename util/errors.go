@@ -10,20 +10,42 @@ const (
 	Parser
 	Ast
 	Semantic
+	Warning
 )
 
 var sources = [...]string{
-	Lexer:    "Lexer-%04d at %s:%d:%d %s",
-	Parser:   "Parser-%04d at %s:%d:%d %s",
-	Ast:      "AST-%04d at %s:%d:%d %s",
-	Semantic: "Sema-%04d at %s:%d:%d %s",
+	Lexer:    "Lexer",
+	Parser:   "Parser",
+	Ast:      "AST",
+	Semantic: "Sema",
+	Warning:  "Warn",
 }
 
+// NOTE: codes are published in diagnostics like Sema-0002, so they never
+// change: new codes of any kind are appended at the end
 const (
 	EP_ExpectedToken errorCode = iota
 	EP_ExpectedSemicolon
 	ES_ScopecheckFailed
 	ES_TypeinferenceFailed
+	ES_UnresolvedType
+	ES_InfiniteType
+	ES_ConstraintFailed
+	ES_InvalidConversion
+	ES_ConversionArity
+	ES_TypeAsValue
+	ES_AssignmentMismatch
+	EP_ExpectedCall
+	ES_InvalidUnwrap
+	EW_IgnoredError
+	ES_NotAType
+	ES_MatchNotUnion
+	ES_NonExhaustiveMatch
+	ES_DuplicateVariant
+	EP_InvalidLiteral
+	ES_LiteralOverflow
+	ES_MissingMain
+	ES_ReturnMismatch
 )
 
 var templates = [...][]string{
@@ -33,11 +55,31 @@ var templates = [...][]string{
 	Parser: {
 		EP_ExpectedToken:     "\nExpected \n%s\nbut got \n%s\n",
 		EP_ExpectedSemicolon: "\nExpected \nsemicolon\nbut got \n%s\n",
+		EP_ExpectedCall:      "\nExpression in defer must be function call, got \n%s\n",
+		EP_InvalidLiteral:    "\nInvalid literal %s: %s",
 	},
 	Ast: {},
 	Semantic: {
 		ES_ScopecheckFailed:    "\nLookup for identifier %s failed",
 		ES_TypeinferenceFailed: "\nUnification failed: %s != %s on node %d",
+		ES_UnresolvedType:      "\nCan't infer concrete type of %s in %s, got %s",
+		ES_InfiniteType:        "\nInfinite type: %s occurs in %s on node %d",
+		ES_ConstraintFailed:    "\nType %s is not one of %s on node %d",
+		ES_InvalidConversion:   "\nCan't convert %s to %s on node %d",
+		ES_ConversionArity:     "\nConversion to %s takes exactly one argument, got %d",
+		ES_TypeAsValue:         "\nType %s can only be called for conversion",
+		ES_AssignmentMismatch:  "\nAssignment mismatch: %d variables but %d values",
+		ES_InvalidUnwrap:       "\nUnwrap takes optional into value and flag, got %d variables and %d values",
+		ES_NotAType:            "\n%s is not a type",
+		ES_MatchNotUnion:       "\nMatch requires value of union or enum type, got %s",
+		ES_NonExhaustiveMatch:  "\nMatch on %s is not exhaustive, missing variants: %s",
+		ES_DuplicateVariant:    "\nVariant %s is matched more than once",
+		ES_LiteralOverflow:     "\nLiteral %s overflows %s",
+		ES_MissingMain:         "\nFunction main is not declared",
+		ES_ReturnMismatch:      "\nReturn mismatch: %d values but function returns %d",
+	},
+	Warning: {
+		EW_IgnoredError: "\nError in %s of type %s is ignored",
 	},
 }
 
@@ -65,7 +107,12 @@ func NewError(kind errorKind, code errorCode, line, col int, filename string, ar
 }
 
 func (e Error) String() string {
-	return fmt.Sprintf(sources[e.kind], e.code, e.filename, e.line, e.col, e.message)
+	return fmt.Sprintf("%s at %s:%d:%d %s", e.Name(), e.filename, e.line, e.col, e.message)
+}
+
+// Name identifies the error by its kind and code, like Sema-0002
+func (e Error) Name() string {
+	return fmt.Sprintf("%s-%04d", sources[e.kind], e.code)
 }
 
 func (e Error) Kind() errorKind { return e.kind }
@@ -79,13 +126,17 @@ func (e Error) Position() (line int, col int, filename string) {
 	return
 }
 
+func (e Error) Message() string { return e.message }
+
 // TODO: rather handling errors, maybe this could be universal logging hanlder?
 type ErrorHandler struct {
 	errors []Error
+	// warnings don't stop the compilation
+	warnings []Error
 }
 
 func NewHandler() ErrorHandler {
-	return ErrorHandler{errors: make([]Error, 0)}
+	return ErrorHandler{errors: make([]Error, 0), warnings: make([]Error, 0)}
 }
 
 func (h ErrorHandler) IsEmpty() bool {
@@ -94,12 +145,17 @@ func (h ErrorHandler) IsEmpty() bool {
 
 func (h *ErrorHandler) Clear() {
 	h.errors = make([]Error, 0)
+	h.warnings = make([]Error, 0)
 }
 
 func (h *ErrorHandler) Add(e Error) {
 	h.errors = append(h.errors, e)
 }
 
+func (h *ErrorHandler) Warn(e Error) {
+	h.warnings = append(h.warnings, e)
+}
+
 const Threshold = 10
 
 func (h ErrorHandler) AllErrors() []string {
@@ -110,3 +166,20 @@ func (h ErrorHandler) AllErrors() []string {
 	}
 	return s
 }
+
+// Errors returns errors with their positions, unlike AllErrors it is not limited by threshold
+func (h ErrorHandler) Errors() []Error {
+	return h.errors
+}
+
+func (h ErrorHandler) Warnings() []Error {
+	return h.warnings
+}
+
+func (h ErrorHandler) AllWarnings() []string {
+	s := make([]string, 0, len(h.warnings))
+	for _, w := range h.warnings {
+		s = append(s, w.message)
+	}
+	return s
+}
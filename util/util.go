@@ -99,10 +99,25 @@ func (s *DisjointSet) Union(a, b uint) {
 	}
 }
 
+// Attach merges set of a into set of b, keeping the root of b as the root of both
+func (s *DisjointSet) Attach(a, b uint) {
+	x := s.Find(a)
+	y := s.Find(b)
+
+	if x == y {
+		return
+	}
+
+	s.parent[x] = y
+	if s.rank[y] <= s.rank[x] {
+		s.rank[y] = s.rank[x] + 1
+	}
+}
+
 func FormatSExpr(sexpr string) string {
 	formatted := strings.Builder{}
 	depth := -1
-	for i := range sexpr {
+	for i := 0; i < len(sexpr); i++ {
 		if sexpr[i] == '(' {
 			depth++
 			formatted.WriteByte('\n')
@@ -53,3 +53,94 @@ func TestDisjointSet(t *testing.T) {
 	}
 	step++
 }
+
+func TestDiff(t *testing.T) {
+	if d := Diff("a", "b", "x\ny\n", "x\ny\n"); d != "" {
+		t.Errorf("Expected no diff, got %q", d)
+	}
+	lhs := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	rhs := "1\n2\n3\nfour\n5\n6\n7\n8\n9\n10\n11\n"
+	expected := `--- a
++++ b
+@@ -1,10 +1,11 @@
+ 1
+ 2
+ 3
+-4
++four
+ 5
+ 6
+ 7
+ 8
+ 9
+ 10
++11
+`
+	if d := Diff("a", "b", lhs, rhs); d != expected {
+		t.Errorf("Expected diff\n%s\ngot\n%s", expected, d)
+	}
+	lhs = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	rhs = "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n"
+	expected = `--- a
++++ b
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -9,4 +9,3 @@
+ 9
+ 10
+ 11
+-12
+`
+	if d := Diff("a", "b", lhs, rhs); d != expected {
+		t.Errorf("Expected diff\n%s\ngot\n%s", expected, d)
+	}
+}
+
+func TestSExprFormattingUnicode(t *testing.T) {
+	sexpr := "(Source(ConstDecl(ID[](é))(Expr[](Expr('é')))))"
+	formatted := FormatSExpr(sexpr)
+	if MinifySExpr(formatted) != sexpr {
+		t.Errorf("Expected %s after formatting, got %s", sexpr, MinifySExpr(formatted))
+	}
+}
+
+// codes are published in diagnostics, none of them may change
+func TestErrorNames(t *testing.T) {
+	cases := []struct {
+		kind     errorKind
+		code     errorCode
+		expected string
+	}{
+		{Parser, EP_ExpectedToken, "Parser-0000"},
+		{Parser, EP_ExpectedSemicolon, "Parser-0001"},
+		{Semantic, ES_ScopecheckFailed, "Sema-0002"},
+		{Semantic, ES_TypeinferenceFailed, "Sema-0003"},
+		{Semantic, ES_UnresolvedType, "Sema-0004"},
+		{Semantic, ES_InfiniteType, "Sema-0005"},
+		{Semantic, ES_ConstraintFailed, "Sema-0006"},
+		{Semantic, ES_InvalidConversion, "Sema-0007"},
+		{Semantic, ES_ConversionArity, "Sema-0008"},
+		{Semantic, ES_TypeAsValue, "Sema-0009"},
+		{Semantic, ES_AssignmentMismatch, "Sema-0010"},
+		{Parser, EP_ExpectedCall, "Parser-0011"},
+		{Semantic, ES_InvalidUnwrap, "Sema-0012"},
+		{Warning, EW_IgnoredError, "Warn-0013"},
+		{Semantic, ES_NotAType, "Sema-0014"},
+		{Semantic, ES_MatchNotUnion, "Sema-0015"},
+		{Semantic, ES_NonExhaustiveMatch, "Sema-0016"},
+		{Semantic, ES_DuplicateVariant, "Sema-0017"},
+		{Parser, EP_InvalidLiteral, "Parser-0018"},
+		{Semantic, ES_LiteralOverflow, "Sema-0019"},
+		{Semantic, ES_MissingMain, "Sema-0020"},
+		{Semantic, ES_ReturnMismatch, "Sema-0021"},
+	}
+	for _, c := range cases {
+		if name := (Error{kind: c.kind, code: c.code}).Name(); name != c.expected {
+			t.Errorf("Expected %s, got %s", c.expected, name)
+		}
+	}
+}